@@ -0,0 +1,121 @@
+package libmangal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/luevano/libmangal/imaging"
+	"github.com/luevano/libmangal/mangadata"
+	"github.com/luevano/libmangal/metadata"
+	"github.com/spf13/afero"
+)
+
+var _ mangadata.PageWithImage = (*localPage)(nil)
+
+// localPage is a page read from a chapter on disk.
+type localPage struct {
+	name      string
+	extension string
+	image     []byte
+	chapter   mangadata.Chapter
+}
+
+func (p *localPage) String() string {
+	return p.name
+}
+
+// Extension gets the image extension of this page.
+func (p *localPage) Extension() string {
+	return p.extension
+}
+
+// Chapter gets the Chapter that this Page is relevant to.
+//
+// Could be nil if the chapter is unknown.
+func (p *localPage) Chapter() mangadata.Chapter {
+	return p.chapter
+}
+
+// Image gets the image contents.
+func (p *localPage) Image() []byte {
+	return p.image
+}
+
+// SetImage sets the image contents.
+func (p *localPage) SetImage(newImage []byte) {
+	p.image = newImage
+}
+
+// chapterContents are the pages and metadata of a chapter on disk.
+type chapterContents struct {
+	pages        []*localPage
+	comicInfoXML *metadata.ComicInfoXML
+}
+
+// formatFromPath detects the chapter format from the path, directories
+// are FormatImages and files are detected by their extension.
+func formatFromPath(fs afero.Fs, path string) (Format, error) {
+	info, err := fs.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	if info.IsDir() {
+		return FormatImages, nil
+	}
+
+	format, ok := formatFromName(path)
+	if !ok {
+		return 0, fmt.Errorf("unknown chapter format for %q", path)
+	}
+	return format, nil
+}
+
+// formatFromName detects the format of a chapter file by its extension.
+func formatFromName(name string) (Format, bool) {
+	// longest extension first, so .tar.gz is not detected as something else
+	var (
+		found  Format
+		length int
+	)
+	lower := strings.ToLower(name)
+	for _, format := range FormatValues() {
+		ext := format.Extension()
+		if ext != "" && strings.HasSuffix(lower, ext) && len(ext) > length {
+			found, length = format, len(ext)
+		}
+	}
+	return found, length != 0
+}
+
+// readChapter reads the pages and ComicInfo.xml (if any) of the chapter at path.
+//
+// Fails with a *PageError if a page can't be read or its contents are not an
+// image, so that no page is lost when the chapter is written again.
+func readChapter(fs afero.Fs, path string, format Format) (*chapterContents, error) {
+	reader, err := openChapter(fs, path, format)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	contents := &chapterContents{comicInfoXML: reader.ComicInfoXML()}
+	for i, page := range reader.Pages() {
+		image, imageFormat, err := reader.ReadPage(i)
+		if err != nil {
+			// the imaging error alone, the page name is already in the PageError
+			var imagingErr imaging.Error
+			if errors.As(err, &imagingErr) {
+				err = imagingErr
+			}
+			return nil, fmt.Errorf("chapter %q: %w", path, &PageError{Page: &localPage{name: page.Name}, Err: err})
+		}
+
+		contents.pages = append(contents.pages, &localPage{
+			name:      page.Name,
+			extension: imageFormat.Extension(),
+			image:     image,
+		})
+	}
+	return contents, nil
+}
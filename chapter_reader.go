@@ -0,0 +1,437 @@
+package libmangal
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/luevano/libmangal/imaging"
+	"github.com/luevano/libmangal/metadata"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/spf13/afero"
+)
+
+// ChapterPage is a page of a chapter opened with OpenChapter.
+type ChapterPage struct {
+	// Name of the page file or archive entry.
+	Name string
+
+	// Size of the page contents in bytes.
+	Size int64
+
+	open func() (io.ReadCloser, error)
+}
+
+// ChapterReader reads the pages and ComicInfo.xml of a chapter on disk,
+// in any Format (not only the ones downloaded by libmangal).
+//
+// Must be closed after use.
+type ChapterReader struct {
+	format       Format
+	pages        []ChapterPage
+	comicInfoXML *metadata.ComicInfoXML
+	closer       io.Closer
+}
+
+// OpenChapter opens the chapter at path for reading, the
+// Format is detected by the extension or being a directory.
+//
+// Archive entries with an image extension are pages (hidden files are
+// ignored), entries without extension are only pages if their contents
+// are an image. TAR.GZ archives and PDF documents are read into memory.
+func OpenChapter(fs afero.Fs, path string) (*ChapterReader, error) {
+	format, err := formatFromPath(fs, path)
+	if err != nil {
+		return nil, err
+	}
+	return openChapter(fs, path, format)
+}
+
+// OpenChapter opens the chapter at path for reading from the client FS,
+// see OpenChapter.
+func (c *Client) OpenChapter(path string) (*ChapterReader, error) {
+	return OpenChapter(c.options.FS, path)
+}
+
+func openChapter(fs afero.Fs, path string, format Format) (*ChapterReader, error) {
+	reader := &ChapterReader{format: format}
+
+	var entries []ChapterPage
+	if format == FormatImages {
+		dirEntries, err := afero.ReadDir(fs, path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range dirEntries {
+			if entry.IsDir() {
+				continue
+			}
+			entryPath := filepath.Join(path, entry.Name())
+			entries = append(entries, ChapterPage{
+				Name: entry.Name(),
+				Size: entry.Size(),
+				open: func() (io.ReadCloser, error) {
+					return fs.Open(entryPath)
+				},
+			})
+		}
+	} else {
+		file, err := fs.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		reader.closer = file
+
+		entries, err = chapterEntries(file, format)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("reading %s chapter %q: %w", format, path, err)
+		}
+	}
+
+	if err := reader.setEntries(entries); err != nil {
+		reader.Close()
+		return nil, err
+	}
+	return reader, nil
+}
+
+// chapterEntries lists the entries of the chapter archive or document.
+func chapterEntries(file afero.File, format Format) ([]ChapterPage, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatCBZ, FormatZIP:
+		return zipEntries(file, info.Size())
+	case FormatTAR, FormatCBT:
+		return tarEntries(file)
+	case FormatTARGZ:
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, err
+		}
+		defer gzipReader.Close()
+
+		return tarGZEntries(gzipReader)
+	case FormatCB7:
+		return sevenZipEntries(file, info.Size())
+	case FormatPDF:
+		return pdfEntries(file)
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+func zipEntries(r io.ReaderAt, size int64) ([]ChapterPage, error) {
+	zipReader, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []ChapterPage
+	for _, f := range zipReader.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		entries = append(entries, ChapterPage{
+			Name: f.Name,
+			Size: int64(f.UncompressedSize64),
+			open: f.Open,
+		})
+	}
+	return entries, nil
+}
+
+// offsetReader tracks the offset of the reader,
+// used to locate the contents of the TAR entries.
+type offsetReader struct {
+	r      io.ReadSeeker
+	offset int64
+}
+
+func (r *offsetReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *offsetReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.r.Seek(offset, whence)
+	if err == nil {
+		r.offset = pos
+	}
+	return pos, err
+}
+
+// tarEntries locates the entries of the TAR archive,
+// their contents are read directly from the file.
+func tarEntries(file afero.File) ([]ChapterPage, error) {
+	offsetReader := &offsetReader{r: file}
+	tarReader := tar.NewReader(offsetReader)
+
+	var entries []ChapterPage
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		section := io.NewSectionReader(file, offsetReader.offset, header.Size)
+		entries = append(entries, ChapterPage{
+			Name: header.Name,
+			Size: header.Size,
+			open: func() (io.ReadCloser, error) {
+				return io.NopCloser(io.NewSectionReader(section, 0, section.Size())), nil
+			},
+		})
+	}
+}
+
+// tarGZEntries reads the entries of the compressed TAR archive into memory.
+func tarGZEntries(r io.Reader) ([]ChapterPage, error) {
+	tarReader := tar.NewReader(r)
+
+	var entries []ChapterPage
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		data, err := io.ReadAll(tarReader)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", header.Name, err)
+		}
+		entries = append(entries, memoryEntry(header.Name, data))
+	}
+}
+
+func sevenZipEntries(r io.ReaderAt, size int64) ([]ChapterPage, error) {
+	sevenZipReader, err := newSevenZipReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []ChapterPage
+	for _, f := range sevenZipReader.Files {
+		if f.IsDir() {
+			continue
+		}
+		entries = append(entries, ChapterPage{
+			Name: f.Name,
+			Size: int64(f.Size),
+			open: func() (io.ReadCloser, error) {
+				// read whole to check the size and checksum
+				data, err := f.ReadAll()
+				if err != nil {
+					return nil, err
+				}
+				return io.NopCloser(bytes.NewReader(data)), nil
+			},
+		})
+	}
+	return entries, nil
+}
+
+// pdfEntries extracts the embedded images of the PDF into
+// memory, in page order (one or more images per page).
+func pdfEntries(r io.ReadSeeker) ([]ChapterPage, error) {
+	type pdfImage struct {
+		page, obj int
+		data      []byte
+	}
+	var images []pdfImage
+	err := api.ExtractImages(r, nil, func(img model.Image, _ bool, _ int) error {
+		data, err := io.ReadAll(img)
+		if err != nil {
+			return err
+		}
+		images = append(images, pdfImage{page: img.PageNr, obj: img.ObjNr, data: data})
+		return nil
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(images, func(i, j int) bool {
+		if images[i].page != images[j].page {
+			return images[i].page < images[j].page
+		}
+		return images[i].obj < images[j].obj
+	})
+
+	entries := make([]ChapterPage, 0, len(images))
+	for i, img := range images {
+		name := fmt.Sprintf("%04d", i+1)
+		if format, err := imaging.Sniff(img.data); err == nil {
+			name += format.Extension()
+		}
+		entries = append(entries, memoryEntry(name, img.data))
+	}
+	return entries, nil
+}
+
+func memoryEntry(name string, data []byte) ChapterPage {
+	return ChapterPage{
+		Name: name,
+		Size: int64(len(data)),
+		open: func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(data)), nil
+		},
+	}
+}
+
+// setEntries parses the ComicInfo.xml and keeps the
+// page entries sorted in natural order of their names.
+func (r *ChapterReader) setEntries(entries []ChapterPage) error {
+	for _, entry := range entries {
+		base := path.Base(filepath.ToSlash(entry.Name))
+		if strings.EqualFold(base, metadata.FilenameComicInfoXML) {
+			data, err := readEntry(entry)
+			if err != nil {
+				return err
+			}
+			var comicInfoXML metadata.ComicInfoXML
+			if err := comicInfoXML.Unmarshal(data); err != nil {
+				return fmt.Errorf("parsing %s: %w", entry.Name, err)
+			}
+			r.comicInfoXML = &comicInfoXML
+			continue
+		}
+
+		// hidden files and macOS resource forks (e.g. ._0001.jpg)
+		if strings.HasPrefix(base, ".") || strings.Contains(entry.Name, "__MACOSX") {
+			continue
+		}
+
+		ext := path.Ext(base)
+		if ext == "" {
+			data, err := readEntry(entry)
+			if err != nil {
+				return err
+			}
+			if _, err := imaging.Sniff(data); err != nil {
+				continue
+			}
+		} else if _, ok := imaging.FormatFromExtension(ext); !ok {
+			continue
+		}
+		r.pages = append(r.pages, entry)
+	}
+
+	sort.SliceStable(r.pages, func(i, j int) bool {
+		return naturalLess(r.pages[i].Name, r.pages[j].Name)
+	})
+	return nil
+}
+
+func readEntry(entry ChapterPage) ([]byte, error) {
+	rc, err := entry.open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", entry.Name, err)
+	}
+	return data, nil
+}
+
+// Format of the chapter.
+func (r *ChapterReader) Format() Format {
+	return r.format
+}
+
+// Pages of the chapter, in natural order of their names.
+func (r *ChapterReader) Pages() []ChapterPage {
+	return r.pages
+}
+
+// ComicInfoXML embedded in the chapter, nil if it has none.
+func (r *ChapterReader) ComicInfoXML() *metadata.ComicInfoXML {
+	return r.comicInfoXML
+}
+
+// OpenPage opens the page at index i (of Pages) for reading.
+//
+// The image format is detected from the contents, the returned
+// error wraps an imaging.Error if the page contents are not an image.
+func (r *ChapterReader) OpenPage(i int) (io.ReadCloser, imaging.Format, error) {
+	if i < 0 || i >= len(r.pages) {
+		return nil, "", fmt.Errorf("page index %d out of range [0, %d)", i, len(r.pages))
+	}
+
+	rc, err := r.pages[i].open()
+	if err != nil {
+		return nil, "", err
+	}
+
+	// enough for the magic numbers and the content type detection
+	buffered := bufio.NewReaderSize(rc, 512)
+	header, err := buffered.Peek(512)
+	if err != nil && !errors.Is(err, io.EOF) {
+		rc.Close()
+		return nil, "", err
+	}
+	format, err := imaging.Sniff(header)
+	if err != nil {
+		rc.Close()
+		return nil, "", fmt.Errorf("page %q: %w", r.pages[i].Name, err)
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{buffered, rc}, format, nil
+}
+
+// ReadPage reads the contents of the page at index i (of Pages),
+// see OpenPage.
+func (r *ChapterReader) ReadPage(i int) ([]byte, imaging.Format, error) {
+	rc, format, err := r.OpenPage(i)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, format, nil
+}
+
+// Close closes the chapter file.
+func (r *ChapterReader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
@@ -0,0 +1,183 @@
+package libmangal
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/luevano/libmangal/mangadata"
+	"github.com/luevano/libmangal/metadata"
+)
+
+// ChapterRelease is the release date preference of ChapterSelectOptions.
+type ChapterRelease uint8
+
+const (
+	// ChapterReleaseAny doesn't prefer chapters by their release date.
+	ChapterReleaseAny ChapterRelease = iota
+
+	// ChapterReleaseNewest prefers the most recently released chapter.
+	ChapterReleaseNewest
+
+	// ChapterReleaseOldest prefers the first released chapter.
+	ChapterReleaseOldest
+)
+
+// ChapterSelectOptions configures the preference between chapters with the
+// same number (usually of different scanlation groups), see Client.SelectChapters.
+//
+// The preferences are applied in order: PreferredGroups, MostPages and
+// Release. Remaining ties keep the first chapter returned by the provider.
+type ChapterSelectOptions struct {
+	// PreferredGroups are the scanlation groups in order of preference
+	// (case-insensitive). Chapters of other groups go after them.
+	PreferredGroups []string
+
+	// MostPages prefers the chapter with the highest page count.
+	//
+	// The pages of the tied chapters are requested to the provider.
+	MostPages bool
+
+	// Release date preference, chapters without date go last.
+	Release ChapterRelease
+}
+
+// DefaultChapterSelectOptions constructs default ChapterSelectOptions.
+func DefaultChapterSelectOptions() ChapterSelectOptions {
+	return ChapterSelectOptions{
+		PreferredGroups: nil,
+		MostPages:       false,
+		Release:         ChapterReleaseAny,
+	}
+}
+
+// SelectChapters returns exactly one chapter per number (see
+// ChapterSelectOptions), sorted by number.
+//
+// Fractional numbers (e.g. 10.5) are different chapters. Chapters without
+// number (0, e.g. oneshots or extras) are only the same chapter if their
+// titles match (case-insensitive), they go first in the provider order.
+func (c *Client) SelectChapters(
+	ctx context.Context,
+	chapters []mangadata.Chapter,
+	options ChapterSelectOptions,
+) ([]mangadata.Chapter, error) {
+	var (
+		byNumber = make(map[chapterKey][]mangadata.Chapter)
+		numbers  []chapterKey
+	)
+	for _, chapter := range chapters {
+		info := chapter.Info()
+		key := newChapterKey(info.Number, info.Title)
+		if _, ok := byNumber[key]; !ok {
+			numbers = append(numbers, key)
+		}
+		byNumber[key] = append(byNumber[key], chapter)
+	}
+	sort.SliceStable(numbers, func(i, j int) bool { return numbers[i].number < numbers[j].number })
+
+	selected := make([]mangadata.Chapter, len(numbers))
+	for i, key := range numbers {
+		candidates := byNumber[key]
+		preferred, err := c.selectChapter(ctx, candidates, options)
+		if err != nil {
+			return nil, err
+		}
+		if len(candidates) > 1 {
+			c.logger.Log("selected chapter %q out of %d with the same number", candidates[preferred], len(candidates))
+		}
+		selected[i] = candidates[preferred]
+	}
+	return selected, nil
+}
+
+// chapterKey identifies the chapters that are the same chapter (e.g. of
+// different scanlation groups), by their number. Chapters without number
+// (0, e.g. oneshots or extras) are identified by their title.
+type chapterKey struct {
+	number int64
+	title  string
+}
+
+func newChapterKey(number float32, title string) chapterKey {
+	key := chapterKey{number: chapterNumberKey(number)}
+	if key.number == 0 {
+		key.title = strings.ToLower(strings.TrimSpace(title))
+	}
+	return key
+}
+
+// selectChapter returns the index of the preferred chapter of the candidates
+// (with the same number), see ChapterSelectOptions.
+func (c *Client) selectChapter(
+	ctx context.Context,
+	candidates []mangadata.Chapter,
+	options ChapterSelectOptions,
+) (int, error) {
+	tied := make([]int, len(candidates))
+	for i := range candidates {
+		tied[i] = i
+	}
+
+	// keep only the tied candidates with the lowest rank
+	keepBest := func(rank func(i int) int) {
+		best := tied[:0]
+		bestRank := 0
+		for _, i := range tied {
+			r := rank(i)
+			switch {
+			case len(best) == 0 || r < bestRank:
+				best, bestRank = append(best[:0], i), r
+			case r == bestRank:
+				best = append(best, i)
+			}
+		}
+		tied = best
+	}
+
+	if len(options.PreferredGroups) > 0 {
+		keepBest(func(i int) int {
+			group := candidates[i].Info().ScanlationGroup
+			for rank, preferred := range options.PreferredGroups {
+				if strings.EqualFold(group, preferred) {
+					return rank
+				}
+			}
+			return len(options.PreferredGroups)
+		})
+	}
+
+	if options.MostPages && len(tied) > 1 {
+		counts := make(map[int]int, len(tied))
+		for _, i := range tied {
+			pages, err := c.ChapterPages(ctx, candidates[i])
+			if err != nil {
+				return 0, err
+			}
+			counts[i] = len(pages)
+		}
+		keepBest(func(i int) int { return -counts[i] })
+	}
+
+	if options.Release != ChapterReleaseAny {
+		keepBest(func(i int) int {
+			date := dateKey(candidates[i].Info().Date)
+			switch {
+			case date == 0:
+				return math.MaxInt
+			case options.Release == ChapterReleaseNewest:
+				return -date
+			default:
+				return date
+			}
+		})
+	}
+
+	return tied[0], nil
+}
+
+// dateKey is the date as a comparable number, 0 for the zero date.
+func dateKey(date metadata.Date) int {
+	return date.Year*10000 + date.Month*100 + date.Day
+}
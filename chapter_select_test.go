@@ -0,0 +1,155 @@
+package libmangal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/luevano/libmangal/mangadata"
+	"github.com/luevano/libmangal/metadata"
+	"github.com/spf13/afero"
+)
+
+func TestSelectChapter(t *testing.T) {
+	var (
+		january  = metadata.Date{Year: 2024, Month: 1, Day: 1}
+		february = metadata.Date{Year: 2024, Month: 2, Day: 1}
+		march    = metadata.Date{Year: 2024, Month: 3, Day: 1}
+	)
+	type candidate struct {
+		group string
+		pages int
+		date  metadata.Date
+	}
+
+	tests := []struct {
+		name       string
+		candidates []candidate
+		options    ChapterSelectOptions
+		want       string
+	}{
+		{
+			name:       "first by default",
+			candidates: []candidate{{group: "A", pages: 1}, {group: "B", pages: 9}},
+			options:    DefaultChapterSelectOptions(),
+			want:       "A",
+		},
+		{
+			name:       "preferred groups order",
+			candidates: []candidate{{group: "A"}, {group: "B"}, {group: "C"}},
+			options:    ChapterSelectOptions{PreferredGroups: []string{"c", "b"}},
+			want:       "C",
+		},
+		{
+			name:       "preferred group missing",
+			candidates: []candidate{{group: "A"}, {group: "B"}},
+			options:    ChapterSelectOptions{PreferredGroups: []string{"z"}},
+			want:       "A",
+		},
+		{
+			name:       "preferred groups before pages",
+			candidates: []candidate{{group: "A", pages: 10}, {group: "B", pages: 2}},
+			options:    ChapterSelectOptions{PreferredGroups: []string{"B"}, MostPages: true},
+			want:       "B",
+		},
+		{
+			name:       "most pages",
+			candidates: []candidate{{group: "A", pages: 2}, {group: "B", pages: 5}, {group: "C", pages: 5}},
+			options:    ChapterSelectOptions{MostPages: true},
+			want:       "B",
+		},
+		{
+			name: "most pages then newest",
+			candidates: []candidate{
+				{group: "A", pages: 2, date: march},
+				{group: "B", pages: 5, date: january},
+				{group: "C", pages: 5, date: february},
+			},
+			options: ChapterSelectOptions{MostPages: true, Release: ChapterReleaseNewest},
+			want:    "C",
+		},
+		{
+			name:       "newest with dateless",
+			candidates: []candidate{{group: "A", date: january}, {group: "B"}, {group: "C", date: february}},
+			options:    ChapterSelectOptions{Release: ChapterReleaseNewest},
+			want:       "C",
+		},
+		{
+			name:       "oldest with dateless",
+			candidates: []candidate{{group: "A"}, {group: "B", date: march}, {group: "C", date: february}},
+			options:    ChapterSelectOptions{Release: ChapterReleaseOldest},
+			want:       "C",
+		},
+		{
+			name:       "all dateless",
+			candidates: []candidate{{group: "A"}, {group: "B"}},
+			options:    ChapterSelectOptions{Release: ChapterReleaseNewest},
+			want:       "A",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manga := newFakeManga("berserk", "Berserk")
+			volume := &fakeVolume{manga: manga}
+			var chapters []mangadata.Chapter
+			for _, c := range tt.candidates {
+				chapters = append(chapters, &fakeChapter{
+					info:   mangadata.ChapterInfo{Number: 5, Title: "Five", ScanlationGroup: c.group, Date: c.date},
+					volume: volume,
+					pages:  c.pages,
+				})
+			}
+			provider := &fakeProvider{mangas: []*fakeManga{manga}}
+			client := newFakeClient(t, afero.NewMemMapFs(), provider)
+
+			selected, err := client.SelectChapters(context.Background(), chapters, tt.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(selected) != 1 {
+				t.Fatalf("selected %d chapters, want 1", len(selected))
+			}
+			if group := selected[0].Info().ScanlationGroup; group != tt.want {
+				t.Errorf("selected the chapter of %q, want %q", group, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectChaptersNumbers(t *testing.T) {
+	manga := newFakeManga("berserk", "Berserk",
+		mangadata.ChapterInfo{Number: 2, Title: "Two", ScanlationGroup: "A"},
+		mangadata.ChapterInfo{Title: "Extra", ScanlationGroup: "A"},
+		mangadata.ChapterInfo{Number: 1.5, Title: "One and a half", ScanlationGroup: "A"},
+		mangadata.ChapterInfo{Title: " extra ", ScanlationGroup: "B"},
+		mangadata.ChapterInfo{Number: 1, Title: "One", ScanlationGroup: "A"},
+		mangadata.ChapterInfo{Title: "Oneshot", ScanlationGroup: "A"},
+		mangadata.ChapterInfo{Number: 2, Title: "Two", ScanlationGroup: "B"},
+	)
+	provider := &fakeProvider{mangas: []*fakeManga{manga}}
+	client := newFakeClient(t, afero.NewMemMapFs(), provider)
+	chapters, err := client.MangaChapters(context.Background(), manga)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	selected, err := client.SelectChapters(context.Background(), chapters, ChapterSelectOptions{PreferredGroups: []string{"B"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// chapters without number first, in the provider order and by title
+	want := []mangadata.ChapterInfo{
+		manga.chapters[3].info,
+		manga.chapters[5].info,
+		manga.chapters[4].info,
+		manga.chapters[2].info,
+		manga.chapters[6].info,
+	}
+	if len(selected) != len(want) {
+		t.Fatalf("selected %d chapters, want %d", len(selected), len(want))
+	}
+	for i, chapter := range selected {
+		if chapter.Info() != want[i] {
+			t.Errorf("chapter %d is %+v, want %+v", i, chapter.Info(), want[i])
+		}
+	}
+}
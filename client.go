@@ -42,14 +42,35 @@ func NewClient(
 	logger := logger.NewLogger()
 	provider.SetLogger(logger)
 
-	return &Client{
+	client := &Client{
 		provider: provider,
 		meta:     map[metadata.IDSource]*metadata.ProviderWithCache{},
 		options:  options,
 		logger:   logger,
-	}, nil
+	}
+
+	for _, p := range options.MetadataProviders {
+		if err := client.SetMetadataProvider(p); err != nil {
+			// the metadata providers are owned by the caller
+			if closeErr := client.Close(); closeErr != nil {
+				logger.Log("error while closing Provider %q: %s", providerInfo.ID, closeErr.Error())
+			}
+			return nil, err
+		}
+
+		// an invalid saved session shouldn't prevent the client from being built
+		if _, err := p.RestoreSession(ctx); err != nil {
+			logger.Log("error while restoring session for metadata Provider %q: %s", p.Info().ID, err.Error())
+		}
+	}
+
+	return client, nil
 }
 
+// Close closes the provider.
+//
+// The metadata providers are not closed, they're owned by the
+// caller as they can be shared between clients.
 func (c *Client) Close() error {
 	return c.provider.Close()
 }
@@ -93,6 +114,24 @@ func (c *Client) ChapterPages(ctx context.Context, chapter mangadata.Chapter) ([
 	return c.provider.ChapterPages(ctx, chapter)
 }
 
+// MangaChapters gets the chapters of all the volumes of the manga.
+func (c *Client) MangaChapters(ctx context.Context, manga mangadata.Manga) ([]mangadata.Chapter, error) {
+	volumes, err := c.MangaVolumes(ctx, manga)
+	if err != nil {
+		return nil, err
+	}
+
+	var chapters []mangadata.Chapter
+	for _, volume := range volumes {
+		volumeChapters, err := c.VolumeChapters(ctx, volume)
+		if err != nil {
+			return nil, err
+		}
+		chapters = append(chapters, volumeChapters...)
+	}
+	return chapters, nil
+}
+
 // ProviderName determines the provider directory name.
 func (c *Client) ProviderName(provider ProviderInfo) string {
 	return c.options.ProviderName(provider)
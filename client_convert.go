@@ -0,0 +1,257 @@
+package libmangal
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/luevano/libmangal/imaging"
+	"github.com/luevano/libmangal/mangadata"
+	"github.com/luevano/libmangal/metadata"
+	"github.com/spf13/afero"
+)
+
+// ConvertOptions configures the conversion of downloaded chapters.
+type ConvertOptions struct {
+	// Format the chapter is converted to.
+	Format Format
+
+	// WriteComicInfoXML writes the ComicInfo.xml when converting to a
+	// comic book format (see Format.IsComicBook).
+	//
+	// The ComicInfo.xml embedded in the source chapter is kept, unless
+	// Chapter is set, then it's regenerated from its metadata.
+	WriteComicInfoXML bool
+
+	// ComicInfoXMLOptions options to use for ComicInfo.xml when WriteComicInfoXml is true.
+	ComicInfoXMLOptions metadata.ComicInfoXMLOptions
+
+	// Chapter the file belongs to, used to regenerate the ComicInfo.xml.
+	//
+	// If nil, the existing ComicInfo.xml (if any) is kept, and the image
+	// pipeline gets a chapter built from it and the file and directory names.
+	Chapter mangadata.Chapter
+
+	// PDFOptions options to use when converting to FormatPDF.
+	PDFOptions PDFOptions
+
+	// Strict means that if the ComicInfo.xml can't be regenerated
+	// the chapter will not be converted.
+	Strict bool
+
+	// ImagePipeline is applied to the images of the chapter before saving them.
+	//
+	// If nil, the images are kept as they are.
+	ImagePipeline *imaging.Pipeline
+
+	// DeviceProfile is the name of the imaging.DeviceProfile to use,
+	// same as DownloadOptions.DeviceProfile.
+	DeviceProfile string
+
+	// KeepOriginal keeps the source chapter when the converted
+	// chapter is written to a different path (different extension).
+	KeepOriginal bool
+}
+
+// DefaultConvertOptions constructs default ConvertOptions.
+func DefaultConvertOptions() ConvertOptions {
+	return ConvertOptions{
+		Format:              FormatCBZ,
+		WriteComicInfoXML:   true,
+		ComicInfoXMLOptions: metadata.DefaultComicInfoOptions(),
+		PDFOptions:          DefaultPDFOptions(),
+		Chapter:             nil,
+		Strict:              false,
+		ImagePipeline:       nil,
+		DeviceProfile:       "",
+		KeepOriginal:        false,
+	}
+}
+
+// ConvertChapter converts the already downloaded chapter at path (in any
+// Format, detected by its extension or being a directory) to another Format.
+//
+// The converted chapter is written next to the source with the extension of
+// the new format and moved into place once complete, the source is then
+// removed unless ConvertOptions.KeepOriginal is set. An existing chapter
+// at the target path is replaced. Converting to the same
+// format rewrites the chapter in place (e.g. to apply an image pipeline).
+//
+// A page that can't be read or is not an image fails the conversion with
+// a *PageError, the source is only replaced or removed when all its pages
+// were written.
+//
+// Returns the path of the converted chapter.
+func (c *Client) ConvertChapter(
+	ctx context.Context,
+	path string,
+	options ConvertOptions,
+) (string, error) {
+	if !options.Format.IsAFormat() {
+		return "", fmt.Errorf("unsupported format %q", options.Format)
+	}
+
+	source, err := formatFromPath(c.options.FS, path)
+	if err != nil {
+		return "", err
+	}
+
+	c.logger.Log("converting chapter %q from %s to %s", path, source, options.Format)
+	contents, err := readChapter(c.options.FS, path, source)
+	if err != nil {
+		return "", err
+	}
+	if len(contents.pages) == 0 {
+		return "", fmt.Errorf("no pages found in chapter %q", path)
+	}
+
+	// the pipeline stages get the chapter of each page
+	chapter := options.Chapter
+	if chapter == nil {
+		chapter = fileChapter(path, source, contents.comicInfoXML)
+	}
+	pages := make([]mangadata.PageWithImage, len(contents.pages))
+	for i, page := range contents.pages {
+		page.chapter = chapter
+		pages[i] = page
+	}
+
+	pipeline, err := DownloadOptions{
+		ImagePipeline: options.ImagePipeline,
+		DeviceProfile: options.DeviceProfile,
+	}.imagePipeline()
+	if err != nil {
+		return "", err
+	}
+	if pipeline != nil {
+		if err := checkDecodable(pages); err != nil {
+			return "", err
+		}
+		c.logger.Log("applying image pipeline to %d pages", len(pages))
+		pages, err = pipeline.Run(ctx, pages)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	extras := chapterExtras{
+		comicInfoXMLOptions: options.ComicInfoXMLOptions,
+		pdfOptions:          options.PDFOptions,
+	}
+	// the ComicInfo.xml is also used for the PDF document info
+	needsComicInfoXML := options.Format.IsComicBook() && options.WriteComicInfoXML ||
+		options.Format == FormatPDF && options.PDFOptions.WriteMetadata
+	if needsComicInfoXML {
+		extras.comicInfoXML = contents.comicInfoXML
+		if options.Chapter != nil && metadata.Validate(options.Chapter.Volume().Manga().Metadata()) == nil {
+			info := options.Chapter.Info()
+			ciXML, err := c.getComicInfoXML(options.Chapter, metadata.Chapter{
+				Title:           info.Title,
+				URL:             info.URL,
+				Number:          info.Number,
+				Date:            info.Date,
+				ScanlationGroup: info.ScanlationGroup,
+				Pages:           len(pages),
+			})
+			if err != nil && options.Strict {
+				return "", err
+			}
+			if err == nil {
+				extras.comicInfoXML = &ciXML
+			}
+		}
+	}
+	if options.Format == FormatPDF {
+		title := strings.TrimSuffix(filepath.Base(path), source.Extension())
+		switch {
+		case options.Chapter != nil:
+			title = chapterTitle(options.Chapter)
+		case contents.comicInfoXML != nil && contents.comicInfoXML.Title != "":
+			title = contents.comicInfoXML.Title
+		}
+		extras.pdfSections = []pdfSection{{title: title}}
+	}
+
+	target := path[:len(path)-len(source.Extension())] + options.Format.Extension()
+	tmp := filepath.Join(filepath.Dir(target), "."+filepath.Base(target)+".tmp")
+	if err := c.options.FS.RemoveAll(tmp); err != nil {
+		return "", err
+	}
+
+	if _, err := c.writeChapter(pages, tmp, options.Format, extras); err != nil {
+		_ = c.options.FS.RemoveAll(tmp)
+		return "", err
+	}
+
+	// the source is only replaced (or removed) if no page was lost
+	written, err := chapterPageCount(c.options.FS, tmp, options.Format)
+	if err == nil && written < len(pages) {
+		err = fmt.Errorf("converted chapter has %d pages, want %d", written, len(pages))
+	}
+	if err != nil {
+		_ = c.options.FS.RemoveAll(tmp)
+		return "", fmt.Errorf("checking converted chapter %q: %w", target, err)
+	}
+
+	if err := c.replace(tmp, target); err != nil {
+		_ = c.options.FS.RemoveAll(tmp)
+		return "", err
+	}
+
+	if target != path && !options.KeepOriginal {
+		if err := c.options.FS.RemoveAll(path); err != nil {
+			return "", err
+		}
+	}
+
+	return target, nil
+}
+
+// replace moves src to dst, replacing dst if it exists.
+//
+// Files are replaced atomically (on file systems that support it).
+// Directories can't be renamed over, so dst is moved aside first and
+// removed once src is in place, or restored if that fails.
+func (c *Client) replace(src, dst string) error {
+	fs := c.options.FS
+	dstInfo, err := fs.Stat(dst)
+	if err != nil {
+		return fs.Rename(src, dst)
+	}
+	srcInfo, err := fs.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !dstInfo.IsDir() && !srcInfo.IsDir() {
+		return fs.Rename(src, dst)
+	}
+
+	old := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".old")
+	if err := fs.RemoveAll(old); err != nil {
+		return err
+	}
+	if err := fs.Rename(dst, old); err != nil {
+		return err
+	}
+	if err := fs.Rename(src, dst); err != nil {
+		if restoreErr := fs.Rename(old, dst); restoreErr != nil {
+			return fmt.Errorf("%w (restoring %q: %s)", err, dst, restoreErr)
+		}
+		return err
+	}
+	return fs.RemoveAll(old)
+}
+
+// chapterPageCount returns the number of pages of the chapter at path.
+func chapterPageCount(fs afero.Fs, path string, format Format) (int, error) {
+	if format == FormatPDF {
+		return pdfPageCount(fs, path)
+	}
+	reader, err := openChapter(fs, path, format)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+	return len(reader.Pages()), nil
+}
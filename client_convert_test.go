@@ -0,0 +1,141 @@
+package libmangal
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// testPNG is a small valid PNG image.
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// testFile is a file of a test chapter archive.
+type testFile struct {
+	name string
+	data []byte
+}
+
+// writeTestCBZ writes a CBZ chapter with the given files, in order.
+func writeTestCBZ(t *testing.T, fs afero.Fs, path string, files ...testFile) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for _, file := range files {
+		w, err := writer.Create(file.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(file.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(fs, path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestClient creates a client with the local provider on fs.
+func newTestClient(t *testing.T, fs afero.Fs, directory string) *Client {
+	t.Helper()
+
+	if err := fs.MkdirAll(directory, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	providerOptions := DefaultLocalProviderOptions()
+	providerOptions.FS = fs
+	providerOptions.Directory = directory
+
+	options := DefaultClientOptions()
+	options.FS = fs
+	client, err := NewClient(context.Background(), NewLocalProviderLoader(providerOptions), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestConvertChapter(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	client := newTestClient(t, fs, "library")
+	writeTestCBZ(t, fs, "library/Manga/[0001.0] One.cbz",
+		testFile{"001.png", testPNG(t)},
+		testFile{"002.png", testPNG(t)},
+	)
+
+	target, err := client.ConvertChapter(context.Background(), "library/Manga/[0001.0] One.cbz", DefaultConvertOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "library/Manga/[0001.0] One.cbz" {
+		t.Errorf("converted to %q", target)
+	}
+
+	options := DefaultConvertOptions()
+	options.Format = FormatZIP
+	target, err = client.ConvertChapter(context.Background(), "library/Manga/[0001.0] One.cbz", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, err := chapterPageCount(fs, target, FormatZIP); err != nil || count != 2 {
+		t.Errorf("converted chapter has %d pages (%v), want 2", count, err)
+	}
+	if ok, _ := afero.Exists(fs, "library/Manga/[0001.0] One.cbz"); ok {
+		t.Error("source chapter was not removed")
+	}
+}
+
+func TestConvertChapterCorruptPage(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	client := newTestClient(t, fs, "library")
+	source := "library/Manga/[0001.0] One.cbz"
+	writeTestCBZ(t, fs, source,
+		testFile{"001.png", testPNG(t)},
+		testFile{"002.jpg", []byte("<html>not found</html>")},
+		testFile{"003.png", testPNG(t)},
+	)
+	original, err := afero.ReadFile(fs, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options := DefaultConvertOptions()
+	options.Format = FormatZIP
+	_, err = client.ConvertChapter(context.Background(), source, options)
+	var pageErr *PageError
+	if !errors.As(err, &pageErr) {
+		t.Fatalf("got error %v, want a *PageError", err)
+	}
+	if pageErr.Page.String() != "002.jpg" {
+		t.Errorf("error is for page %q, want 002.jpg", pageErr.Page)
+	}
+
+	data, err := afero.ReadFile(fs, source)
+	if err != nil {
+		t.Fatalf("source chapter was removed: %s", err)
+	}
+	if !bytes.Equal(data, original) {
+		t.Error("source chapter was changed")
+	}
+	if ok, _ := afero.Exists(fs, "library/Manga/[0001.0] One.zip"); ok {
+		t.Error("converted chapter was written")
+	}
+}
@@ -2,8 +2,11 @@ package libmangal
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	iofs "io/fs"
 	"path/filepath"
+	"time"
 
 	"github.com/luevano/libmangal/mangadata"
 	"github.com/luevano/libmangal/metadata"
@@ -46,9 +49,24 @@ func (c *Client) DownloadChapter(
 	}
 	tmpClient.options.FS = afero.NewMemMapFs()
 
-	downChap, err := tmpClient.downloadChapterWithMetadata(ctx, chapter, options, func(path string) (bool, error) {
+	existsFunc := func(path string) (bool, error) {
 		return afero.Exists(c.options.FS, path)
-	})
+	}
+	var (
+		entry        *ManifestChapter
+		mangaDir     string
+		recordedPath string
+	)
+	if options.WriteManifest {
+		var err error
+		entry = &ManifestChapter{}
+		existsFunc, mangaDir, recordedPath, err = c.manifestExistsFunc(chapter, options, existsFunc)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	downChap, err := tmpClient.downloadChapterWithMetadata(ctx, chapter, options, existsFunc, entry)
 	if err != nil {
 		return nil, err
 	}
@@ -61,9 +79,124 @@ func (c *Client) DownloadChapter(
 		return nil, err
 	}
 
+	if entry != nil && downChap.ChapterStatus != metadata.DownloadStatusExists {
+		if err := c.recordManifest(chapter, downChap, mangaDir, options.Format, *entry); err != nil {
+			return nil, err
+		}
+	}
+
+	// skipped by its manifest entry, which may be under a previous name
+	if recordedPath != "" && downChap.ChapterStatus == metadata.DownloadStatusExists {
+		downChap.Directory = filepath.Dir(recordedPath)
+		downChap.Filename = filepath.Base(recordedPath)
+	}
+
 	return downChap, nil
 }
 
+// DownloadChapters downloads the chapters with the given DownloadOptions, only
+// one per number (see Client.SelectChapters and DownloadOptions.ChapterSelect)
+// so chapters of different scanlation groups don't overwrite each other.
+//
+// Chapters are downloaded in order of number, stopping at the first error.
+// The chapters downloaded until then are returned along with it.
+func (c *Client) DownloadChapters(
+	ctx context.Context,
+	chapters []mangadata.Chapter,
+	options DownloadOptions,
+) ([]*metadata.DownloadedChapter, error) {
+	selected, err := c.SelectChapters(ctx, chapters, options.ChapterSelect)
+	if err != nil {
+		return nil, err
+	}
+
+	downloaded := make([]*metadata.DownloadedChapter, 0, len(selected))
+	for _, chapter := range selected {
+		downChap, err := c.DownloadChapter(ctx, chapter, options)
+		if err != nil {
+			return downloaded, fmt.Errorf("downloading chapter %q: %w", chapter, err)
+		}
+		downloaded = append(downloaded, downChap)
+	}
+	return downloaded, nil
+}
+
+// manifestExistsFunc wraps existsFunc so that the chapter is checked by its
+// manifest entry (if any) instead of its name, see DownloadOptions.WriteManifest.
+//
+// Returns the manga directory of the manifest and the recorded path of the
+// chapter (empty if not recorded), which is the existing one when the chapter
+// name changed since it was written.
+func (c *Client) manifestExistsFunc(
+	chapter mangadata.Chapter,
+	options DownloadOptions,
+	existsFunc func(string) (bool, error),
+) (func(string) (bool, error), string, string, error) {
+	directory, mangaDir := c.chapterDirs(c.provider.Info(), chapter, options)
+	chapterPath := filepath.Join(directory, c.ChapterName(chapter, options.Format))
+
+	manifest, err := ReadManifest(c.options.FS, mangaDir)
+	if err != nil {
+		return nil, "", "", err
+	}
+	recorded, ok := manifest.Find(c.provider.Info().ID, chapter.Volume().Manga().Info().ID, chapter.Info(), options.Format)
+	if !ok {
+		return existsFunc, mangaDir, "", nil
+	}
+	recordedPath := filepath.Join(mangaDir, filepath.FromSlash(recorded.Path))
+
+	return func(path string) (bool, error) {
+		if path != chapterPath {
+			return existsFunc(path)
+		}
+		size, _, err := chapterStat(c.options.FS, recordedPath, recorded.Format)
+		if errors.Is(err, iofs.ErrNotExist) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return size == recorded.Size, nil
+	}, mangaDir, recordedPath, nil
+}
+
+// recordManifest sets the written chapter to the manifest of the manga directory.
+func (c *Client) recordManifest(
+	chapter mangadata.Chapter,
+	downChap *metadata.DownloadedChapter,
+	mangaDir string,
+	format Format,
+	entry ManifestChapter,
+) error {
+	path := downChap.Path()
+	rel, err := filepath.Rel(mangaDir, path)
+	if err != nil {
+		return err
+	}
+	sum, size, err := chapterChecksum(c.options.FS, path, format)
+	if err != nil {
+		return err
+	}
+
+	info := chapter.Info()
+	entry.ProviderID = c.provider.Info().ID
+	entry.MangaID = chapter.Volume().Manga().Info().ID
+	entry.URL = info.URL
+	entry.Number = info.Number
+	entry.Title = info.Title
+	entry.ScanlationGroup = info.ScanlationGroup
+	entry.Path = filepath.ToSlash(rel)
+	entry.Format = format
+	entry.Size = size
+	entry.SHA256 = sum
+	entry.DownloadedAt = time.Now()
+
+	c.logger.Log("recording chapter %q in %s", rel, FilenameManifest)
+	return updateManifest(c.options.FS, mangaDir, c.options.ModeFile, func(manifest *Manifest) {
+		manifest.Set(entry)
+	})
+}
+
 // downloadChapterWithMetadata prepares the chapter and its metadata
 // to be downloaded, as well as downloading metadata such as
 // the series.json file and cover/banner images, if any.
@@ -72,30 +205,16 @@ func (c *Client) downloadChapterWithMetadata(
 	chapter mangadata.Chapter,
 	options DownloadOptions,
 	existsFunc func(string) (bool, error),
+	entry *ManifestChapter,
 ) (*metadata.DownloadedChapter, error) {
-	directory := options.Directory
+	directory, mangaDir := c.chapterDirs(c.provider.Info(), chapter, options)
 
 	var (
-		seriesJSONDir = directory
-		coverDir      = directory
-		bannerDir     = directory
+		seriesJSONDir = mangaDir
+		coverDir      = mangaDir
+		bannerDir     = mangaDir
 	)
 
-	if options.CreateProviderDir {
-		directory = filepath.Join(directory, c.ProviderName(c.provider.Info()))
-	}
-
-	if options.CreateMangaDir {
-		directory = filepath.Join(directory, c.MangaName(chapter.Volume().Manga()))
-		seriesJSONDir = directory
-		coverDir = directory
-		bannerDir = directory
-	}
-
-	if options.CreateVolumeDir {
-		directory = filepath.Join(directory, c.VolumeName(chapter.Volume()))
-	}
-
 	err := c.options.FS.MkdirAll(directory, c.options.ModeDir)
 	if err != nil {
 		return nil, err
@@ -118,13 +237,13 @@ func (c *Client) downloadChapterWithMetadata(
 		Directory:          directory,
 		ChapterStatus:      metadata.DownloadStatusExists,
 		SeriesJSONStatus:   metadata.DownloadStatusSkip,
-		ComicInfoXMLStatus: metadata.DownloadStatusSkip, // only CBZ writes it
+		ComicInfoXMLStatus: metadata.DownloadStatusSkip, // only comic book archives write it
 		CoverStatus:        metadata.DownloadStatusSkip,
 		BannerStatus:       metadata.DownloadStatusSkip,
 	}
 
 	if !chapterExists || !options.SkipIfExists {
-		ciXmlStatus, err := c.downloadChapter(ctx, chapter, chapterPath, options)
+		ciXmlStatus, err := c.downloadChapter(ctx, chapter, chapterPath, options, downChap, entry)
 		if err != nil {
 			return nil, err
 		}
@@ -225,42 +344,122 @@ func (c *Client) downloadChapterWithMetadata(
 	return downChap, nil
 }
 
+// chapterDirs returns the directory the chapter is written to and the directory
+// of the manga files (series.json, cover and banner), for the given options.
+func (c *Client) chapterDirs(
+	provider ProviderInfo,
+	chapter mangadata.Chapter,
+	options DownloadOptions,
+) (string, string) {
+	directory := options.Directory
+	mangaDir := directory
+
+	if options.CreateProviderDir {
+		directory = filepath.Join(directory, c.options.ProviderName(provider))
+	}
+
+	if options.CreateMangaDir {
+		directory = filepath.Join(directory, c.options.MangaName(provider, chapter.Volume().Manga()))
+		mangaDir = directory
+	}
+
+	if options.CreateVolumeDir {
+		directory = filepath.Join(directory, c.options.VolumeName(provider, chapter.Volume()))
+	}
+
+	return directory, mangaDir
+}
+
 // downloadChapter is a wrapper of DownloadPagesInBatch which wraps the
 // pages in the desired format to write to disk.
+//
+// The images size stats are set to the downloaded chapter, and
+// the page hashes to the manifest entry if not nil.
 func (c *Client) downloadChapter(
 	ctx context.Context,
 	chapter mangadata.Chapter,
 	path string,
 	options DownloadOptions,
+	downChap *metadata.DownloadedChapter,
+	entry *ManifestChapter,
 ) (metadata.DownloadStatus, error) {
 	pages, err := c.ChapterPages(ctx, chapter)
 	if err != nil {
 		return "", err
 	}
+	if entry != nil {
+		entry.PageHashes = pageHashes(pages)
+	}
 
 	downloadedPages, err := c.DownloadPagesInBatch(ctx, pages)
 	if err != nil {
 		return "", err
 	}
 
-	for _, page := range downloadedPages {
-		select {
-		case <-ctx.Done():
-			return "", ctx.Err()
-		default:
+	pipeline, err := options.imagePipeline()
+	if err != nil {
+		return "", err
+	}
+	originalSize := imagesSize(downloadedPages)
+	if pipeline != nil {
+		if err := checkDecodable(downloadedPages); err != nil {
+			return "", err
 		}
-
-		image, err := options.ImageTransformer(page.Image())
+		c.logger.Log("applying image pipeline to %d pages", len(downloadedPages))
+		downloadedPages, err = pipeline.Run(ctx, downloadedPages)
 		if err != nil {
 			return "", err
 		}
+	}
+	downChap.ImagesSize = imagesSize(downloadedPages)
+	downChap.BytesSaved = originalSize - downChap.ImagesSize
+	if downChap.BytesSaved != 0 {
+		c.logger.Log("image pipeline saved %d bytes (%d -> %d)", downChap.BytesSaved, originalSize, downChap.ImagesSize)
+	}
 
-		page.SetImage(image)
+	extras := chapterExtras{
+		comicInfoXMLOptions: options.ComicInfoXMLOptions,
+		pdfOptions:          options.PDFOptions,
+	}
+	// the ComicInfo.xml is also used for the PDF document info
+	needsComicInfoXML := options.Format.IsComicBook() && options.WriteComicInfoXML ||
+		options.Format == FormatPDF && options.PDFOptions.WriteMetadata
+	if needsComicInfoXML && metadata.Validate(chapter.Volume().Manga().Metadata()) == nil {
+		mangaChapter := chapter.Info()
+		metaChapter := metadata.Chapter{
+			Title:           mangaChapter.Title,
+			URL:             mangaChapter.URL,
+			Number:          mangaChapter.Number,
+			Date:            mangaChapter.Date,
+			ScanlationGroup: mangaChapter.ScanlationGroup,
+			Pages:           len(downloadedPages),
+		}
+		ciXML, err := c.getComicInfoXML(chapter, metaChapter)
+		if err != nil && options.Strict {
+			return "", err
+		}
+		extras.comicInfoXML = &ciXML
+	}
+	if options.Format == FormatPDF {
+		extras.pdfSections = []pdfSection{{title: chapterTitle(chapter)}}
 	}
 
-	// Only CBZ writes the ComicInfo.xml, so by default it's skipped
-	ciXmlStatusSkip := metadata.DownloadStatusSkip
-	switch options.Format {
+	return c.writeChapter(downloadedPages, path, options.Format, extras)
+}
+
+// writeChapter writes the pages in the given format to path.
+//
+// The ComicInfo.xml is only written for comic book formats (see Format.IsComicBook), if not nil.
+// Returns the ComicInfo.xml status.
+func (c *Client) writeChapter(
+	pages []mangadata.PageWithImage,
+	path string,
+	format Format,
+	extras chapterExtras,
+) (metadata.DownloadStatus, error) {
+	// Only comic book archives write the ComicInfo.xml, so by default it's skipped
+	ciXmlStatus := metadata.DownloadStatusSkip
+	switch format {
 	case FormatPDF:
 		file, err := c.options.FS.Create(path)
 		if err != nil {
@@ -268,7 +467,7 @@ func (c *Client) downloadChapter(
 		}
 		defer file.Close()
 
-		return ciXmlStatusSkip, c.savePDF(downloadedPages, file)
+		return ciXmlStatus, c.savePDF(pages, file, extras)
 	case FormatTAR:
 		file, err := c.options.FS.Create(path)
 		if err != nil {
@@ -276,7 +475,7 @@ func (c *Client) downloadChapter(
 		}
 		defer file.Close()
 
-		return ciXmlStatusSkip, c.saveTAR(downloadedPages, file)
+		return ciXmlStatus, c.saveTAR(pages, file)
 	case FormatTARGZ:
 		file, err := c.options.FS.Create(path)
 		if err != nil {
@@ -284,7 +483,7 @@ func (c *Client) downloadChapter(
 		}
 		defer file.Close()
 
-		return ciXmlStatusSkip, c.saveTARGZ(downloadedPages, file)
+		return ciXmlStatus, c.saveTARGZ(pages, file)
 	case FormatZIP:
 		file, err := c.options.FS.Create(path)
 		if err != nil {
@@ -292,24 +491,13 @@ func (c *Client) downloadChapter(
 		}
 		defer file.Close()
 
-		return ciXmlStatusSkip, c.saveZIP(downloadedPages, file)
-	case FormatCBZ:
-		var comicInfoXML *metadata.ComicInfoXML
-		if options.WriteComicInfoXML && metadata.Validate(chapter.Volume().Manga().Metadata()) == nil {
-			mangaChapter := chapter.Info()
-			metaChapter := metadata.Chapter{
-				Title:           mangaChapter.Title,
-				URL:             mangaChapter.URL,
-				Number:          mangaChapter.Number,
-				Date:            mangaChapter.Date,
-				ScanlationGroup: mangaChapter.ScanlationGroup,
-				Pages:           len(downloadedPages),
-			}
-			ciXML, err := c.getComicInfoXML(chapter, metaChapter)
-			if err != nil && options.Strict {
-				return "", err
-			}
-			comicInfoXML = &ciXML
+		return ciXmlStatus, c.saveZIP(pages, file)
+	case FormatCBZ, FormatCBT, FormatCB7:
+		comicInfoXML := extras.comicInfoXML
+		if comicInfoXML != nil {
+			// the page count could've changed by the image pipeline
+			comicInfoXML.PageCount = len(pages)
+			comicInfoXML.Pages = comicInfoPages(pages)
 		}
 
 		file, err := c.options.FS.Create(path)
@@ -318,13 +506,20 @@ func (c *Client) downloadChapter(
 		}
 		defer file.Close()
 
-		return c.saveCBZ(downloadedPages, file, comicInfoXML, options.ComicInfoXMLOptions)
+		switch format {
+		case FormatCBT:
+			return c.saveCBT(pages, file, comicInfoXML, extras.comicInfoXMLOptions)
+		case FormatCB7:
+			return c.saveCB7(pages, file, comicInfoXML, extras.comicInfoXMLOptions)
+		default:
+			return c.saveCBZ(pages, file, comicInfoXML, extras.comicInfoXMLOptions)
+		}
 	case FormatImages:
 		if err := c.options.FS.MkdirAll(path, c.options.ModeDir); err != nil {
 			return "", err
 		}
 
-		for i, page := range downloadedPages {
+		for i, page := range pages {
 			name := fmt.Sprintf("%04d%s", i+1, page.Extension())
 			err := afero.WriteFile(
 				c.options.FS,
@@ -337,7 +532,7 @@ func (c *Client) downloadChapter(
 			}
 		}
 
-		return ciXmlStatusSkip, nil
+		return ciXmlStatus, nil
 	default:
 		// format validation was done before
 		panic("unreachable")
@@ -384,21 +579,68 @@ func (c *Client) DownloadPagesInBatch(
 }
 
 // DownloadPage downloads a page contents (image).
+//
+// The contents are checked to be a valid image (unless
+// ClientOptions.SkipPageValidation). If the download fails or the contents
+// are invalid, the page is downloaded again up to ClientOptions.PageRetries
+// times with an increasing delay, after that the last error is returned (a
+// *PageError for invalid contents). If the Page extension doesn't match
+// the image contents, the resulting page reports the correct one.
 func (c *Client) DownloadPage(
 	ctx context.Context,
 	page mangadata.Page,
 ) (mangadata.PageWithImage, error) {
 	if withImage, ok := page.(mangadata.PageWithImage); ok {
-		return withImage, nil
+		if c.options.SkipPageValidation {
+			return withImage, nil
+		}
+		return c.checkPage(withImage, withImage.Image())
 	}
 
-	image, err := c.provider.GetPageImage(ctx, page)
-	if err != nil {
-		return nil, err
+	var err error
+	for attempt := 0; attempt <= c.options.PageRetries; attempt++ {
+		if attempt > 0 {
+			delay := c.options.PageRetryDelay << (attempt - 1)
+			c.logger.Log("page %q: retrying download in %s (%d/%d): %s", page, delay, attempt, c.options.PageRetries, err.Error())
+			if err := sleep(ctx, delay); err != nil {
+				return nil, err
+			}
+		}
+
+		var image []byte
+		image, err = c.provider.GetPageImage(ctx, page)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			continue
+		}
+		if c.options.SkipPageValidation {
+			return &pageWithImage{Page: page, image: image}, nil
+		}
+
+		var downloaded mangadata.PageWithImage
+		downloaded, err = c.checkPage(page, image)
+		if err == nil {
+			return downloaded, nil
+		}
 	}
+	return nil, err
+}
 
-	return &pageWithImage{
-		Page:  page,
-		image: image,
-	}, nil
+// sleep waits for the duration or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
@@ -0,0 +1,298 @@
+package libmangal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/luevano/libmangal/imaging"
+	"github.com/luevano/libmangal/mangadata"
+	"github.com/luevano/libmangal/metadata"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// PDFOptions configures the PDF documents.
+type PDFOptions struct {
+	// PageSize is the paper size of every page (e.g. A4, A5, Letter),
+	// the images are scaled to fit and centered in the page.
+	//
+	// If empty, each page has the size of its image.
+	PageSize string
+
+	// WriteMetadata fills the document info (title, author, subject and
+	// keywords) from the manga and chapter metadata.
+	WriteMetadata bool
+
+	// Outline adds a bookmark (outline entry) per chapter.
+	Outline bool
+
+	// RightToLeft sets the reading direction viewer hint to right-to-left.
+	RightToLeft bool
+
+	// JPEGQuality re-compresses the images as JPEG with the given
+	// quality (1-100), images are only replaced if they get smaller.
+	//
+	// Zero keeps the images as they are.
+	JPEGQuality int
+}
+
+// DefaultPDFOptions constructs default PDFOptions.
+func DefaultPDFOptions() PDFOptions {
+	return PDFOptions{
+		PageSize:      "",
+		WriteMetadata: true,
+		Outline:       true,
+		RightToLeft:   false,
+		JPEGQuality:   0,
+	}
+}
+
+// pdfSection is a chapter inside the PDF document, used for the outline.
+type pdfSection struct {
+	title string
+	// index of the first page of the section
+	start int
+}
+
+// chapterExtras are the optional data written along
+// the pages of a chapter, depending on the format.
+type chapterExtras struct {
+	// comicInfoXML is written to CBZ archives and used
+	// as the document info of PDF documents.
+	comicInfoXML        *metadata.ComicInfoXML
+	comicInfoXMLOptions metadata.ComicInfoXMLOptions
+
+	pdfOptions  PDFOptions
+	pdfSections []pdfSection
+}
+
+// savePDF saves pages in FormatPDF
+func (c *Client) savePDF(
+	pages []mangadata.PageWithImage,
+	out io.Writer,
+	extras chapterExtras,
+) error {
+	c.logger.Log("saving %d pages as PDF", len(pages))
+	options := extras.pdfOptions
+
+	// not using model.IMPORTIMAGES, as it drops the outline when writing
+	conf := model.NewDefaultConfiguration()
+
+	imp := pdfcpu.DefaultImportConfig()
+	if options.PageSize != "" {
+		dim, ok := types.PaperSize[options.PageSize]
+		if !ok {
+			return fmt.Errorf("unknown PDF page size %q", options.PageSize)
+		}
+		imp.PageDim = dim
+		imp.PageSize = options.PageSize
+		imp.UserDim = true
+		imp.Pos = types.Center
+		imp.Scale = 1
+	}
+
+	ctx, err := pdfcpu.CreateContextWithXRefTable(conf, imp.PageDim)
+	if err != nil {
+		return err
+	}
+	pagesIndRef, err := ctx.Pages()
+	if err != nil {
+		return err
+	}
+	pagesDict, err := ctx.DereferenceDict(*pagesIndRef)
+	if err != nil {
+		return err
+	}
+
+	for _, page := range pages {
+		contents := page.Image()
+		if options.JPEGQuality > 0 {
+			contents, err = recompressJPEG(contents, options.JPEGQuality)
+			if err != nil {
+				return fmt.Errorf("recompressing page %q: %w", page, err)
+			}
+		}
+
+		indRef, err := pdfcpu.NewPageForImage(ctx.XRefTable, bytes.NewReader(contents), pagesIndRef, imp)
+		if err != nil {
+			return fmt.Errorf("adding page %q: %w", page, err)
+		}
+		if err := ctx.SetValid(*indRef); err != nil {
+			return err
+		}
+		if err := model.AppendPageTree(indRef, 1, pagesDict); err != nil {
+			return err
+		}
+		ctx.PageCount++
+	}
+
+	if options.WriteMetadata && extras.comicInfoXML != nil {
+		if err := setPDFInfo(ctx, extras.comicInfoXML); err != nil {
+			return err
+		}
+	}
+
+	if options.Outline && len(extras.pdfSections) > 0 {
+		bookmarks := make([]pdfcpu.Bookmark, 0, len(extras.pdfSections))
+		seen := make(map[string]int)
+		for _, section := range extras.pdfSections {
+			if section.start >= len(pages) {
+				continue
+			}
+			// titles are used as destination names, must be unique
+			title := section.title
+			seen[title]++
+			if n := seen[title]; n > 1 {
+				title = fmt.Sprintf("%s (%d)", title, n)
+			}
+			bookmarks = append(bookmarks, pdfcpu.Bookmark{
+				Title:    title,
+				PageFrom: section.start + 1,
+			})
+		}
+		if err := pdfcpu.AddBookmarks(ctx, bookmarks, true); err != nil {
+			return err
+		}
+	}
+
+	if options.RightToLeft {
+		root, err := ctx.Catalog()
+		if err != nil {
+			return err
+		}
+		root["ViewerPreferences"] = types.Dict{"Direction": types.Name("R2L")}
+	}
+
+	return api.Write(ctx, out, conf)
+}
+
+// setPDFInfo sets the document info dictionary from the ComicInfo.xml.
+func setPDFInfo(ctx *model.Context, comicInfoXML *metadata.ComicInfoXML) error {
+	title := comicInfoXML.Title
+	switch series := comicInfoXML.Series; {
+	case series == "" || series == title:
+	case title == "":
+		title = series
+	default:
+		title = series + " - " + title
+	}
+
+	info := types.NewDict()
+	for key, value := range map[string]string{
+		"Title":    title,
+		"Author":   strings.Join(slices.Concat(comicInfoXML.Writers, comicInfoXML.Pencillers), ", "),
+		"Subject":  comicInfoXML.Summary,
+		"Keywords": strings.Join(slices.Concat(comicInfoXML.Genres, comicInfoXML.Tags), ", "),
+		"Creator":  "libmangal",
+	} {
+		if value == "" {
+			continue
+		}
+		escaped, err := types.EscapeUTF16String(value)
+		if err != nil {
+			return err
+		}
+		info.InsertString(key, *escaped)
+	}
+
+	indRef, err := ctx.IndRefForNewObject(info)
+	if err != nil {
+		return err
+	}
+	ctx.Info = indRef
+	return nil
+}
+
+// recompressJPEG encodes the image as JPEG, only if it gets smaller.
+func recompressJPEG(contents []byte, quality int) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(contents))
+	if err != nil {
+		return nil, err
+	}
+
+	recompressed, err := imaging.Encode(img, imaging.FormatJPEG, imaging.EncodeOptions{Quality: quality})
+	if err != nil {
+		return nil, err
+	}
+	if len(recompressed) >= len(contents) {
+		return contents, nil
+	}
+	return recompressed, nil
+}
+
+// BundlePDF writes the already downloaded chapters (in any Format) into a
+// single PDF document at path, e.g. to bundle the chapters of a volume.
+//
+// Each chapter gets an outline entry titled after its ComicInfo.xml title
+// (if any) or its file name. The document info is taken from the
+// ComicInfo.xml of the first chapter that has one. A page that can't be
+// read or is not an image fails with a *PageError.
+func (c *Client) BundlePDF(
+	ctx context.Context,
+	path string,
+	chapters []string,
+	options PDFOptions,
+) error {
+	if len(chapters) == 0 {
+		return fmt.Errorf("no chapters provided to bundle")
+	}
+
+	var (
+		pages  []mangadata.PageWithImage
+		extras = chapterExtras{pdfOptions: options}
+	)
+	for _, chapterPath := range chapters {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		format, err := formatFromPath(c.options.FS, chapterPath)
+		if err != nil {
+			return err
+		}
+		contents, err := readChapter(c.options.FS, chapterPath, format)
+		if err != nil {
+			return err
+		}
+
+		title := strings.TrimSuffix(filepath.Base(chapterPath), format.Extension())
+		if contents.comicInfoXML != nil {
+			if contents.comicInfoXML.Title != "" {
+				title = contents.comicInfoXML.Title
+			}
+			if extras.comicInfoXML == nil {
+				extras.comicInfoXML = contents.comicInfoXML
+			}
+		}
+		extras.pdfSections = append(extras.pdfSections, pdfSection{title: title, start: len(pages)})
+
+		for _, page := range contents.pages {
+			pages = append(pages, page)
+		}
+	}
+	if extras.comicInfoXML != nil {
+		// the title of the first chapter doesn't represent the bundle
+		bundleInfo := *extras.comicInfoXML
+		bundleInfo.Title = strings.TrimSuffix(filepath.Base(path), FormatPDF.Extension())
+		extras.comicInfoXML = &bundleInfo
+	}
+
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if _, err := c.writeChapter(pages, tmp, FormatPDF, extras); err != nil {
+		_ = c.options.FS.RemoveAll(tmp)
+		return err
+	}
+	if err := c.replace(tmp, path); err != nil {
+		_ = c.options.FS.RemoveAll(tmp)
+		return err
+	}
+	return nil
+}
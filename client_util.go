@@ -7,13 +7,13 @@ import (
 	"compress/gzip"
 	"context"
 	"fmt"
+	"image"
 	"io"
 	"net/http"
 	"time"
 
 	"github.com/luevano/libmangal/mangadata"
 	"github.com/luevano/libmangal/metadata"
-	"github.com/pdfcpu/pdfcpu/pkg/api"
 	"github.com/spf13/afero"
 )
 
@@ -30,6 +30,18 @@ var _ mangadata.PageWithImage = (*pageWithImage)(nil)
 type pageWithImage struct {
 	mangadata.Page
 	image []byte
+
+	// extension overrides the Page extension when
+	// it doesn't match the actual image contents.
+	extension string
+}
+
+// Extension gets the image extension of this page.
+func (p *pageWithImage) Extension() string {
+	if p.extension != "" {
+		return p.extension
+	}
+	return p.Page.Extension()
 }
 
 // Image gets the image contents.
@@ -40,11 +52,29 @@ func (p *pageWithImage) Image() []byte {
 	return p.image
 }
 
-// SetImage sets the image contents. This is used by DownloadOptions.ImageTransformer.
+// SetImage sets the image contents.
 func (p *pageWithImage) SetImage(newImage []byte) {
 	p.image = newImage
 }
 
+// chapterTitle is the title of the chapter, or its number if it has none.
+func chapterTitle(chapter mangadata.Chapter) string {
+	info := chapter.Info()
+	if info.Title != "" {
+		return info.Title
+	}
+	return fmt.Sprintf("Chapter %v", info.Number)
+}
+
+// imagesSize is the total size in bytes of the page images.
+func imagesSize(pages []mangadata.PageWithImage) int64 {
+	var size int64
+	for _, page := range pages {
+		size += int64(len(page.Image()))
+	}
+	return size
+}
+
 // getComicInfoXML gets the ComicInfoXML for the chapter.
 //
 // It tries to check if chapter implements ChapterWithComicInfoXML
@@ -69,20 +99,35 @@ func (c *Client) getComicInfoXML(
 	return metadata.ToComicInfoXML(mangaChapter.Volume().Manga().Metadata(), metaChapter), nil
 }
 
-// savePDF saves pages in FormatPDF
-func (c *Client) savePDF(
-	pages []mangadata.PageWithImage,
-	out io.Writer,
-) error {
-	c.logger.Log("saving %d pages as PDF", len(pages))
+// doublePager is a page that knows if it contains a double-page spread.
+//
+// Implemented by the pages resulting from an imaging.Pipeline.
+type doublePager interface {
+	DoublePage() bool
+}
 
-	// convert to readers
-	images := make([]io.Reader, len(pages))
+// comicInfoPages builds the ComicInfoXML page entries for the pages.
+func comicInfoPages(pages []mangadata.PageWithImage) []metadata.ComicInfoPage {
+	comicPages := make([]metadata.ComicInfoPage, len(pages))
 	for i, page := range pages {
-		images[i] = bytes.NewReader(page.Image())
+		comicPage := metadata.ComicInfoPage{
+			Image:     i,
+			Type:      metadata.ComicPageTypeStory,
+			ImageSize: len(page.Image()),
+		}
+		if i == 0 {
+			comicPage.Type = metadata.ComicPageTypeFrontCover
+		}
+		if config, _, err := image.DecodeConfig(bytes.NewReader(page.Image())); err == nil {
+			comicPage.ImageWidth = config.Width
+			comicPage.ImageHeight = config.Height
+		}
+		if withSpread, ok := page.(doublePager); ok {
+			comicPage.DoublePage = withSpread.DoublePage()
+		}
+		comicPages[i] = comicPage
 	}
-
-	return api.ImportImages(nil, out, images, nil, nil)
+	return comicPages
 }
 
 // saveCBZ saves pages in FormatCBZ
@@ -95,8 +140,6 @@ func (c *Client) saveCBZ(
 	c.logger.Log("saving %d pages as CBZ", len(pages))
 
 	zipWriter := zip.NewWriter(out)
-	defer zipWriter.Close()
-
 	for i, page := range pages {
 		writer, err := zipWriter.CreateHeader(&zip.FileHeader{
 			Name:     fmt.Sprintf("%04d%s", i+1, page.Extension()),
@@ -108,19 +151,16 @@ func (c *Client) saveCBZ(
 		}
 
 		_, err = writer.Write(page.Image())
-		if err != nil {
-			return "", nil
-		}
-	}
-
-	ciXmlStatus := metadata.DownloadStatusMissingMetadata
-	if comicInfoXml != nil {
-		ciXmlStatus = metadata.DownloadStatusNew
-		marshalled, err := comicInfoXml.Marshal(options)
 		if err != nil {
 			return "", err
 		}
+	}
 
+	ciXmlStatus, marshalled, err := marshalComicInfoXML(comicInfoXml, options)
+	if err != nil {
+		return "", err
+	}
+	if marshalled != nil {
 		writer, err := zipWriter.CreateHeader(&zip.FileHeader{
 			Name:     metadata.FilenameComicInfoXML,
 			Method:   zip.Store,
@@ -136,6 +176,101 @@ func (c *Client) saveCBZ(
 		}
 	}
 
+	// the central directory is written on close, a
+	// failed close leaves an unreadable archive
+	if err := zipWriter.Close(); err != nil {
+		return "", err
+	}
+
+	return ciXmlStatus, nil
+}
+
+// marshalComicInfoXML marshals the ComicInfo.xml to embed in a comic book archive.
+//
+// Returns nil contents with a missing metadata status if comicInfoXml is nil.
+func marshalComicInfoXML(
+	comicInfoXml *metadata.ComicInfoXML,
+	options metadata.ComicInfoXMLOptions,
+) (metadata.DownloadStatus, []byte, error) {
+	if comicInfoXml == nil {
+		return metadata.DownloadStatusMissingMetadata, nil, nil
+	}
+
+	marshalled, err := comicInfoXml.Marshal(options)
+	if err != nil {
+		return "", nil, err
+	}
+	return metadata.DownloadStatusNew, marshalled, nil
+}
+
+// saveCBT saves pages in FormatCBT
+func (c *Client) saveCBT(
+	pages []mangadata.PageWithImage,
+	out io.Writer,
+	comicInfoXml *metadata.ComicInfoXML,
+	options metadata.ComicInfoXMLOptions,
+) (metadata.DownloadStatus, error) {
+	c.logger.Log("saving %d pages as CBT", len(pages))
+
+	tarWriter := tar.NewWriter(out)
+	if err := c.writeTARPages(tarWriter, pages); err != nil {
+		return "", err
+	}
+
+	ciXmlStatus, marshalled, err := marshalComicInfoXML(comicInfoXml, options)
+	if err != nil {
+		return "", err
+	}
+	if marshalled != nil {
+		err = tarWriter.WriteHeader(&tar.Header{
+			Name:    metadata.FilenameComicInfoXML,
+			Size:    int64(len(marshalled)),
+			Mode:    int64(c.options.ModeFile),
+			ModTime: time.Now(),
+		})
+		if err != nil {
+			return "", err
+		}
+
+		_, err = tarWriter.Write(marshalled)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return "", err
+	}
+
+	return ciXmlStatus, nil
+}
+
+// saveCB7 saves pages in FormatCB7
+func (c *Client) saveCB7(
+	pages []mangadata.PageWithImage,
+	out io.Writer,
+	comicInfoXml *metadata.ComicInfoXML,
+	options metadata.ComicInfoXMLOptions,
+) (metadata.DownloadStatus, error) {
+	c.logger.Log("saving %d pages as CB7", len(pages))
+
+	sevenZipWriter := newSevenZipWriter(out)
+	for i, page := range pages {
+		sevenZipWriter.Add(fmt.Sprintf("%04d%s", i+1, page.Extension()), page.Image(), time.Now())
+	}
+
+	ciXmlStatus, marshalled, err := marshalComicInfoXML(comicInfoXml, options)
+	if err != nil {
+		return "", err
+	}
+	if marshalled != nil {
+		sevenZipWriter.Add(metadata.FilenameComicInfoXML, marshalled, time.Now())
+	}
+
+	if err := sevenZipWriter.Close(); err != nil {
+		return "", err
+	}
+
 	return ciXmlStatus, nil
 }
 
@@ -146,8 +281,18 @@ func (c *Client) saveTAR(
 	c.logger.Log("saving %d pages as TAR", len(pages))
 
 	tarWriter := tar.NewWriter(out)
-	defer tarWriter.Close()
+	if err := c.writeTARPages(tarWriter, pages); err != nil {
+		return err
+	}
 
+	return tarWriter.Close()
+}
+
+// writeTARPages writes the pages as entries of the TAR archive.
+func (c *Client) writeTARPages(
+	tarWriter *tar.Writer,
+	pages []mangadata.PageWithImage,
+) error {
 	for i, page := range pages {
 		image := page.Image()
 		err := tarWriter.WriteHeader(&tar.Header{
@@ -176,9 +321,11 @@ func (c *Client) saveTARGZ(
 	c.logger.Log("bundling TAR into GZIP")
 
 	gzipWriter := gzip.NewWriter(out)
-	defer gzipWriter.Close()
+	if err := c.saveTAR(pages, gzipWriter); err != nil {
+		return err
+	}
 
-	return c.saveTAR(pages, gzipWriter)
+	return gzipWriter.Close()
 }
 
 func (c *Client) saveZIP(
@@ -188,8 +335,6 @@ func (c *Client) saveZIP(
 	c.logger.Log("saving %d pages as ZIP", len(pages))
 
 	zipWriter := zip.NewWriter(out)
-	defer zipWriter.Close()
-
 	for i, page := range pages {
 		writer, err := zipWriter.CreateHeader(&zip.FileHeader{
 			Name:     fmt.Sprintf("%04d%s", i+1, page.Extension()),
@@ -206,7 +351,7 @@ func (c *Client) saveZIP(
 		}
 	}
 
-	return nil
+	return zipWriter.Close()
 }
 
 // downloadMangaImage will download image related to manga.
@@ -335,8 +480,6 @@ func (c *Client) writeSeriesJSON(
 // removeChapter will remove chapter at given path.
 //
 // Doesn't matter if it's a directory or a file.
-//
-// Currently unused.
 func (c *Client) removeChapter(chapterPath string) error {
 	c.logger.Log("removing %s", chapterPath)
 
@@ -25,6 +25,15 @@ const (
 
 	// FormatZIP save chapter images as zip archive
 	FormatZIP
+
+	// FormatCBT saves chapter as CBT archive.
+	// CBT stands for Comic Book Tar format.
+	FormatCBT
+
+	// FormatCB7 saves chapter as CB7 archive.
+	// CB7 stands for Comic Book 7z format,
+	// pages are stored without compression.
+	FormatCB7
 )
 
 // Extension returns extension of the format with the leading dot.
@@ -40,7 +49,22 @@ func (f Format) Extension() string {
 		return ".tar.gz"
 	case FormatZIP:
 		return ".zip"
+	case FormatCBT:
+		return ".cbt"
+	case FormatCB7:
+		return ".cb7"
 	default:
 		return ""
 	}
 }
+
+// IsComicBook returns true if the format is a comic book
+// archive (CBZ, CBT or CB7), which embed the ComicInfo.xml.
+func (f Format) IsComicBook() bool {
+	switch f {
+	case FormatCBZ, FormatCBT, FormatCB7:
+		return true
+	default:
+		return false
+	}
+}
@@ -8,6 +8,9 @@ require (
 	github.com/philippgille/gokv/syncmap v0.7.0
 	github.com/skratchdot/open-golang v0.0.0-20200116055534-eef842397966
 	github.com/spf13/afero v1.11.0
+	github.com/ulikunitz/xz v0.5.15
+	golang.org/x/crypto v0.25.0
+	golang.org/x/image v0.18.0
 	golang.org/x/mod v0.19.0
 	golang.org/x/sync v0.7.0
 )
@@ -21,7 +24,6 @@ require (
 	github.com/philippgille/gokv/util v0.7.0 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/rivo/uniseg v0.4.7 // indirect
-	golang.org/x/image v0.18.0 // indirect
 	golang.org/x/text v0.16.0 // indirect
 	gopkg.in/check.v1 v1.0.0-20190902080502-41f04d3bba15 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
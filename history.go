@@ -1,8 +1,14 @@
 package libmangal
 
+import "time"
+
+// HistoryEntry is a chapter read by the user.
 type HistoryEntry struct {
 	ProviderID    string
 	MangaID       string
 	VolumeNumber  int
 	ChapterNumber float64
+
+	// ReadAt is the last time the chapter was read, zero if unknown.
+	ReadAt time.Time
 }
@@ -0,0 +1,166 @@
+package imaging
+
+import (
+	"context"
+	"image"
+	"image/draw"
+)
+
+// CropOptions configures the Crop stage.
+type CropOptions struct {
+	// Tolerance is the maximum luminance difference (0-255) from the
+	// border color for a pixel to still be considered part of the border.
+	Tolerance uint8
+
+	// MaxCrop is the maximum fraction (0-0.5) of the width or height
+	// that may be cut from each side. If zero, 0.25 is used.
+	MaxCrop float64
+
+	// MinContentArea is the minimum fraction (0-1) of the original area
+	// the cropped image must keep. If it would be smaller (e.g. blank
+	// pages) the image is left untouched.
+	MinContentArea float64
+
+	// Padding in pixels kept around the content.
+	Padding int
+}
+
+// DefaultCropOptions constructs default CropOptions.
+func DefaultCropOptions() CropOptions {
+	return CropOptions{
+		Tolerance:      16,
+		MaxCrop:        0.25,
+		MinContentArea: 0.5,
+		Padding:        4,
+	}
+}
+
+// Crop trims uniform (white, black or any solid color) borders of the images.
+//
+// The border color is taken from the corners of the image and each
+// side is trimmed independently, so the result is deterministic.
+func Crop(options CropOptions) *PageStage {
+	return NewPageStage("crop", func(_ context.Context, img *Image) error {
+		rect := ContentBounds(img.Image, options)
+		if rect == img.Image.Bounds() {
+			return nil
+		}
+
+		img.SetImage(crop(img.Image, rect))
+		return nil
+	})
+}
+
+// ContentBounds returns the bounds of the image without its uniform
+// borders, following the given options.
+//
+// If nothing should be cropped the image bounds are returned.
+func ContentBounds(img image.Image, options CropOptions) image.Rectangle {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w < 3 || h < 3 {
+		return bounds
+	}
+
+	gray, ok := img.(*image.Gray)
+	if !ok {
+		gray = image.NewGray(bounds)
+		draw.Draw(gray, bounds, img, bounds.Min, draw.Src)
+	}
+
+	maxCrop := options.MaxCrop
+	if maxCrop <= 0 {
+		maxCrop = 0.25
+	}
+	maxCrop = min(maxCrop, 0.5)
+	maxX, maxY := int(float64(w)*maxCrop), int(float64(h)*maxCrop)
+
+	// use the color most corners agree on, falls back to top left
+	reference := borderColor(gray)
+	tolerance := int(options.Tolerance)
+	uniform := func(x0, y0, x1, y1 int) bool {
+		for y := y0; y < y1; y++ {
+			row := gray.Pix[gray.PixOffset(x0, y) : gray.PixOffset(x1-1, y)+1]
+			for _, v := range row {
+				if abs(int(v)-reference) > tolerance {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	// blank pages have no content to keep
+	if uniform(bounds.Min.X, bounds.Min.Y, bounds.Max.X, bounds.Max.Y) {
+		return bounds
+	}
+
+	// trimmed amount of each side
+	var top, bottom, left, right int
+	for top < maxY && uniform(bounds.Min.X, bounds.Min.Y+top, bounds.Max.X, bounds.Min.Y+top+1) {
+		top++
+	}
+	for bottom < maxY && uniform(bounds.Min.X, bounds.Max.Y-bottom-1, bounds.Max.X, bounds.Max.Y-bottom) {
+		bottom++
+	}
+	y0, y1 := bounds.Min.Y+top, bounds.Max.Y-bottom
+	for left < maxX && uniform(bounds.Min.X+left, y0, bounds.Min.X+left+1, y1) {
+		left++
+	}
+	for right < maxX && uniform(bounds.Max.X-right-1, y0, bounds.Max.X-right, y1) {
+		right++
+	}
+
+	top = max(top-options.Padding, 0)
+	bottom = max(bottom-options.Padding, 0)
+	left = max(left-options.Padding, 0)
+	right = max(right-options.Padding, 0)
+
+	rect := image.Rect(
+		bounds.Min.X+left,
+		bounds.Min.Y+top,
+		bounds.Max.X-right,
+		bounds.Max.Y-bottom,
+	)
+	if rect.Empty() {
+		return bounds
+	}
+
+	area := float64(rect.Dx()*rect.Dy()) / float64(w*h)
+	if area < options.MinContentArea {
+		return bounds
+	}
+	return rect
+}
+
+// borderColor returns the luminance most corners of the image share.
+func borderColor(gray *image.Gray) int {
+	b := gray.Bounds()
+	corners := [4]int{
+		int(gray.GrayAt(b.Min.X, b.Min.Y).Y),
+		int(gray.GrayAt(b.Max.X-1, b.Min.Y).Y),
+		int(gray.GrayAt(b.Min.X, b.Max.Y-1).Y),
+		int(gray.GrayAt(b.Max.X-1, b.Max.Y-1).Y),
+	}
+
+	best, bestCount := corners[0], 0
+	for _, c := range corners {
+		count := 0
+		for _, o := range corners {
+			if c == o {
+				count++
+			}
+		}
+		if count > bestCount {
+			best, bestCount = c, count
+		}
+	}
+	return best
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
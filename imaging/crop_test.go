@@ -0,0 +1,164 @@
+package imaging
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// grayPage is a 100x100 page of the background color with the content
+// rectangle filled with the foreground color.
+func grayPage(background, foreground uint8, content image.Rectangle) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, 100, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 100; x++ {
+			v := background
+			if (image.Point{X: x, Y: y}).In(content) {
+				v = foreground
+			}
+			img.SetGray(x, y, color.Gray{Y: v})
+		}
+	}
+	return img
+}
+
+func TestContentBounds(t *testing.T) {
+	exact := CropOptions{MaxCrop: 0.5}
+
+	// white page with a light gray stripe near the left border
+	stripe := grayPage(255, 0, image.Rect(10, 20, 80, 90))
+	for y := 0; y < 100; y++ {
+		for x := 2; x < 5; x++ {
+			stripe.SetGray(x, y, color.Gray{Y: 245})
+		}
+	}
+
+	// red content on black borders
+	rgba := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 100; x++ {
+			c := color.RGBA{A: 255}
+			if x >= 5 && x < 95 && y >= 30 && y < 70 {
+				c.R = 255
+			}
+			rgba.SetRGBA(x, y, c)
+		}
+	}
+
+	// no uniform border, every row and column differs
+	gradient := image.NewGray(image.Rect(0, 0, 100, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 100; x++ {
+			gradient.SetGray(x, y, color.Gray{Y: uint8(x + y)})
+		}
+	}
+
+	tests := []struct {
+		name    string
+		img     image.Image
+		options CropOptions
+		want    image.Rectangle
+	}{
+		{
+			name:    "white borders",
+			img:     grayPage(255, 0, image.Rect(10, 20, 80, 90)),
+			options: exact,
+			want:    image.Rect(10, 20, 80, 90),
+		},
+		{
+			name:    "black borders",
+			img:     grayPage(0, 200, image.Rect(1, 2, 97, 98)),
+			options: exact,
+			want:    image.Rect(1, 2, 97, 98),
+		},
+		{
+			name:    "rgba borders",
+			img:     rgba,
+			options: exact,
+			want:    image.Rect(5, 30, 95, 70),
+		},
+		{
+			name:    "padding",
+			img:     grayPage(255, 0, image.Rect(10, 20, 80, 99)),
+			options: CropOptions{MaxCrop: 0.5, Padding: 3},
+			want:    image.Rect(7, 17, 83, 100),
+		},
+		{
+			name:    "within tolerance",
+			img:     stripe,
+			options: CropOptions{MaxCrop: 0.5, Tolerance: 16},
+			want:    image.Rect(10, 20, 80, 90),
+		},
+		{
+			// the stripe spans all the rows, so they're not border either
+			name:    "out of tolerance",
+			img:     stripe,
+			options: CropOptions{MaxCrop: 0.5, Tolerance: 5},
+			want:    image.Rect(2, 0, 80, 100),
+		},
+		{
+			name:    "max crop",
+			img:     grayPage(255, 0, image.Rect(40, 40, 60, 60)),
+			options: CropOptions{MaxCrop: 0.1},
+			want:    image.Rect(10, 10, 90, 90),
+		},
+		{
+			name:    "min content area",
+			img:     grayPage(255, 0, image.Rect(40, 40, 60, 60)),
+			options: CropOptions{MaxCrop: 0.5, MinContentArea: 0.5},
+			want:    image.Rect(0, 0, 100, 100),
+		},
+		{
+			name:    "blank page",
+			img:     grayPage(255, 255, image.Rectangle{}),
+			options: exact,
+			want:    image.Rect(0, 0, 100, 100),
+		},
+		{
+			name:    "blank page within tolerance",
+			img:     grayPage(255, 250, image.Rect(10, 10, 90, 90)),
+			options: CropOptions{MaxCrop: 0.5, Tolerance: 16},
+			want:    image.Rect(0, 0, 100, 100),
+		},
+		{
+			name:    "no border",
+			img:     gradient,
+			options: exact,
+			want:    image.Rect(0, 0, 100, 100),
+		},
+		{
+			name:    "non zero origin",
+			img:     grayPage(255, 0, image.Rect(10, 20, 80, 90)).SubImage(image.Rect(5, 5, 95, 95)),
+			options: exact,
+			want:    image.Rect(10, 20, 80, 90),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ContentBounds(tt.img, tt.options)
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if again := ContentBounds(tt.img, tt.options); again != got {
+				t.Errorf("got %v on the second call, want %v", again, got)
+			}
+		})
+	}
+}
+
+func TestCrop(t *testing.T) {
+	images := []*Image{{Image: grayPage(255, 0, image.Rect(10, 20, 80, 90)), Format: FormatPNG}}
+	images, err := Crop(CropOptions{MaxCrop: 0.5}).Process(context.Background(), images)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bounds := images[0].Image.Bounds()
+	if bounds.Dx() != 70 || bounds.Dy() != 70 {
+		t.Errorf("cropped to %v, want 70x70", bounds.Size())
+	}
+	if v := color.GrayModel.Convert(images[0].Image.At(bounds.Min.X, bounds.Min.Y)).(color.Gray).Y; v != 0 {
+		t.Errorf("top left pixel is %d, want the content (0)", v)
+	}
+}
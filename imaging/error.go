@@ -0,0 +1,8 @@
+package imaging
+
+// Error is a general error for image processing.
+type Error string
+
+func (e Error) Error() string {
+	return "imaging: " + string(e)
+}
@@ -0,0 +1,373 @@
+// Package imaging is the image pipeline applied to the pages of a chapter
+// before they're written to disk.
+//
+// Each Stage gets the decoded page images of the chapter (with their
+// Page and Chapter) and can modify them, change the output format, or
+// even change the amount of pages.
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/luevano/libmangal/mangadata"
+
+	// register decoders
+	_ "golang.org/x/image/webp"
+)
+
+// Format is the encoding format of an image.
+type Format string
+
+// Formats with built in decoders and encoders, WebP
+// is only encoded losslessly (see EncodeOptions.NearLossless).
+const (
+	FormatJPEG Format = "jpeg"
+	FormatPNG  Format = "png"
+	FormatGIF  Format = "gif"
+	FormatWebP Format = "webp"
+)
+
+// Extension returns the extension of the format with the leading dot.
+func (f Format) Extension() string {
+	switch f {
+	case FormatJPEG:
+		return ".jpg"
+	case "":
+		return ""
+	default:
+		return "." + string(f)
+	}
+}
+
+// FormatFromExtension returns the format of the file extension
+// (with the leading dot, case insensitive).
+func FormatFromExtension(ext string) (Format, bool) {
+	switch ext = strings.ToLower(ext); ext {
+	case ".jpg", ".jpeg", ".jpe", ".jfif":
+		return FormatJPEG, true
+	case ".png", ".gif", ".webp", ".avif", ".jxl", ".bmp":
+		return Format(ext[1:]), true
+	default:
+		return "", false
+	}
+}
+
+// Lossless returns true if the format only supports lossless encoding.
+func (f Format) Lossless() bool {
+	switch f {
+	case FormatPNG, FormatGIF, FormatBMP:
+		return true
+	default:
+		return false
+	}
+}
+
+// EncodeOptions tweaks the image encoding.
+//
+// Not all options apply to all formats.
+type EncodeOptions struct {
+	// Quality from 1 to 100 of the lossy encoders (JPEG).
+	// Zero means the encoder default.
+	//
+	// The built in WebP encoder is lossless only, so Reencode rejects
+	// a Quality lower than 100 for WebP (see NearLossless).
+	Quality int
+
+	// Progressive encoding, only for JPEG.
+	Progressive bool
+
+	// MaxSize in bytes of the encoded image. Zero means no limit.
+	//
+	// The quality is lowered until the image fits, if
+	// it can't fit the smallest encoding is used.
+	MaxSize int
+
+	// Lossless encoding, only for formats that support it (WebP).
+	//
+	// Disables NearLossless, the image is encoded exactly.
+	Lossless bool
+
+	// NearLossless is the number of lower bits (up to 4) of each color
+	// channel rounded off before the lossless WebP encoding, for smaller
+	// files. Zero is exactly lossless.
+	NearLossless int
+
+	// LosslessSources encodes losslessly the images whose source
+	// is lossless (PNG, GIF, BMP), if the format supports it.
+	LosslessSources bool
+
+	// KeepSmaller keeps the original contents (and format) if they're
+	// smaller than the encoded image. Only applies to images that
+	// were not modified other than changing the format.
+	KeepSmaller bool
+}
+
+// minQuality is the lowest quality tried to fit in EncodeOptions.MaxSize.
+const minQuality = 20
+
+// Encoder encodes the image into the writer.
+type Encoder func(w io.Writer, img image.Image, options EncodeOptions) error
+
+var (
+	encodersMu sync.RWMutex
+	// losslessOnly are the formats whose encoder has no lossy mode
+	losslessOnly = map[Format]bool{FormatWebP: true}
+	encoders     = map[Format]Encoder{
+		FormatJPEG: func(w io.Writer, img image.Image, options EncodeOptions) error {
+			quality := options.Quality
+			if quality == 0 {
+				quality = jpeg.DefaultQuality
+			}
+			if options.Progressive {
+				return encodeProgressiveJPEG(w, img, quality)
+			}
+			return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+		},
+		FormatPNG: func(w io.Writer, img image.Image, _ EncodeOptions) error {
+			return png.Encode(w, img)
+		},
+		FormatGIF: func(w io.Writer, img image.Image, _ EncodeOptions) error {
+			return gif.Encode(w, img, nil)
+		},
+		FormatWebP: encodeWebP,
+	}
+)
+
+// RegisterEncoder registers (or replaces) the encoder for the given format.
+//
+// There are no built in encoders for the formats that are only detected
+// (AVIF, JPEG XL and BMP), a decoder must also be registered with
+// image.RegisterFormat for their images to go through the Pipeline.
+//
+// Replacing the WebP encoder (e.g. with a lossy one) lifts the Quality
+// restriction of Reencode.
+func RegisterEncoder(format Format, encoder Encoder) {
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+	encoders[format] = encoder
+	delete(losslessOnly, format)
+}
+
+// CanEncode returns true if there is an encoder for the format.
+func CanEncode(format Format) bool {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+	_, ok := encoders[format]
+	return ok
+}
+
+// checkEncode returns an Error if the images can't be encoded in the
+// format as requested by the options.
+func checkEncode(format Format, options EncodeOptions) error {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+	if _, ok := encoders[format]; !ok {
+		return Error(fmt.Sprintf("image format %q can't be encoded", format))
+	}
+	if losslessOnly[format] && !options.Lossless && options.Quality > 0 && options.Quality < 100 {
+		return Error(fmt.Sprintf("image format %q can only be encoded losslessly, quality %d is not supported", format, options.Quality))
+	}
+	if options.NearLossless < 0 || options.NearLossless > 4 {
+		return Error(fmt.Sprintf("near-lossless bits must be between 0 and 4, got %d", options.NearLossless))
+	}
+	return nil
+}
+
+// Encode the image in the given format.
+func Encode(img image.Image, format Format, options EncodeOptions) ([]byte, error) {
+	encodersMu.RLock()
+	encoder, ok := encoders[format]
+	encodersMu.RUnlock()
+	if !ok {
+		return nil, Error(fmt.Sprintf("image format %q can't be encoded", format))
+	}
+
+	var buf bytes.Buffer
+	if err := encoder(&buf, img, options); err != nil {
+		return nil, err
+	}
+	if options.MaxSize <= 0 || buf.Len() <= options.MaxSize {
+		return buf.Bytes(), nil
+	}
+
+	// lower the quality until it fits, encoders without
+	// quality support produce the same output, stop early
+	smallest := buf.Bytes()
+	quality := options.Quality
+	if quality == 0 {
+		quality = jpeg.DefaultQuality
+	}
+	for quality > minQuality {
+		quality = max(quality-10, minQuality)
+		options.Quality = quality
+
+		var buf bytes.Buffer
+		if err := encoder(&buf, img, options); err != nil {
+			return nil, err
+		}
+		if buf.Len() >= len(smallest) {
+			break
+		}
+		smallest = buf.Bytes()
+		if len(smallest) <= options.MaxSize {
+			break
+		}
+	}
+	return smallest, nil
+}
+
+// Image is a page image going through the pipeline.
+type Image struct {
+	// Page the image belongs to.
+	Page mangadata.Page
+
+	// Image is the decoded image.
+	Image image.Image
+
+	// Format the image will be encoded to.
+	Format Format
+
+	// EncodeOptions used when encoding the image.
+	EncodeOptions EncodeOptions
+
+	// DoublePage is true if the image contains a double-page spread.
+	DoublePage bool
+
+	raw         []byte
+	rawFormat   Format
+	modified    bool
+	reencode    bool
+	originalExt string
+}
+
+// NewImage decodes the page image contents.
+func NewImage(page mangadata.Page, raw []byte) (*Image, error) {
+	img, format, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("decoding page %q image: %w", page, err)
+	}
+
+	return &Image{
+		Page:        page,
+		Image:       img,
+		Format:      Format(format),
+		raw:         raw,
+		rawFormat:   Format(format),
+		originalExt: page.Extension(),
+	}, nil
+}
+
+// Chapter the image belongs to.
+func (i *Image) Chapter() mangadata.Chapter {
+	return i.Page.Chapter()
+}
+
+// SourceFormat is the format of the original image contents.
+func (i *Image) SourceFormat() Format {
+	return i.rawFormat
+}
+
+// SourceSize is the size in bytes of the original image contents.
+func (i *Image) SourceSize() int {
+	return len(i.raw)
+}
+
+// SetImage replaces the decoded image, which will be encoded
+// again at the end of the pipeline.
+func (i *Image) SetImage(img image.Image) {
+	i.Image = img
+	i.modified = true
+}
+
+// Modified returns true if the image needs to be encoded again.
+func (i *Image) Modified() bool {
+	return i.modified || i.reencode || i.Format != i.rawFormat
+}
+
+// Extension is the extension of the resulting image.
+func (i *Image) Extension() string {
+	if !i.Modified() {
+		return i.sourceExtension()
+	}
+	return i.Format.Extension()
+}
+
+// sourceExtension is the extension of the original image contents.
+func (i *Image) sourceExtension() string {
+	if i.originalExt != "" {
+		return i.originalExt
+	}
+	return i.rawFormat.Extension()
+}
+
+// Clone returns a copy of the image for a different page,
+// useful for stages that split an image into multiple.
+func (i *Image) Clone(page mangadata.Page, img image.Image) *Image {
+	clone := *i
+	clone.Page = page
+	clone.SetImage(img)
+	return &clone
+}
+
+// encode the image if it was modified, else the raw contents are used.
+//
+// Returns the contents and their extension.
+func (i *Image) encode() ([]byte, string, error) {
+	if !i.Modified() {
+		return i.raw, i.Extension(), nil
+	}
+
+	options := i.EncodeOptions
+	if options.LosslessSources && i.rawFormat.Lossless() {
+		options.Lossless = true
+	}
+	data, err := Encode(i.Image, i.Format, options)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// the original is only equivalent if the pixels didn't change
+	if options.KeepSmaller && !i.modified && len(i.raw) > 0 && len(i.raw) <= len(data) {
+		return i.raw, i.sourceExtension(), nil
+	}
+	return data, i.Format.Extension(), nil
+}
+
+var _ mangadata.PageWithImage = (*page)(nil)
+
+// page is a mangadata.PageWithImage implementation
+// with the resulting image of the pipeline.
+type page struct {
+	mangadata.Page
+	image      []byte
+	extension  string
+	doublePage bool
+}
+
+// Extension gets the image extension of this page.
+func (p *page) Extension() string {
+	return p.extension
+}
+
+// DoublePage returns true if the image contains a double-page spread.
+func (p *page) DoublePage() bool {
+	return p.doublePage
+}
+
+// Image gets the image contents.
+func (p *page) Image() []byte {
+	return p.image
+}
+
+// SetImage sets the image contents.
+func (p *page) SetImage(newImage []byte) {
+	p.image = newImage
+}
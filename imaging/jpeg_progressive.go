@@ -0,0 +1,434 @@
+package imaging
+
+import (
+	"bufio"
+	"image"
+	"image/color"
+	"io"
+	"math"
+)
+
+// The standard library only encodes baseline JPEGs, this is a minimal
+// progressive JPEG encoder (spectral selection only, no successive
+// approximation) using the standard Huffman tables from the JPEG spec
+// (ITU T.81 Annex K). Chroma is not subsampled.
+//
+// Scan script: DC of all components, then AC 1-5 and AC 6-63 of each component.
+
+// zigzag maps the zig-zag order index to the natural order index.
+var zigzag = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// base quantization tables in natural order (Annex K.1)
+var baseQuant = [2][64]int{
+	{
+		16, 11, 10, 16, 24, 40, 51, 61,
+		12, 12, 14, 19, 26, 58, 60, 55,
+		14, 13, 16, 24, 40, 57, 69, 56,
+		14, 17, 22, 29, 51, 87, 80, 62,
+		18, 22, 37, 56, 68, 109, 103, 77,
+		24, 35, 55, 64, 81, 104, 113, 92,
+		49, 64, 78, 87, 103, 121, 120, 101,
+		72, 92, 95, 98, 112, 100, 103, 99,
+	},
+	{
+		17, 18, 24, 47, 99, 99, 99, 99,
+		18, 21, 26, 66, 99, 99, 99, 99,
+		24, 26, 56, 99, 99, 99, 99, 99,
+		47, 66, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+	},
+}
+
+type huffmanSpec struct {
+	count [16]byte
+	value []byte
+}
+
+// standard Huffman tables (Annex K.3): DC luma, AC luma, DC chroma, AC chroma
+var huffmanSpecs = [4]huffmanSpec{
+	{
+		[16]byte{0, 1, 5, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	{
+		[16]byte{0, 2, 1, 3, 3, 2, 4, 3, 5, 5, 4, 4, 0, 0, 1, 125},
+		[]byte{
+			0x01, 0x02, 0x03, 0x00, 0x04, 0x11, 0x05, 0x12,
+			0x21, 0x31, 0x41, 0x06, 0x13, 0x51, 0x61, 0x07,
+			0x22, 0x71, 0x14, 0x32, 0x81, 0x91, 0xa1, 0x08,
+			0x23, 0x42, 0xb1, 0xc1, 0x15, 0x52, 0xd1, 0xf0,
+			0x24, 0x33, 0x62, 0x72, 0x82, 0x09, 0x0a, 0x16,
+			0x17, 0x18, 0x19, 0x1a, 0x25, 0x26, 0x27, 0x28,
+			0x29, 0x2a, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39,
+			0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49,
+			0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59,
+			0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69,
+			0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79,
+			0x7a, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89,
+			0x8a, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98,
+			0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7,
+			0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6,
+			0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3, 0xc4, 0xc5,
+			0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2, 0xd3, 0xd4,
+			0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda, 0xe1, 0xe2,
+			0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9, 0xea,
+			0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+	{
+		[16]byte{0, 3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	{
+		[16]byte{0, 2, 1, 2, 4, 4, 3, 4, 7, 5, 4, 4, 0, 1, 2, 119},
+		[]byte{
+			0x00, 0x01, 0x02, 0x03, 0x11, 0x04, 0x05, 0x21,
+			0x31, 0x06, 0x12, 0x41, 0x51, 0x07, 0x61, 0x71,
+			0x13, 0x22, 0x32, 0x81, 0x08, 0x14, 0x42, 0x91,
+			0xa1, 0xb1, 0xc1, 0x09, 0x23, 0x33, 0x52, 0xf0,
+			0x15, 0x62, 0x72, 0xd1, 0x0a, 0x16, 0x24, 0x34,
+			0xe1, 0x25, 0xf1, 0x17, 0x18, 0x19, 0x1a, 0x26,
+			0x27, 0x28, 0x29, 0x2a, 0x35, 0x36, 0x37, 0x38,
+			0x39, 0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48,
+			0x49, 0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58,
+			0x59, 0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68,
+			0x69, 0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78,
+			0x79, 0x7a, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87,
+			0x88, 0x89, 0x8a, 0x92, 0x93, 0x94, 0x95, 0x96,
+			0x97, 0x98, 0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5,
+			0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4,
+			0xb5, 0xb6, 0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3,
+			0xc4, 0xc5, 0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2,
+			0xd3, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda,
+			0xe2, 0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9,
+			0xea, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+}
+
+// huffmanCode is the code and its length for each symbol.
+type huffmanCode struct {
+	code [256]uint32
+	size [256]uint8
+}
+
+var huffmanCodes = func() (codes [4]huffmanCode) {
+	for i, spec := range huffmanSpecs {
+		code, k := uint32(0), 0
+		for length := 1; length <= 16; length++ {
+			for n := 0; n < int(spec.count[length-1]); n++ {
+				symbol := spec.value[k]
+				codes[i].code[symbol] = code
+				codes[i].size[symbol] = uint8(length)
+				code++
+				k++
+			}
+			code <<= 1
+		}
+	}
+	return codes
+}()
+
+// dctCos[x][u] = cos((2x+1)uπ/16)
+var dctCos = func() (c [8][8]float64) {
+	for x := 0; x < 8; x++ {
+		for u := 0; u < 8; u++ {
+			c[x][u] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / 16)
+		}
+	}
+	return c
+}()
+
+type block [64]int32
+
+// bitWriter writes the entropy coded data with byte stuffing.
+type bitWriter struct {
+	w     *bufio.Writer
+	bits  uint32
+	nBits uint32
+	err   error
+}
+
+func (b *bitWriter) emit(bits, nBits uint32) {
+	if nBits == 0 {
+		return
+	}
+	nBits += b.nBits
+	bits <<= 32 - nBits
+	bits |= b.bits
+	for nBits >= 8 {
+		c := byte(bits >> 24)
+		b.writeByte(c)
+		if c == 0xff {
+			b.writeByte(0x00)
+		}
+		bits <<= 8
+		nBits -= 8
+	}
+	b.bits, b.nBits = bits, nBits
+}
+
+func (b *bitWriter) emitHuffman(table int, symbol byte) {
+	codes := &huffmanCodes[table]
+	b.emit(codes.code[symbol], uint32(codes.size[symbol]))
+}
+
+// emitValue writes the huffman symbol (run<<4 | size) and the value bits.
+func (b *bitWriter) emitValue(table int, run int, value int32) {
+	a, bits := value, value
+	if a < 0 {
+		a = -value
+		bits = value - 1
+	}
+	size := uint32(0)
+	for a > 0 {
+		size++
+		a >>= 1
+	}
+	b.emitHuffman(table, byte(run<<4)|byte(size))
+	if size > 0 {
+		b.emit(uint32(bits)&(1<<size-1), size)
+	}
+}
+
+// flush pads the remaining bits with ones.
+func (b *bitWriter) flush() {
+	b.emit(0x7f, 7)
+	b.bits, b.nBits = 0, 0
+}
+
+func (b *bitWriter) writeByte(c byte) {
+	if b.err == nil {
+		b.err = b.w.WriteByte(c)
+	}
+}
+
+func (b *bitWriter) write(p []byte) {
+	if b.err == nil {
+		_, b.err = b.w.Write(p)
+	}
+}
+
+func (b *bitWriter) marker(marker byte, payload []byte) {
+	n := len(payload) + 2
+	b.write([]byte{0xff, marker, byte(n >> 8), byte(n)})
+	b.write(payload)
+}
+
+// encodeProgressiveJPEG encodes the image as a progressive JPEG.
+func encodeProgressiveJPEG(w io.Writer, img image.Image, quality int) error {
+	if quality < 1 {
+		quality = 1
+	} else if quality > 100 {
+		quality = 100
+	}
+
+	// same scaling as the standard library
+	var scale int
+	if quality < 50 {
+		scale = 5000 / quality
+	} else {
+		scale = 200 - quality*2
+	}
+	var quant [2][64]int32
+	for i := range quant {
+		for j := 0; j < 64; j++ {
+			q := (baseQuant[i][j]*scale + 50) / 100
+			quant[i][j] = int32(min(max(q, 1), 255))
+		}
+	}
+
+	gray := isGray(img)
+	nComponents := 3
+	if gray {
+		nComponents = 1
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	bw, bh := (width+7)/8, (height+7)/8
+
+	// compute all the coefficients first, every scan needs them
+	coefficients := make([][]block, nComponents)
+	for c := range coefficients {
+		coefficients[c] = make([]block, bw*bh)
+	}
+	var planes [3][64]float64
+	for by := 0; by < bh; by++ {
+		for bx := 0; bx < bw; bx++ {
+			toPlanes(img, bounds.Min.X+bx*8, bounds.Min.Y+by*8, gray, &planes)
+			for c := 0; c < nComponents; c++ {
+				table := min(c, 1)
+				fdct(&planes[c], &quant[table], &coefficients[c][by*bw+bx])
+			}
+		}
+	}
+
+	b := &bitWriter{w: bufio.NewWriter(w)}
+
+	b.write([]byte{0xff, 0xd8}) // SOI
+
+	// DQT
+	for i := 0; i < min(nComponents, 2); i++ {
+		payload := make([]byte, 65)
+		payload[0] = byte(i)
+		for j := 0; j < 64; j++ {
+			payload[j+1] = byte(quant[i][zigzag[j]])
+		}
+		b.marker(0xdb, payload)
+	}
+
+	// SOF2
+	sof := []byte{8, byte(height >> 8), byte(height), byte(width >> 8), byte(width), byte(nComponents)}
+	for c := 0; c < nComponents; c++ {
+		sof = append(sof, byte(c+1), 0x11, byte(min(c, 1)))
+	}
+	b.marker(0xc2, sof)
+
+	// DHT
+	for i, spec := range huffmanSpecs {
+		if gray && i >= 2 {
+			break
+		}
+		class := byte(i%2) << 4 // 0 DC, 1 AC
+		id := byte(i / 2)
+		payload := append([]byte{class | id}, spec.count[:]...)
+		payload = append(payload, spec.value...)
+		b.marker(0xc4, payload)
+	}
+
+	// DC scan, interleaved
+	sos := []byte{byte(nComponents)}
+	for c := 0; c < nComponents; c++ {
+		table := byte(min(c, 1))
+		sos = append(sos, byte(c+1), table<<4)
+	}
+	b.marker(0xda, append(sos, 0, 0, 0))
+	prev := make([]int32, nComponents)
+	for i := 0; i < bw*bh; i++ {
+		for c := 0; c < nComponents; c++ {
+			dc := coefficients[c][i][0]
+			b.emitValue(2*min(c, 1), 0, dc-prev[c])
+			prev[c] = dc
+		}
+	}
+	b.flush()
+
+	// AC scans, one per component and band
+	for _, band := range [][2]int{{1, 5}, {6, 63}} {
+		for c := 0; c < nComponents; c++ {
+			table := byte(min(c, 1))
+			b.marker(0xda, []byte{1, byte(c + 1), table, byte(band[0]), byte(band[1]), 0})
+			for i := range coefficients[c] {
+				encodeACBand(b, 2*int(table)+1, &coefficients[c][i], band[0], band[1])
+			}
+			b.flush()
+		}
+	}
+
+	b.write([]byte{0xff, 0xd9}) // EOI
+	if b.err != nil {
+		return b.err
+	}
+	return b.w.Flush()
+}
+
+// encodeACBand encodes the zig-zag coefficients from ss to se,
+// each block ends with its own EOB (EOBRUN of 1).
+func encodeACBand(b *bitWriter, table int, blk *block, ss, se int) {
+	run := 0
+	for k := ss; k <= se; k++ {
+		v := blk[zigzag[k]]
+		if v == 0 {
+			run++
+			continue
+		}
+		for run > 15 {
+			b.emitHuffman(table, 0xf0)
+			run -= 16
+		}
+		b.emitValue(table, run, v)
+		run = 0
+	}
+	if run > 0 {
+		b.emitHuffman(table, 0x00)
+	}
+}
+
+// toPlanes converts the 8x8 block at x, y into level shifted
+// Y (and Cb, Cr) planes, edges are replicated.
+func toPlanes(img image.Image, x0, y0 int, gray bool, planes *[3][64]float64) {
+	bounds := img.Bounds()
+	for j := 0; j < 8; j++ {
+		y := min(y0+j, bounds.Max.Y-1)
+		for i := 0; i < 8; i++ {
+			x := min(x0+i, bounds.Max.X-1)
+			if gray {
+				g := color.GrayModel.Convert(img.At(x, y)).(color.Gray)
+				planes[0][j*8+i] = float64(g.Y) - 128
+				continue
+			}
+			r, g, bl, _ := img.At(x, y).RGBA()
+			yy, cb, cr := color.RGBToYCbCr(uint8(r>>8), uint8(g>>8), uint8(bl>>8))
+			planes[0][j*8+i] = float64(yy) - 128
+			planes[1][j*8+i] = float64(cb) - 128
+			planes[2][j*8+i] = float64(cr) - 128
+		}
+	}
+}
+
+// fdct computes the quantized forward DCT of the plane (natural order).
+func fdct(plane *[64]float64, quant *[64]int32, out *block) {
+	var tmp [64]float64
+	// rows
+	for y := 0; y < 8; y++ {
+		for u := 0; u < 8; u++ {
+			sum := 0.0
+			for x := 0; x < 8; x++ {
+				sum += plane[y*8+x] * dctCos[x][u]
+			}
+			tmp[y*8+u] = sum
+		}
+	}
+	// columns
+	for u := 0; u < 8; u++ {
+		for v := 0; v < 8; v++ {
+			sum := 0.0
+			for y := 0; y < 8; y++ {
+				sum += tmp[y*8+u] * dctCos[y][v]
+			}
+			cu, cv := 1.0, 1.0
+			if u == 0 {
+				cu = math.Sqrt2 / 2
+			}
+			if v == 0 {
+				cv = math.Sqrt2 / 2
+			}
+			coef := sum * cu * cv / 4
+			out[v*8+u] = int32(math.Round(coef / float64(quant[v*8+u])))
+		}
+	}
+}
+
+func isGray(img image.Image) bool {
+	switch img.(type) {
+	case *image.Gray, *image.Gray16:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,113 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// testImage returns a smooth image with some detail, sized so
+// the last row and column of blocks are partial.
+func testImage(gray bool) image.Image {
+	const w, h = 45, 30
+	rect := image.Rect(0, 0, w, h)
+	if gray {
+		img := image.NewGray(rect)
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				img.SetGray(x, y, color.Gray{Y: uint8(x*255/w + y%2*10)})
+			}
+		}
+		return img
+	}
+
+	img := image.NewRGBA(rect)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, color.RGBA{
+				R: uint8(x * 255 / w),
+				G: uint8(y * 255 / h),
+				B: uint8((x + y) * 2),
+				A: 255,
+			})
+		}
+	}
+	return img
+}
+
+// meanDiff is the mean absolute difference per channel of the images.
+func meanDiff(a, b image.Image) float64 {
+	bounds := a.Bounds()
+	var sum, n float64
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r1, g1, b1, _ := a.At(x, y).RGBA()
+			r2, g2, b2, _ := b.At(x, y).RGBA()
+			for _, d := range []int{int(r1) - int(r2), int(g1) - int(g2), int(b1) - int(b2)} {
+				sum += float64(max(d, -d) >> 8)
+				n++
+			}
+		}
+	}
+	return sum / n
+}
+
+func TestEncodeProgressiveJPEG(t *testing.T) {
+	tests := []struct {
+		name    string
+		gray    bool
+		quality int
+		model   color.Model
+		maxDiff float64
+	}{
+		{"rgb", false, 90, color.YCbCrModel, 2},
+		{"rgb low quality", false, 10, color.YCbCrModel, 10},
+		{"gray", true, 90, color.GrayModel, 2},
+		{"gray low quality", true, 10, color.GrayModel, 10},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img := testImage(test.gray)
+
+			var buf bytes.Buffer
+			if err := encodeProgressiveJPEG(&buf, img, test.quality); err != nil {
+				t.Fatal(err)
+			}
+			// start of frame marker for progressive DCT
+			if !bytes.Contains(buf.Bytes(), []byte{0xff, 0xc2}) {
+				t.Error("no progressive SOF2 marker")
+			}
+
+			decoded, err := jpeg.Decode(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded.Bounds() != img.Bounds() {
+				t.Fatalf("decoded bounds %v, want %v", decoded.Bounds(), img.Bounds())
+			}
+			if model := decoded.ColorModel(); model != test.model {
+				t.Errorf("decoded color model %v, want %v", model, test.model)
+			}
+			if diff := meanDiff(img, decoded); diff > test.maxDiff {
+				t.Errorf("mean difference %.2f, want at most %.2f", diff, test.maxDiff)
+			}
+		})
+	}
+}
+
+func TestEncodeProgressiveJPEGQualitySize(t *testing.T) {
+	img := testImage(false)
+
+	var low, high bytes.Buffer
+	if err := encodeProgressiveJPEG(&low, img, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := encodeProgressiveJPEG(&high, img, 95); err != nil {
+		t.Fatal(err)
+	}
+	if low.Len() >= high.Len() {
+		t.Errorf("quality 10 is %d bytes, not smaller than quality 95 with %d bytes", low.Len(), high.Len())
+	}
+}
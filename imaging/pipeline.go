@@ -0,0 +1,168 @@
+package imaging
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+
+	"github.com/luevano/libmangal/mangadata"
+	"golang.org/x/sync/errgroup"
+)
+
+// Stage processes the images of a chapter.
+//
+// Stages can modify the images in place, change their format
+// or return a different amount of images (e.g. splitting pages).
+type Stage interface {
+	// Name of the stage, used for logging and errors.
+	Name() string
+
+	// Process the images of the chapter, in order.
+	Process(ctx context.Context, images []*Image) ([]*Image, error)
+}
+
+// PageFunc processes a single page image.
+type PageFunc func(ctx context.Context, img *Image) error
+
+// PageStage is a Stage that processes each page independently,
+// in parallel across pages.
+type PageStage struct {
+	name string
+	fn   PageFunc
+
+	// Workers is the amount of pages processed at once.
+	//
+	// If zero, runtime.NumCPU is used.
+	Workers int
+}
+
+// NewPageStage constructs a new PageStage from the given PageFunc.
+func NewPageStage(name string, fn PageFunc) *PageStage {
+	return &PageStage{
+		name: name,
+		fn:   fn,
+	}
+}
+
+// Name of the stage.
+func (s *PageStage) Name() string {
+	return s.name
+}
+
+// Process applies the PageFunc to each image in parallel.
+func (s *PageStage) Process(ctx context.Context, images []*Image) ([]*Image, error) {
+	err := forEach(ctx, s.Workers, len(images), func(ctx context.Context, i int) error {
+		return s.fn(ctx, images[i])
+	})
+	if err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// Pipeline is a sequence of stages applied to the pages of a chapter.
+type Pipeline struct {
+	stages []Stage
+
+	// Workers is the amount of pages decoded/encoded at once.
+	//
+	// If zero, runtime.NumCPU is used.
+	Workers int
+}
+
+// NewPipeline constructs a new Pipeline with the given stages.
+func NewPipeline(stages ...Stage) *Pipeline {
+	return &Pipeline{stages: stages}
+}
+
+// Append adds stages at the end of the pipeline.
+func (p *Pipeline) Append(stages ...Stage) *Pipeline {
+	p.stages = append(p.stages, stages...)
+	return p
+}
+
+// Stages returns the stages of the pipeline.
+func (p *Pipeline) Stages() []Stage {
+	return p.stages
+}
+
+// Run decodes the pages, applies all the stages and encodes
+// the resulting images (only if they were modified).
+//
+// The resulting pages report the extension of the encoded image.
+func (p *Pipeline) Run(
+	ctx context.Context,
+	pages []mangadata.PageWithImage,
+) ([]mangadata.PageWithImage, error) {
+	if p == nil || len(p.stages) == 0 {
+		return pages, nil
+	}
+
+	images := make([]*Image, len(pages))
+	err := forEach(ctx, p.Workers, len(pages), func(_ context.Context, i int) error {
+		img, err := NewImage(pages[i], pages[i].Image())
+		if err != nil {
+			return err
+		}
+		images[i] = img
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stage := range p.stages {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		images, err = stage.Process(ctx, images)
+		if err != nil {
+			return nil, fmt.Errorf("image pipeline stage %q: %w", stage.Name(), err)
+		}
+	}
+
+	result := make([]mangadata.PageWithImage, len(images))
+	err = forEach(ctx, p.Workers, len(images), func(_ context.Context, i int) error {
+		img := images[i]
+		encoded, extension, err := img.encode()
+		if err != nil {
+			return fmt.Errorf("encoding page %q image: %w", img.Page, err)
+		}
+		result[i] = &page{
+			Page:       img.Page,
+			image:      encoded,
+			extension:  extension,
+			doublePage: img.DoublePage,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// forEach calls fn for each index in parallel, stopping at the first error.
+func forEach(ctx context.Context, workers, n int, fn func(ctx context.Context, i int) error) error {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(workers)
+	for i := 0; i < n; i++ {
+		g.Go(func() error {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+			}
+			return fn(ctx, i)
+		})
+	}
+	return g.Wait()
+}
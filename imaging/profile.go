@@ -0,0 +1,169 @@
+package imaging
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// DeviceProfile configures the image output for a specific device,
+// usually e-readers.
+type DeviceProfile struct {
+	// Name of the profile, used to select it.
+	Name string
+
+	// Width of the device screen in pixels.
+	Width int
+
+	// Height of the device screen in pixels.
+	Height int
+
+	// Crop trims the page borders before resizing, if not nil.
+	Crop *CropOptions
+
+	// Grayscale converts the images to grayscale, for e-ink screens.
+	Grayscale bool
+
+	// Contrast adjustment, 1 (or zero) means unchanged.
+	Contrast float64
+
+	// Gamma adjustment, 1 (or zero) means unchanged.
+	Gamma float64
+
+	// Format the images are encoded to.
+	Format Format
+
+	// EncodeOptions used for the Format.
+	EncodeOptions EncodeOptions
+}
+
+// Stages returns the pipeline stages that apply the profile.
+func (p DeviceProfile) Stages() []Stage {
+	var stages []Stage
+	if p.Crop != nil {
+		stages = append(stages, Crop(*p.Crop))
+	}
+	if p.Grayscale {
+		stages = append(stages, Grayscale())
+	}
+	if p.Width > 0 || p.Height > 0 {
+		stages = append(stages, Resize(ResizeOptions{
+			Width:  p.Width,
+			Height: p.Height,
+		}))
+	}
+	if (p.Contrast > 0 && p.Contrast != 1) || (p.Gamma > 0 && p.Gamma != 1) {
+		stages = append(stages, Adjust(p.Contrast, p.Gamma))
+	}
+	if p.Format != "" {
+		stages = append(stages, Reencode(p.Format, p.EncodeOptions))
+	}
+	return stages
+}
+
+// Pipeline returns a new Pipeline that applies the profile.
+func (p DeviceProfile) Pipeline() *Pipeline {
+	return NewPipeline(p.Stages()...)
+}
+
+const (
+	DeviceKindlePaperwhite = "kindle-paperwhite"
+	DeviceKoboClara        = "kobo-clara"
+	DeviceKoboLibra        = "kobo-libra"
+	DeviceGenericTablet    = "generic-tablet"
+)
+
+// eInkEncodeOptions keeps the pages small enough for e-readers
+var eInkEncodeOptions = EncodeOptions{
+	Quality:     85,
+	Progressive: true,
+	MaxSize:     512 * 1024,
+}
+
+var (
+	profilesMu sync.RWMutex
+	profiles   = map[string]DeviceProfile{
+		// e-ink screens benefit from a slight contrast boost and darker mid tones
+		DeviceKindlePaperwhite: {
+			Name:          DeviceKindlePaperwhite,
+			Width:         1236,
+			Height:        1648,
+			Grayscale:     true,
+			Contrast:      1.1,
+			Gamma:         0.9,
+			Format:        FormatJPEG,
+			EncodeOptions: eInkEncodeOptions,
+		},
+		DeviceKoboClara: {
+			Name:          DeviceKoboClara,
+			Width:         1072,
+			Height:        1448,
+			Grayscale:     true,
+			Contrast:      1.1,
+			Gamma:         0.9,
+			Format:        FormatJPEG,
+			EncodeOptions: eInkEncodeOptions,
+		},
+		DeviceKoboLibra: {
+			Name:          DeviceKoboLibra,
+			Width:         1264,
+			Height:        1680,
+			Grayscale:     true,
+			Contrast:      1.1,
+			Gamma:         0.9,
+			Format:        FormatJPEG,
+			EncodeOptions: eInkEncodeOptions,
+		},
+		DeviceGenericTablet: {
+			Name:   DeviceGenericTablet,
+			Width:  1600,
+			Height: 2560,
+			Format: FormatJPEG,
+			EncodeOptions: EncodeOptions{
+				Quality:     90,
+				Progressive: true,
+				MaxSize:     1024 * 1024,
+			},
+		},
+	}
+)
+
+// RegisterDeviceProfile adds (or replaces) a device profile.
+func RegisterDeviceProfile(profile DeviceProfile) error {
+	if profile.Name == "" {
+		return Error("device profile name must be non-empty")
+	}
+	if profile.Format != "" {
+		if err := checkEncode(profile.Format, profile.EncodeOptions); err != nil {
+			return Error(fmt.Sprintf("device profile %q: %s", profile.Name, err))
+		}
+	}
+
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+	profiles[profile.Name] = profile
+	return nil
+}
+
+// GetDeviceProfile returns the device profile with the given name.
+func GetDeviceProfile(name string) (DeviceProfile, bool) {
+	profilesMu.RLock()
+	defer profilesMu.RUnlock()
+	profile, ok := profiles[name]
+	return profile, ok
+}
+
+// DeviceProfiles returns all the registered device profiles, sorted by name.
+func DeviceProfiles() []DeviceProfile {
+	profilesMu.RLock()
+	defer profilesMu.RUnlock()
+
+	list := make([]DeviceProfile, 0, len(profiles))
+	for _, profile := range profiles {
+		list = append(list, profile)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
@@ -0,0 +1,88 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"net/http"
+)
+
+// Formats that are only detected (see Sniff), they have no built in
+// decoders or encoders so their images are kept as they are.
+const (
+	FormatAVIF Format = "avif"
+	FormatJXL  Format = "jxl"
+	FormatBMP  Format = "bmp"
+)
+
+// magic numbers of the known image formats
+var signatures = []struct {
+	format Format
+	offset int
+	magic  []byte
+}{
+	{FormatJPEG, 0, []byte{0xFF, 0xD8, 0xFF}},
+	{FormatPNG, 0, []byte("\x89PNG\r\n\x1a\n")},
+	{FormatGIF, 0, []byte("GIF87a")},
+	{FormatGIF, 0, []byte("GIF89a")},
+	{FormatWebP, 8, []byte("WEBP")},
+	{FormatAVIF, 4, []byte("ftypavif")},
+	{FormatAVIF, 4, []byte("ftypavis")},
+	{FormatJXL, 0, []byte{0xFF, 0x0A}},
+	{FormatJXL, 0, []byte("\x00\x00\x00\x0cJXL \r\n\x87\n")},
+	{FormatBMP, 0, []byte("BM")},
+}
+
+// Sniff detects the image format from the contents magic numbers,
+// ignoring any extension given by the source.
+//
+// Returns an Error if the contents are not a known image format
+// (e.g. an HTML error page served with an image URL).
+func Sniff(data []byte) (Format, error) {
+	for _, sig := range signatures {
+		end := sig.offset + len(sig.magic)
+		if len(data) >= end && bytes.Equal(data[sig.offset:end], sig.magic) {
+			// RIFF container is shared with other formats (e.g. WAV)
+			if sig.format == FormatWebP && !bytes.HasPrefix(data, []byte("RIFF")) {
+				continue
+			}
+			return sig.format, nil
+		}
+	}
+
+	if len(data) == 0 {
+		return "", Error("empty image contents")
+	}
+	return "", Error(fmt.Sprintf("contents are not an image (%s)", http.DetectContentType(data)))
+}
+
+// Validate sniffs the image format and checks that the contents
+// can be decoded, catching truncated or corrupted images.
+//
+// Formats without a registered decoder (e.g. AVIF, JPEG XL)
+// are only sniffed.
+func Validate(data []byte) (Format, error) {
+	format, err := Sniff(data)
+	if err != nil {
+		return "", err
+	}
+
+	_, decoded, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		if err == image.ErrFormat {
+			return format, nil
+		}
+		return "", Error(fmt.Sprintf("invalid %s image: %s", format, err))
+	}
+	if Format(decoded) != format {
+		return "", Error(fmt.Sprintf("image detected as %s but decoded as %s", format, decoded))
+	}
+	return format, nil
+}
+
+// CanDecode returns true if the image contents can be decoded (there
+// is a registered decoder for its format), as needed by the Pipeline.
+func CanDecode(data []byte) bool {
+	_, _, err := image.DecodeConfig(bytes.NewReader(data))
+	return err != image.ErrFormat
+}
@@ -0,0 +1,147 @@
+package imaging
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+
+	"github.com/luevano/libmangal/mangadata"
+)
+
+// SpreadMode is what to do with double-page spreads.
+type SpreadMode uint8
+
+const (
+	// SpreadKeep keeps the spread as is, only flagging it as a double page.
+	SpreadKeep SpreadMode = iota
+
+	// SpreadSplit splits the spread into two pages.
+	SpreadSplit
+
+	// SpreadRotate rotates the spread 90 degrees so it fits portrait screens.
+	SpreadRotate
+)
+
+// SpreadOptions configures the Spreads stage.
+type SpreadOptions struct {
+	// Mode of handling the detected spreads.
+	Mode SpreadMode
+
+	// MinRatio is the minimum width/height ratio for a page to be
+	// considered a spread. If zero, any landscape page is a spread.
+	MinRatio float64
+
+	// LeftToRight reading order for the split pages. By default
+	// the right half comes first (manga, right-to-left).
+	LeftToRight bool
+
+	// CounterClockwise rotation, clockwise by default.
+	CounterClockwise bool
+}
+
+// Spreads detects landscape pages (usually double-page spreads) and
+// splits, rotates or flags them.
+//
+// Flagged pages report DoublePage, used for the ComicInfo.xml page entries.
+func Spreads(options SpreadOptions) Stage {
+	minRatio := options.MinRatio
+	if minRatio <= 0 {
+		minRatio = 1
+	}
+
+	return &spreadStage{
+		options:  options,
+		minRatio: minRatio,
+	}
+}
+
+type spreadStage struct {
+	options  SpreadOptions
+	minRatio float64
+}
+
+func (s *spreadStage) Name() string {
+	return "spreads"
+}
+
+func (s *spreadStage) Process(ctx context.Context, images []*Image) ([]*Image, error) {
+	// split pages change the page count, every page produces one or two pages
+	results := make([][]*Image, len(images))
+	err := forEach(ctx, 0, len(images), func(_ context.Context, i int) error {
+		img := images[i]
+		bounds := img.Image.Bounds()
+		if bounds.Dy() == 0 || float64(bounds.Dx())/float64(bounds.Dy()) <= s.minRatio {
+			results[i] = []*Image{img}
+			return nil
+		}
+
+		switch s.options.Mode {
+		case SpreadSplit:
+			mid := bounds.Min.X + bounds.Dx()/2
+			left := crop(img.Image, image.Rect(bounds.Min.X, bounds.Min.Y, mid, bounds.Max.Y))
+			right := crop(img.Image, image.Rect(mid, bounds.Min.Y, bounds.Max.X, bounds.Max.Y))
+
+			first, second := right, left
+			if s.options.LeftToRight {
+				first, second = left, right
+			}
+			results[i] = []*Image{
+				img.Clone(&splitPage{Page: img.Page, part: 1}, first),
+				img.Clone(&splitPage{Page: img.Page, part: 2}, second),
+			}
+		case SpreadRotate:
+			img.SetImage(rotate90(img.Image, !s.options.CounterClockwise))
+			img.DoublePage = true
+			results[i] = []*Image{img}
+		default:
+			img.DoublePage = true
+			results[i] = []*Image{img}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var processed []*Image
+	for _, result := range results {
+		processed = append(processed, result...)
+	}
+	return processed, nil
+}
+
+// splitPage is one of the halves of a split spread.
+type splitPage struct {
+	mangadata.Page
+	part int
+}
+
+func (p *splitPage) String() string {
+	return fmt.Sprintf("%s (%d/2)", p.Page, p.part)
+}
+
+// crop copies the rect of the image into a new image.
+func crop(img image.Image, rect image.Rectangle) image.Image {
+	dst := newLike(img, image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, rect.Min, draw.Src)
+	return dst
+}
+
+// rotate90 rotates the image 90 degrees.
+func rotate90(img image.Image, clockwise bool) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	dst := newLike(img, image.Rect(0, 0, h, w))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := img.At(bounds.Min.X+x, bounds.Min.Y+y)
+			if clockwise {
+				dst.Set(h-1-y, x, c)
+			} else {
+				dst.Set(y, w-1-x, c)
+			}
+		}
+	}
+	return dst
+}
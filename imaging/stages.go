@@ -0,0 +1,166 @@
+package imaging
+
+import (
+	"context"
+	"image"
+	"image/draw"
+	"math"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// Grayscale converts the images to grayscale.
+func Grayscale() *PageStage {
+	return NewPageStage("grayscale", func(_ context.Context, img *Image) error {
+		if _, ok := img.Image.(*image.Gray); ok {
+			return nil
+		}
+
+		bounds := img.Image.Bounds()
+		gray := image.NewGray(bounds)
+		draw.Draw(gray, bounds, img.Image, bounds.Min, draw.Src)
+		img.SetImage(gray)
+		return nil
+	})
+}
+
+// Adjust changes the contrast and gamma of the images.
+//
+// A contrast of 1 and gamma of 1 leave the image unchanged. Contrast
+// above 1 increases it, gamma above 1 brightens the mid tones.
+func Adjust(contrast, gamma float64) *PageStage {
+	var lut [256]uint8
+	for i := range lut {
+		v := float64(i) / 255
+		if gamma > 0 && gamma != 1 {
+			v = math.Pow(v, 1/gamma)
+		}
+		if contrast > 0 && contrast != 1 {
+			v = (v-0.5)*contrast + 0.5
+		}
+		lut[i] = uint8(math.Round(math.Min(math.Max(v, 0), 1) * 255))
+	}
+
+	return NewPageStage("adjust", func(_ context.Context, img *Image) error {
+		if (contrast <= 0 || contrast == 1) && (gamma <= 0 || gamma == 1) {
+			return nil
+		}
+
+		bounds := img.Image.Bounds()
+		switch src := img.Image.(type) {
+		case *image.Gray:
+			dst := image.NewGray(bounds)
+			draw.Draw(dst, bounds, src, bounds.Min, draw.Src)
+			for i, v := range dst.Pix {
+				dst.Pix[i] = lut[v]
+			}
+			img.SetImage(dst)
+		default:
+			dst := image.NewRGBA(bounds)
+			draw.Draw(dst, bounds, src, bounds.Min, draw.Src)
+			for i := 0; i < len(dst.Pix); i += 4 {
+				dst.Pix[i] = lut[dst.Pix[i]]
+				dst.Pix[i+1] = lut[dst.Pix[i+1]]
+				dst.Pix[i+2] = lut[dst.Pix[i+2]]
+			}
+			img.SetImage(dst)
+		}
+		return nil
+	})
+}
+
+// ResizeOptions configures the Resize stage.
+type ResizeOptions struct {
+	// Width is the maximum width. Zero means no limit.
+	Width int
+
+	// Height is the maximum height. Zero means no limit.
+	Height int
+
+	// Upscale images smaller than the given size.
+	Upscale bool
+
+	// Scaler used for the interpolation.
+	//
+	// If nil, xdraw.CatmullRom is used.
+	Scaler xdraw.Scaler
+}
+
+// Resize fits the images into the given size, keeping the aspect ratio.
+func Resize(options ResizeOptions) *PageStage {
+	scaler := options.Scaler
+	if scaler == nil {
+		scaler = xdraw.CatmullRom
+	}
+
+	return NewPageStage("resize", func(_ context.Context, img *Image) error {
+		bounds := img.Image.Bounds()
+		width, height := fit(bounds.Dx(), bounds.Dy(), options.Width, options.Height)
+		if width == bounds.Dx() && height == bounds.Dy() {
+			return nil
+		}
+		if !options.Upscale && (width > bounds.Dx() || height > bounds.Dy()) {
+			return nil
+		}
+
+		dst := newLike(img.Image, image.Rect(0, 0, width, height))
+		scaler.Scale(dst, dst.Bounds(), img.Image, bounds, xdraw.Src, nil)
+		img.SetImage(dst)
+		return nil
+	})
+}
+
+// Reencode sets the format (and its options) the images will be encoded to.
+//
+// An empty format keeps the source format of each image. Fails for formats
+// that can't be encoded (see CanEncode), e.g. AVIF and JPEG XL, and for
+// lossy WebP (a Quality lower than 100), as WebP is only encoded losslessly.
+func Reencode(format Format, options EncodeOptions) *PageStage {
+	return NewPageStage("reencode", func(_ context.Context, img *Image) error {
+		if format != "" {
+			if err := checkEncode(format, options); err != nil {
+				return err
+			}
+			img.Format = format
+		}
+		img.EncodeOptions = options
+		// force encoding even if the format is the same, to apply the options
+		img.reencode = true
+		return nil
+	})
+}
+
+// fit returns the size that fits into maxWidth x maxHeight keeping the aspect ratio.
+func fit(width, height, maxWidth, maxHeight int) (int, int) {
+	if width == 0 || height == 0 {
+		return width, height
+	}
+
+	scale := 0.0
+	if maxWidth > 0 {
+		scale = float64(maxWidth) / float64(width)
+	}
+	if maxHeight > 0 {
+		s := float64(maxHeight) / float64(height)
+		if scale == 0 || s < scale {
+			scale = s
+		}
+	}
+	if scale == 0 {
+		return width, height
+	}
+
+	w := int(float64(width)*scale + 0.5)
+	h := int(float64(height)*scale + 0.5)
+	return max(w, 1), max(h, 1)
+}
+
+// newLike creates a new image of the same color model (gray or RGBA).
+func newLike(img image.Image, rect image.Rectangle) draw.Image {
+	switch img.(type) {
+	case *image.Gray, *image.Gray16:
+		return image.NewGray(rect)
+	default:
+		return image.NewRGBA(rect)
+	}
+}
@@ -0,0 +1,19 @@
+package imaging
+
+import (
+	"image"
+	"io"
+)
+
+// encodeWebP encodes the image as WebP.
+//
+// Only the lossless (VP8L) bitstream is implemented, there is no lossy
+// (VP8) mode so the Quality is ignored. EncodeOptions.NearLossless rounds
+// off the lower bits of each channel for smaller files.
+func encodeWebP(w io.Writer, img image.Image, options EncodeOptions) error {
+	bits := 0
+	if !options.Lossless {
+		bits = min(max(options.NearLossless, 0), 4)
+	}
+	return encodeWebPLossless(w, img, bits)
+}
@@ -0,0 +1,701 @@
+package imaging
+
+import (
+	"encoding/binary"
+	"image"
+	"image/draw"
+	"io"
+	"sort"
+)
+
+// Lossless WebP (VP8L) encoder.
+//
+// Only uses the subtract green and predictor transforms, LZ77 backward
+// references and a single prefix code group, which is enough for good
+// compression of scanned pages. Reference:
+// https://developers.google.com/speed/webp/docs/webp_lossless_bitstream_specification
+
+const (
+	vp8lSignature = 0x2f
+	vp8lMaxSize   = 1 << 14
+
+	vp8lTransformPredictor     = 0
+	vp8lTransformSubtractGreen = 2
+
+	// predictor tiles of 16x16 pixels
+	vp8lTileBits = 4
+
+	vp8lNumLiterals      = 256
+	vp8lNumLengthCodes   = 24
+	vp8lNumDistanceCodes = 40
+	vp8lMaxLength        = 4096
+	vp8lMinLength        = 3
+	vp8lWindowSize       = 1<<20 - 120
+	vp8lMaxChain         = 16
+	vp8lHashBits         = 16
+
+	// predictor modes used by the encoder
+	vp8lPredictLeft   = 1
+	vp8lPredictTop    = 2
+	vp8lPredictSelect = 11
+)
+
+var vp8lCodeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// encodeWebPLossless encodes the image as lossless WebP.
+//
+// If nearLosslessBits is greater than zero, the lower bits of each
+// channel are rounded off first, trading quality for size.
+func encodeWebPLossless(w io.Writer, img image.Image, nearLosslessBits int) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= 0 || height <= 0 || width > vp8lMaxSize || height > vp8lMaxSize {
+		return Error("image size not supported by webp")
+	}
+
+	pixels, hasAlpha := argbPixels(img)
+	if nearLosslessBits > 0 {
+		quantize(pixels, nearLosslessBits)
+	}
+
+	bw := &lsbWriter{}
+	bw.write(vp8lSignature, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if hasAlpha {
+		bw.write(1, 1)
+	} else {
+		bw.write(0, 1)
+	}
+	bw.write(0, 3) // version
+
+	subtractGreen(pixels)
+	bw.write(1, 1)
+	bw.write(vp8lTransformSubtractGreen, 2)
+
+	modes, tilesX := predict(pixels, width, height)
+	bw.write(1, 1)
+	bw.write(vp8lTransformPredictor, 2)
+	bw.write(vp8lTileBits-2, 3)
+	writeImageData(bw, modes, tilesX, false)
+
+	bw.write(0, 1) // no more transforms
+	writeImageData(bw, pixels, width, true)
+
+	data := bw.bytes()
+	chunkSize := len(data)
+	padded := chunkSize + chunkSize&1
+
+	header := make([]byte, 20)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(12+padded))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(chunkSize))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if padded != chunkSize {
+		_, err := w.Write([]byte{0})
+		return err
+	}
+	return nil
+}
+
+// argbPixels returns the non premultiplied ARGB pixels of the image.
+func argbPixels(img image.Image) ([]uint32, bool) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	pixels := make([]uint32, width*height)
+
+	if gray, ok := img.(*image.Gray); ok {
+		for y := 0; y < height; y++ {
+			row := gray.Pix[gray.PixOffset(bounds.Min.X, bounds.Min.Y+y):][:width]
+			for x, v := range row {
+				g := uint32(v)
+				pixels[y*width+x] = 0xff000000 | g<<16 | g<<8 | g
+			}
+		}
+		return pixels, false
+	}
+
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok {
+		nrgba = image.NewNRGBA(bounds)
+		draw.Draw(nrgba, bounds, img, bounds.Min, draw.Src)
+	}
+	hasAlpha := false
+	for y := 0; y < height; y++ {
+		row := nrgba.Pix[nrgba.PixOffset(bounds.Min.X, bounds.Min.Y+y):][:width*4]
+		for x := 0; x < width; x++ {
+			r, g, b, a := row[x*4], row[x*4+1], row[x*4+2], row[x*4+3]
+			if a != 0xff {
+				hasAlpha = true
+			}
+			pixels[y*width+x] = uint32(a)<<24 | uint32(r)<<16 | uint32(g)<<8 | uint32(b)
+		}
+	}
+	return pixels, hasAlpha
+}
+
+// quantize rounds the lower bits of the color channels (not alpha).
+func quantize(pixels []uint32, bits int) {
+	half := uint32(1) << (bits - 1)
+	mask := ^uint32(1<<bits - 1)
+	q := func(v uint32) uint32 {
+		return min(v+half, 0xff) & mask
+	}
+	for i, p := range pixels {
+		a := p >> 24
+		r := q(p >> 16 & 0xff)
+		g := q(p >> 8 & 0xff)
+		b := q(p & 0xff)
+		pixels[i] = a<<24 | r<<16 | g<<8 | b
+	}
+}
+
+func subtractGreen(pixels []uint32) {
+	for i, p := range pixels {
+		g := p >> 8 & 0xff
+		r := (p>>16 - g) & 0xff
+		b := (p - g) & 0xff
+		pixels[i] = p&0xff00ff00 | r<<16 | b
+	}
+}
+
+// predict replaces the pixels by the residuals of the best predictor
+// of each tile, returns the modes sub-image and its width.
+func predict(pixels []uint32, width, height int) ([]uint32, int) {
+	tileSize := 1 << vp8lTileBits
+	tilesX := (width + tileSize - 1) >> vp8lTileBits
+	tilesY := (height + tileSize - 1) >> vp8lTileBits
+	modes := make([]uint32, tilesX*tilesY)
+
+	// residuals are computed from the original pixels
+	original := make([]uint32, len(pixels))
+	copy(original, pixels)
+
+	predictor := func(mode, x, y int) uint32 {
+		i := y*width + x
+		switch {
+		case x == 0 && y == 0:
+			return 0xff000000
+		case y == 0:
+			return original[i-1]
+		case x == 0:
+			return original[i-width]
+		}
+
+		left, top := original[i-1], original[i-width]
+		switch mode {
+		case vp8lPredictLeft:
+			return left
+		case vp8lPredictTop:
+			return top
+		default:
+			return selectPredictor(left, top, original[i-width-1])
+		}
+	}
+
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			x0, y0 := tx*tileSize, ty*tileSize
+			x1, y1 := min(x0+tileSize, width), min(y0+tileSize, height)
+
+			best, bestCost := vp8lPredictLeft, -1
+			for _, mode := range []int{vp8lPredictLeft, vp8lPredictTop, vp8lPredictSelect} {
+				cost := 0
+				for y := y0; y < y1; y++ {
+					for x := x0; x < x1; x++ {
+						cost += residualCost(sub(original[y*width+x], predictor(mode, x, y)))
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+
+			modes[ty*tilesX+tx] = 0xff000000 | uint32(best)<<8
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					i := y*width + x
+					pixels[i] = sub(original[i], predictor(best, x, y))
+				}
+			}
+		}
+	}
+	return modes, tilesX
+}
+
+// sub subtracts each channel, modulo 256.
+func sub(a, b uint32) uint32 {
+	ag := (a | 0x00ff00ff) - (b & 0xff00ff00)
+	rb := (a | 0xff00ff00) - (b & 0x00ff00ff)
+	return ag&0xff00ff00 | rb&0x00ff00ff
+}
+
+func residualCost(r uint32) int {
+	cost := 0
+	for shift := 0; shift < 32; shift += 8 {
+		v := int(int8(r >> shift))
+		cost += abs(v)
+	}
+	return cost
+}
+
+func selectPredictor(left, top, topLeft uint32) uint32 {
+	pl, pt := 0, 0
+	for shift := 0; shift < 32; shift += 8 {
+		l := int(left >> shift & 0xff)
+		t := int(top >> shift & 0xff)
+		tl := int(topLeft >> shift & 0xff)
+		p := l + t - tl
+		pl += abs(p - l)
+		pt += abs(p - t)
+	}
+	if pl < pt {
+		return left
+	}
+	return top
+}
+
+// token is either a literal pixel or a backward reference.
+type token struct {
+	literal  uint32
+	length   int // zero for literals
+	distance int // distance code
+}
+
+// writeImageData writes the entropy coded image. Only the main
+// image (level0) uses backward references and the meta prefix bit.
+func writeImageData(bw *lsbWriter, pixels []uint32, width int, level0 bool) {
+	var tokens []token
+	if level0 {
+		tokens = backwardReferences(pixels, width)
+	} else {
+		tokens = make([]token, len(pixels))
+		for i, p := range pixels {
+			tokens[i] = token{literal: p}
+		}
+	}
+
+	green := make([]uint32, vp8lNumLiterals+vp8lNumLengthCodes)
+	red := make([]uint32, vp8lNumLiterals)
+	blue := make([]uint32, vp8lNumLiterals)
+	alpha := make([]uint32, vp8lNumLiterals)
+	dist := make([]uint32, vp8lNumDistanceCodes)
+	for _, t := range tokens {
+		if t.length == 0 {
+			green[t.literal>>8&0xff]++
+			red[t.literal>>16&0xff]++
+			blue[t.literal&0xff]++
+			alpha[t.literal>>24]++
+			continue
+		}
+		code, _, _ := prefixEncode(t.length)
+		green[vp8lNumLiterals+code]++
+		code, _, _ = prefixEncode(t.distance)
+		dist[code]++
+	}
+
+	bw.write(0, 1) // no color cache
+	if level0 {
+		bw.write(0, 1) // no meta prefix codes
+	}
+
+	codes := make([]prefixCode, 5)
+	for i, histogram := range [][]uint32{green, red, blue, alpha, dist} {
+		codes[i] = newPrefixCode(histogram, 15)
+		codes[i].writeTo(bw)
+	}
+
+	for _, t := range tokens {
+		if t.length == 0 {
+			codes[0].writeSymbol(bw, int(t.literal>>8&0xff))
+			codes[1].writeSymbol(bw, int(t.literal>>16&0xff))
+			codes[2].writeSymbol(bw, int(t.literal&0xff))
+			codes[3].writeSymbol(bw, int(t.literal>>24))
+			continue
+		}
+		code, extraBits, extra := prefixEncode(t.length)
+		codes[0].writeSymbol(bw, vp8lNumLiterals+code)
+		bw.write(extra, extraBits)
+		code, extraBits, extra = prefixEncode(t.distance)
+		codes[4].writeSymbol(bw, code)
+		bw.write(extra, extraBits)
+	}
+}
+
+// backwardReferences finds LZ77 matches with hash chains.
+func backwardReferences(pixels []uint32, width int) []token {
+	n := len(pixels)
+	head := make([]int32, 1<<vp8lHashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	prev := make([]int32, n)
+
+	hash := func(i int) uint32 {
+		h := (pixels[i]*0x1e35a7bd ^ pixels[i+1]*0x9e3779b1) >> (32 - vp8lHashBits)
+		return h
+	}
+	insert := func(i int) {
+		if i+1 >= n {
+			return
+		}
+		h := hash(i)
+		prev[i] = head[h]
+		head[h] = int32(i)
+	}
+	matchLength := func(i, j int) int {
+		limit := min(n-i, vp8lMaxLength)
+		l := 0
+		for l < limit && pixels[i+l] == pixels[j+l] {
+			l++
+		}
+		return l
+	}
+
+	tokens := make([]token, 0, n/4)
+	for i := 0; i < n; {
+		bestLength, bestDistance := 0, 0
+		try := func(j int) {
+			if j < 0 || j >= i || i-j > vp8lWindowSize {
+				return
+			}
+			if l := matchLength(i, j); l > bestLength {
+				bestLength, bestDistance = l, i-j
+			}
+		}
+
+		// the left and top pixels have short distance codes
+		try(i - 1)
+		try(i - width)
+		if i+1 < n {
+			chain := 0
+			for j := int(head[hash(i)]); j >= 0 && chain < vp8lMaxChain && bestLength < vp8lMaxLength; j = int(prev[j]) {
+				if i-j > vp8lWindowSize {
+					break
+				}
+				try(j)
+				chain++
+			}
+		}
+
+		if bestLength < vp8lMinLength {
+			tokens = append(tokens, token{literal: pixels[i]})
+			insert(i)
+			i++
+			continue
+		}
+
+		tokens = append(tokens, token{
+			length:   bestLength,
+			distance: distanceCode(bestDistance, width),
+		})
+		for k := 0; k < bestLength; k++ {
+			insert(i + k)
+		}
+		i += bestLength
+	}
+	return tokens
+}
+
+// distanceCode maps the linear distance to its code, with the
+// 2D short codes for the left and top pixels.
+func distanceCode(distance, width int) int {
+	switch distance {
+	case width:
+		return 1
+	case 1:
+		return 2
+	default:
+		return distance + 120
+	}
+}
+
+// prefixEncode returns the prefix code, extra bits count and extra bits value of a value >= 1.
+func prefixEncode(value int) (int, uint, uint32) {
+	v := value - 1
+	if v < 4 {
+		return v, 0, 0
+	}
+	highest := 31
+	for v>>highest == 0 {
+		highest--
+	}
+	second := v >> (highest - 1) & 1
+	extraBits := uint(highest - 1)
+	return 2*highest + second, extraBits, uint32(v & (1<<extraBits - 1))
+}
+
+// prefixCode is a canonical Huffman code.
+type prefixCode struct {
+	lengths []uint8
+	codes   []uint32 // bit reversed, ready to be written LSB first
+}
+
+func newPrefixCode(histogram []uint32, maxLength int) prefixCode {
+	lengths := huffmanLengths(histogram, maxLength)
+
+	used := 0
+	last := 0
+	for s, l := range lengths {
+		if l > 0 {
+			used++
+			last = s
+		}
+	}
+	// a single symbol that can't use the simple code needs a sibling
+	if used == 1 && last >= 256 {
+		lengths[last] = 1
+		lengths[0] = 1
+	}
+
+	return prefixCode{
+		lengths: lengths,
+		codes:   canonicalCodes(lengths),
+	}
+}
+
+func (c prefixCode) writeSymbol(bw *lsbWriter, symbol int) {
+	bw.write(c.codes[symbol], uint(c.lengths[symbol]))
+}
+
+// writeTo writes the code lengths.
+func (c prefixCode) writeTo(bw *lsbWriter) {
+	var symbols []int
+	for s, l := range c.lengths {
+		if l > 0 {
+			symbols = append(symbols, s)
+		}
+	}
+
+	// simple code, single symbol coded with zero bits
+	if len(symbols) <= 1 {
+		symbol := 0
+		if len(symbols) == 1 {
+			symbol = symbols[0]
+			// zero bits to write it
+			c.lengths[symbol] = 0
+		}
+		bw.write(1, 1)
+		bw.write(0, 1) // one symbol
+		if symbol < 2 {
+			bw.write(0, 1)
+			bw.write(uint32(symbol), 1)
+		} else {
+			bw.write(1, 1)
+			bw.write(uint32(symbol), 8)
+		}
+		return
+	}
+
+	// run length encoded code lengths
+	type rle struct {
+		symbol    int
+		extra     uint32
+		extraBits uint
+	}
+	var tokens []rle
+	lengths := c.lengths
+	for i := 0; i < len(lengths); {
+		value := lengths[i]
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == value {
+			run++
+		}
+		i += run
+
+		if value == 0 {
+			for run >= 11 {
+				n := min(run, 138)
+				tokens = append(tokens, rle{18, uint32(n - 11), 7})
+				run -= n
+			}
+			if run >= 3 {
+				tokens = append(tokens, rle{17, uint32(run - 3), 3})
+				run = 0
+			}
+		} else {
+			tokens = append(tokens, rle{int(value), 0, 0})
+			run--
+			for run >= 3 {
+				n := min(run, 6)
+				tokens = append(tokens, rle{16, uint32(n - 3), 2})
+				run -= n
+			}
+		}
+		for ; run > 0; run-- {
+			tokens = append(tokens, rle{int(value), 0, 0})
+		}
+	}
+
+	histogram := make([]uint32, len(vp8lCodeLengthOrder))
+	for _, t := range tokens {
+		histogram[t.symbol]++
+	}
+	code := newPrefixCode(histogram, 7)
+	used := 0
+	for _, l := range code.lengths {
+		if l > 0 {
+			used++
+		}
+	}
+	if used == 1 {
+		// the code length code must be able to code something
+		for s := range code.lengths {
+			code.lengths[s] = 0
+		}
+		code.lengths[tokens[0].symbol] = 1
+		code.lengths[(tokens[0].symbol+1)%len(code.lengths)] = 1
+		code.codes = canonicalCodes(code.lengths)
+	}
+
+	count := len(vp8lCodeLengthOrder)
+	for count > 4 && code.lengths[vp8lCodeLengthOrder[count-1]] == 0 {
+		count--
+	}
+	bw.write(0, 1) // normal code
+	bw.write(uint32(count-4), 4)
+	for _, s := range vp8lCodeLengthOrder[:count] {
+		bw.write(uint32(code.lengths[s]), 3)
+	}
+	bw.write(0, 1) // max_symbol is the alphabet size
+	for _, t := range tokens {
+		code.writeSymbol(bw, t.symbol)
+		bw.write(t.extra, t.extraBits)
+	}
+}
+
+// huffmanLengths builds the code lengths limited to maxLength.
+//
+// When the tree is too deep, the small counts are raised and it's built again.
+func huffmanLengths(histogram []uint32, maxLength int) []uint8 {
+	type node struct {
+		count       uint32
+		symbol      int
+		left, right int
+	}
+
+	lengths := make([]uint8, len(histogram))
+	var symbols []int
+	for s, c := range histogram {
+		if c > 0 {
+			symbols = append(symbols, s)
+		}
+	}
+	if len(symbols) <= 1 {
+		for _, s := range symbols {
+			lengths[s] = 1
+		}
+		return lengths
+	}
+
+	minCount := uint32(1)
+	for {
+		nodes := make([]node, 0, 2*len(symbols))
+		for _, s := range symbols {
+			nodes = append(nodes, node{count: max(histogram[s], minCount), symbol: s, left: -1, right: -1})
+		}
+		sort.SliceStable(nodes, func(i, j int) bool {
+			return nodes[i].count < nodes[j].count
+		})
+
+		// two queues: sorted leaves and internal nodes (created in order)
+		leaves, internal := 0, len(nodes)
+		pop := func() int {
+			if leaves < len(symbols) && (internal >= len(nodes) || nodes[leaves].count <= nodes[internal].count) {
+				leaves++
+				return leaves - 1
+			}
+			internal++
+			return internal - 1
+		}
+		for k := 0; k < len(symbols)-1; k++ {
+			a, b := pop(), pop()
+			nodes = append(nodes, node{count: nodes[a].count + nodes[b].count, symbol: -1, left: a, right: b})
+		}
+
+		maxDepth := 0
+		type item struct{ index, depth int }
+		stack := []item{{len(nodes) - 1, 0}}
+		for len(stack) > 0 {
+			it := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			nd := nodes[it.index]
+			if nd.symbol >= 0 {
+				lengths[nd.symbol] = uint8(min(it.depth, 255))
+				maxDepth = max(maxDepth, it.depth)
+				continue
+			}
+			stack = append(stack, item{nd.left, it.depth + 1}, item{nd.right, it.depth + 1})
+		}
+
+		if maxDepth <= maxLength {
+			return lengths
+		}
+		minCount *= 2
+	}
+}
+
+// canonicalCodes returns the bit reversed canonical codes for the lengths.
+func canonicalCodes(lengths []uint8) []uint32 {
+	var count [16]uint32
+	for _, l := range lengths {
+		if l > 0 {
+			count[l]++
+		}
+	}
+
+	var next [16]uint32
+	code := uint32(0)
+	for bits := 1; bits < 16; bits++ {
+		code = (code + count[bits-1]) << 1
+		next[bits] = code
+	}
+
+	codes := make([]uint32, len(lengths))
+	for s, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		c := next[l]
+		next[l]++
+
+		reversed := uint32(0)
+		for i := uint8(0); i < l; i++ {
+			reversed = reversed<<1 | c&1
+			c >>= 1
+		}
+		codes[s] = reversed
+	}
+	return codes
+}
+
+// lsbWriter writes bits LSB first, as VP8L expects.
+type lsbWriter struct {
+	buf  []byte
+	acc  uint64
+	bits uint
+}
+
+func (w *lsbWriter) write(value uint32, bits uint) {
+	w.acc |= uint64(value) << w.bits
+	w.bits += bits
+	for w.bits >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.bits -= 8
+	}
+}
+
+func (w *lsbWriter) bytes() []byte {
+	if w.bits > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.bits = 0, 0
+	}
+	return w.buf
+}
@@ -0,0 +1,206 @@
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"math/rand/v2"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+// webpTestImages covers the predictor (gradients), backward references
+// (repeated patterns), large alphabets (noise), alpha and odd sizes.
+func webpTestImages() map[string]image.Image {
+	images := map[string]image.Image{}
+
+	gradient := image.NewNRGBA(image.Rect(0, 0, 67, 45))
+	for y := 0; y < 45; y++ {
+		for x := 0; x < 67; x++ {
+			gradient.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 3), G: uint8(y * 5), B: uint8(x + y), A: 255})
+		}
+	}
+	images["gradient"] = gradient
+
+	// text-like repeated strokes on white, like a scanned page
+	page := image.NewGray(image.Rect(0, 0, 200, 150))
+	for y := 0; y < 150; y++ {
+		for x := 0; x < 200; x++ {
+			v := uint8(255)
+			if y%12 < 8 && (x*7+y/12*13)%17 < 5 {
+				v = 20
+			}
+			page.SetGray(x, y, color.Gray{Y: v})
+		}
+	}
+	images["page"] = page
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	noise := image.NewNRGBA(image.Rect(0, 0, 128, 96))
+	for i := range noise.Pix {
+		noise.Pix[i] = uint8(rng.Uint32())
+	}
+	images["noise with alpha"] = noise
+
+	alpha := image.NewNRGBA(image.Rect(0, 0, 33, 17))
+	for y := 0; y < 17; y++ {
+		for x := 0; x < 33; x++ {
+			alpha.SetNRGBA(x, y, color.NRGBA{R: 200, G: uint8(x * 7), B: 40, A: uint8(y * 15)})
+		}
+	}
+	images["alpha"] = alpha
+
+	single := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	single.SetRGBA(0, 0, color.RGBA{R: 1, G: 2, B: 3, A: 255})
+	images["single pixel"] = single
+
+	// non zero origin
+	images["sub image"] = gradient.SubImage(image.Rect(10, 5, 50, 40))
+
+	return images
+}
+
+// channelDiff returns the maximum difference of the color
+// channels and of the alpha channel of the images.
+func channelDiff(t *testing.T, want, got image.Image) (int, int) {
+	t.Helper()
+
+	wb, gb := want.Bounds(), got.Bounds()
+	if wb.Dx() != gb.Dx() || wb.Dy() != gb.Dy() {
+		t.Fatalf("decoded size %v, want %v", gb.Size(), wb.Size())
+	}
+
+	var colorDiff, alphaDiff int
+	for y := 0; y < wb.Dy(); y++ {
+		for x := 0; x < wb.Dx(); x++ {
+			w := color.NRGBAModel.Convert(want.At(wb.Min.X+x, wb.Min.Y+y)).(color.NRGBA)
+			g := color.NRGBAModel.Convert(got.At(gb.Min.X+x, gb.Min.Y+y)).(color.NRGBA)
+			for _, d := range []int{int(w.R) - int(g.R), int(w.G) - int(g.G), int(w.B) - int(g.B)} {
+				colorDiff = max(colorDiff, d, -d)
+			}
+			alphaDiff = max(alphaDiff, int(w.A)-int(g.A), int(g.A)-int(w.A))
+		}
+	}
+	return colorDiff, alphaDiff
+}
+
+func TestEncodeWebPLossless(t *testing.T) {
+	for name, img := range webpTestImages() {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := encodeWebPLossless(&buf, img, 0); err != nil {
+				t.Fatal(err)
+			}
+
+			format, err := Sniff(buf.Bytes())
+			if err != nil || format != FormatWebP {
+				t.Fatalf("sniffed as %q (%v), want %q", format, err, FormatWebP)
+			}
+
+			decoded, err := webp.Decode(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if colorDiff, alphaDiff := channelDiff(t, img, decoded); colorDiff != 0 || alphaDiff != 0 {
+				t.Errorf("lossless round trip differs by %d (color) and %d (alpha)", colorDiff, alphaDiff)
+			}
+		})
+	}
+}
+
+func TestEncodeWebPNearLossless(t *testing.T) {
+	img := webpTestImages()["noise with alpha"]
+
+	for bits := 1; bits <= 4; bits++ {
+		var buf bytes.Buffer
+		if err := encodeWebPLossless(&buf, img, bits); err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := webp.Decode(&buf)
+		if err != nil {
+			t.Fatalf("%d bits: %s", bits, err)
+		}
+
+		colorDiff, alphaDiff := channelDiff(t, img, decoded)
+		if colorDiff >= 1<<bits {
+			t.Errorf("%d bits: color differs by %d, want less than %d", bits, colorDiff, 1<<bits)
+		}
+		if alphaDiff != 0 {
+			t.Errorf("%d bits: alpha differs by %d, want 0", bits, alphaDiff)
+		}
+	}
+}
+
+func TestEncodeWebPOptions(t *testing.T) {
+	img := webpTestImages()["gradient"]
+
+	encode := func(options EncodeOptions) []byte {
+		t.Helper()
+		data, err := Encode(img, FormatWebP, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	lossless := encode(EncodeOptions{})
+	if !bytes.Equal(encode(EncodeOptions{NearLossless: 3, Lossless: true}), lossless) {
+		t.Error("Lossless with NearLossless differs from the lossless encoding")
+	}
+	if bytes.Equal(encode(EncodeOptions{NearLossless: 3}), lossless) {
+		t.Error("NearLossless is the same as the lossless encoding")
+	}
+}
+
+func TestEncodeUnsupportedFormat(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 1, 1))
+	for _, format := range []Format{FormatAVIF, FormatJXL} {
+		if CanEncode(format) {
+			t.Errorf("CanEncode(%q) = true, want false", format)
+		}
+		if _, err := Encode(img, format, EncodeOptions{}); err == nil {
+			t.Errorf("encoding %q didn't fail", format)
+		}
+	}
+}
+
+func TestReencodeUnsupported(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  Format
+		options EncodeOptions
+		ok      bool
+	}{
+		{"avif", FormatAVIF, EncodeOptions{}, false},
+		{"jpeg xl", FormatJXL, EncodeOptions{}, false},
+		{"lossy webp", FormatWebP, EncodeOptions{Quality: 80}, false},
+		{"near-lossless out of range", FormatWebP, EncodeOptions{NearLossless: 5}, false},
+		{"lossless webp", FormatWebP, EncodeOptions{Lossless: true, Quality: 80}, true},
+		{"near-lossless webp", FormatWebP, EncodeOptions{NearLossless: 2}, true},
+		{"jpeg", FormatJPEG, EncodeOptions{Quality: 80}, true},
+	}
+	t.Cleanup(func() {
+		profilesMu.Lock()
+		delete(profiles, "test")
+		profilesMu.Unlock()
+	})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			images := []*Image{{Image: image.NewGray(image.Rect(0, 0, 1, 1)), Format: FormatPNG}}
+			_, err := Reencode(tt.format, tt.options).Process(context.Background(), images)
+			if tt.ok && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if !tt.ok && err == nil {
+				t.Error("no error")
+			}
+
+			profileErr := RegisterDeviceProfile(DeviceProfile{Name: "test", Format: tt.format, EncodeOptions: tt.options})
+			if tt.ok != (profileErr == nil) {
+				t.Errorf("registering a device profile: %v", profileErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package imaging
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+
+	"github.com/luevano/libmangal/mangadata"
+	xdraw "golang.org/x/image/draw"
+)
+
+// WebtoonOptions configures the Webtoon stage.
+type WebtoonOptions struct {
+	// Width all the slices are scaled to. If zero, the widest slice is used.
+	Width int
+
+	// PageHeight is the target height of the resulting pages.
+	// If zero, 1.5 times the width is used.
+	PageHeight int
+
+	// SearchRange is the fraction (0-1) of the PageHeight around the
+	// target height where a gutter is searched to cut the page.
+	SearchRange float64
+
+	// Tolerance is the maximum luminance difference (0-255) between
+	// the pixels of a row for it to be considered a gutter.
+	Tolerance uint8
+}
+
+// DefaultWebtoonOptions constructs default WebtoonOptions.
+func DefaultWebtoonOptions() WebtoonOptions {
+	return WebtoonOptions{
+		Width:       0,
+		PageHeight:  0,
+		SearchRange: 0.25,
+		Tolerance:   8,
+	}
+}
+
+// Webtoon joins the images of a chapter (long-strip slices) vertically
+// and cuts the resulting strip into pages of the target height.
+//
+// Cuts are made on solid color rows (gutters) closest to the target
+// height, so panels are not split. If there is no gutter in range,
+// the page is cut at the target height.
+//
+// It fails if the width or the page height is not positive, as when
+// all the images are empty and no Width is given.
+func Webtoon(options WebtoonOptions) Stage {
+	return &webtoonStage{options: options}
+}
+
+type webtoonStage struct {
+	options WebtoonOptions
+}
+
+func (s *webtoonStage) Name() string {
+	return "webtoon"
+}
+
+// strip is a slice of the strip, with its vertical offset.
+type strip struct {
+	image  image.Image
+	offset int
+}
+
+func (s *webtoonStage) Process(ctx context.Context, images []*Image) ([]*Image, error) {
+	if len(images) == 0 {
+		return images, nil
+	}
+
+	width := s.options.Width
+	if width <= 0 {
+		for _, img := range images {
+			width = max(width, img.Image.Bounds().Dx())
+		}
+	}
+	pageHeight := s.options.PageHeight
+	if pageHeight <= 0 {
+		pageHeight = width * 3 / 2
+	}
+	if width <= 0 || pageHeight <= 0 {
+		return nil, Error(fmt.Sprintf("invalid webtoon page size %dx%d", width, pageHeight))
+	}
+	searchRange := max(min(int(float64(pageHeight)*s.options.SearchRange), pageHeight-1), 0)
+
+	// scale the slices to the same width and find the gutters
+	strips := make([]strip, len(images))
+	gutters := make([][]bool, len(images))
+	err := forEach(ctx, 0, len(images), func(_ context.Context, i int) error {
+		img := images[i].Image
+		bounds := img.Bounds()
+		if bounds.Dx() != width && bounds.Dx() > 0 {
+			_, height := fit(bounds.Dx(), bounds.Dy(), width, 0)
+			dst := newLike(img, image.Rect(0, 0, width, height))
+			xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, xdraw.Src, nil)
+			img = dst
+		}
+		strips[i].image = img
+		gutters[i] = uniformRows(img, int(s.options.Tolerance))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var gutter []bool
+	total := 0
+	gray := true
+	for i := range strips {
+		strips[i].offset = total
+		total += strips[i].image.Bounds().Dy()
+		gutter = append(gutter, gutters[i]...)
+		if _, ok := strips[i].image.(*image.Gray); !ok {
+			gray = false
+		}
+	}
+
+	// cut points, the last one being the total height
+	var cuts []int
+	for y := 0; y < total; {
+		if total-y <= pageHeight+searchRange {
+			cuts = append(cuts, total)
+			break
+		}
+
+		target := y + pageHeight
+		cut := target
+		for d := 0; d <= searchRange; d++ {
+			if gutter[target-d] {
+				cut = target - d
+				break
+			}
+			if target+d < total && gutter[target+d] {
+				cut = target + d
+				break
+			}
+		}
+		cuts = append(cuts, cut)
+		y = cut
+	}
+
+	format := images[0].Format
+	if format == FormatGIF {
+		format = FormatPNG
+	}
+
+	results := make([]*Image, len(cuts))
+	err = forEach(ctx, 0, len(cuts), func(_ context.Context, i int) error {
+		y0 := 0
+		if i > 0 {
+			y0 = cuts[i-1]
+		}
+		y1 := cuts[i]
+
+		var dst draw.Image
+		if gray {
+			dst = image.NewGray(image.Rect(0, 0, width, y1-y0))
+		} else {
+			dst = image.NewRGBA(image.Rect(0, 0, width, y1-y0))
+		}
+
+		first := -1
+		for j, st := range strips {
+			bounds := st.image.Bounds()
+			top, bottom := st.offset, st.offset+bounds.Dy()
+			if bottom <= y0 || top >= y1 {
+				continue
+			}
+			if first < 0 {
+				first = j
+			}
+			r := image.Rect(0, top-y0, width, bottom-y0).Intersect(dst.Bounds())
+			draw.Draw(dst, r, st.image, bounds.Min.Add(image.Pt(0, r.Min.Y+y0-top)), draw.Src)
+		}
+
+		img := images[first].Clone(&webtoonPage{
+			Page:   images[first].Page,
+			number: i + 1,
+		}, dst)
+		img.Format = format
+		img.DoublePage = false
+		results[i] = img
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// uniformRows returns which rows of the image are solid color.
+func uniformRows(img image.Image, tolerance int) []bool {
+	bounds := img.Bounds()
+	gray, ok := img.(*image.Gray)
+	if !ok {
+		gray = image.NewGray(bounds)
+		draw.Draw(gray, bounds, img, bounds.Min, draw.Src)
+	}
+
+	rows := make([]bool, bounds.Dy())
+	if bounds.Dx() == 0 {
+		return rows
+	}
+	for y := range rows {
+		row := gray.Pix[gray.PixOffset(bounds.Min.X, bounds.Min.Y+y):][:bounds.Dx()]
+		rows[y] = true
+		for _, v := range row {
+			if abs(int(v)-int(row[0])) > tolerance {
+				rows[y] = false
+				break
+			}
+		}
+	}
+	return rows
+}
+
+// webtoonPage is a page cut from the joined strip.
+type webtoonPage struct {
+	mangadata.Page
+	number int
+}
+
+func (p *webtoonPage) String() string {
+	return fmt.Sprintf("webtoon page %d", p.number)
+}
@@ -0,0 +1,134 @@
+package imaging
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// stripSlice is a slice of the given width and height with a striped
+// (non uniform) content, except for the white gutter rows.
+func stripSlice(width, height int, gutters ...int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetGray(x, y, color.Gray{Y: uint8(255 * (x % 2))})
+		}
+	}
+	for _, y := range gutters {
+		for x := 0; x < width; x++ {
+			img.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+	return img
+}
+
+func TestWebtoon(t *testing.T) {
+	options := DefaultWebtoonOptions()
+	options.PageHeight = 100
+
+	tests := []struct {
+		name    string
+		slices  []image.Image
+		options WebtoonOptions
+		heights []int
+	}{
+		{
+			name: "gutters",
+			// gutters at 90 and 205 of the strip
+			slices:  []image.Image{stripSlice(100, 120, 90), stripSlice(100, 120, 85)},
+			options: options,
+			heights: []int{90, 115, 35},
+		},
+		{
+			name:    "gutter closest to the target",
+			slices:  []image.Image{stripSlice(100, 240, 80, 95, 110)},
+			options: options,
+			heights: []int{95, 100, 45},
+		},
+		{
+			name:    "no gutter",
+			slices:  []image.Image{stripSlice(100, 120), stripSlice(100, 120)},
+			options: options,
+			heights: []int{100, 100, 40},
+		},
+		{
+			name:    "gutter out of range",
+			slices:  []image.Image{stripSlice(100, 240, 50)},
+			options: options,
+			heights: []int{100, 100, 40},
+		},
+		{
+			name:    "last page within range",
+			slices:  []image.Image{stripSlice(100, 120)},
+			options: options,
+			heights: []int{120},
+		},
+		{
+			name:    "default page height",
+			slices:  []image.Image{stripSlice(100, 400)},
+			options: DefaultWebtoonOptions(),
+			heights: []int{150, 150, 100},
+		},
+		{
+			name:    "scaled to the width",
+			slices:  []image.Image{stripSlice(100, 100), stripSlice(50, 50)},
+			options: options,
+			heights: []int{100, 100},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			images := make([]*Image, len(tt.slices))
+			for i, slice := range tt.slices {
+				images[i] = &Image{Image: slice, Format: FormatPNG}
+			}
+			pages, err := Webtoon(tt.options).Process(context.Background(), images)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pages) != len(tt.heights) {
+				t.Fatalf("got %d pages, want %d", len(pages), len(tt.heights))
+			}
+			for i, page := range pages {
+				size := page.Image.Bounds().Size()
+				if size.X != 100 || size.Y != tt.heights[i] {
+					t.Errorf("page %d is %v, want 100x%d", i+1, size, tt.heights[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWebtoonInvalidSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		images  []*Image
+		options WebtoonOptions
+	}{
+		{
+			name:    "empty images",
+			images:  []*Image{{Image: image.NewGray(image.Rectangle{}), Format: FormatPNG}},
+			options: DefaultWebtoonOptions(),
+		},
+		{
+			// the page height is zero as well, it never stopped cutting
+			name:    "zero width images",
+			images:  []*Image{{Image: image.NewGray(image.Rect(0, 0, 0, 10)), Format: FormatPNG}},
+			options: DefaultWebtoonOptions(),
+		},
+		{
+			name:    "zero width images with page height",
+			images:  []*Image{{Image: image.NewGray(image.Rect(0, 0, 0, 10)), Format: FormatPNG}},
+			options: WebtoonOptions{PageHeight: 100, SearchRange: 0.25},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Webtoon(tt.options).Process(context.Background(), tt.images); err == nil {
+				t.Error("no error for a zero width")
+			}
+		})
+	}
+}
@@ -0,0 +1,656 @@
+package libmangal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/luevano/libmangal/mangadata"
+	"github.com/luevano/libmangal/metadata"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/philippgille/gokv"
+	"github.com/spf13/afero"
+)
+
+const (
+	// libraryKeyMangas is the index key of the list of manga keys.
+	libraryKeyMangas = "mangas"
+
+	// libraryKeyMangaPrefix prefixes the index key of each manga.
+	libraryKeyMangaPrefix = "manga/"
+)
+
+// LibraryChapter is a chapter file (or directory) of the library index.
+type LibraryChapter struct {
+	// Path of the chapter, relative to the library directory.
+	Path string `json:"path"`
+
+	// Format of the chapter.
+	Format Format `json:"format"`
+
+	// Volume number, from the volume directory name (0 if none).
+	Volume float32 `json:"volume"`
+
+	// Number of the chapter, from the ComicInfo.xml or the name.
+	Number float32 `json:"number"`
+
+	// Title of the chapter, from the ComicInfo.xml or the name.
+	Title string `json:"title"`
+
+	// Series the chapter belongs to, from the ComicInfo.xml.
+	Series string `json:"series"`
+
+	// URL of the chapter, from the ComicInfo.xml.
+	URL string `json:"url"`
+
+	// Date of the chapter, from the ComicInfo.xml.
+	Date metadata.Date `json:"date"`
+
+	// ScanlationGroup of the chapter, from the ComicInfo.xml.
+	ScanlationGroup string `json:"scanlation_group"`
+
+	// Pages is the amount of pages in the chapter.
+	Pages int `json:"pages"`
+
+	// Size in bytes of the chapter (of all its files for FormatImages).
+	Size int64 `json:"size"`
+
+	// ModTime is the last modification time of the chapter
+	// (of any of its files for FormatImages).
+	ModTime time.Time `json:"mod_time"`
+
+	// HasComicInfoXML is true if the chapter has an embedded ComicInfo.xml.
+	HasComicInfoXML bool `json:"has_comicinfo_xml"`
+
+	// Error reading the chapter, empty if it was read correctly.
+	Error string `json:"error,omitempty"`
+}
+
+// LibraryManga is a manga of the library index.
+type LibraryManga struct {
+	// Title of the manga, from the series.json or ComicInfo.xml, else the directory name.
+	Title string `json:"title"`
+
+	// Provider directory name, empty if the library has no provider directories.
+	Provider string `json:"provider"`
+
+	// Dir of the manga, relative to the library directory.
+	//
+	// If the library has no manga directories, it's the directory
+	// the chapters are in, shared by all mangas.
+	Dir string `json:"dir"`
+
+	// SeriesID is the ComicID of the series.json, the
+	// ID of the metadata it was written with (0 if none).
+	SeriesID int `json:"series_id"`
+
+	// HasSeriesJSON is true if the manga directory has a series.json.
+	HasSeriesJSON bool `json:"has_series_json"`
+
+	// HasCover is true if the manga directory has a cover image.
+	HasCover bool `json:"has_cover"`
+
+	// HasBanner is true if the manga directory has a banner image.
+	HasBanner bool `json:"has_banner"`
+
+	// Chapters of the manga, sorted by volume and number.
+	Chapters []LibraryChapter `json:"chapters"`
+}
+
+// String is the manga title, with the provider directory if any.
+func (m LibraryManga) String() string {
+	if m.Provider == "" {
+		return m.Title
+	}
+	return fmt.Sprintf("%s (%s)", m.Title, m.Provider)
+}
+
+// Size is the total size in bytes of the chapters.
+func (m LibraryManga) Size() int64 {
+	var size int64
+	for _, chapter := range m.Chapters {
+		size += chapter.Size
+	}
+	return size
+}
+
+// LibraryOptions describes the layout of the library,
+// same as the DownloadOptions used to download it.
+type LibraryOptions struct {
+	// Directory of the library.
+	Directory string
+
+	// CreateProviderDir if the chapters are in provider directories.
+	CreateProviderDir bool
+
+	// CreateMangaDir if the chapters are in manga directories.
+	//
+	// If false, chapters are grouped into mangas by the
+	// series of their ComicInfo.xml (or their directory).
+	CreateMangaDir bool
+}
+
+// DefaultLibraryOptions constructs default LibraryOptions,
+// matching the DefaultDownloadOptions layout.
+func DefaultLibraryOptions() LibraryOptions {
+	download := DefaultDownloadOptions()
+	return LibraryOptions{
+		Directory:         download.Directory,
+		CreateProviderDir: download.CreateProviderDir,
+		CreateMangaDir:    download.CreateMangaDir,
+	}
+}
+
+// LibraryScanStats are the results of Library.Scan.
+type LibraryScanStats struct {
+	// Mangas in the library.
+	Mangas int
+
+	// Chapters in the library.
+	Chapters int
+
+	// Scanned chapters, the ones that are new or changed since the last scan.
+	Scanned int
+
+	// Removed chapters since the last scan.
+	Removed int
+
+	// Failed chapters that couldn't be read, see LibraryChapter.Error.
+	Failed int
+}
+
+// Library is an index of the downloaded chapters, stored in a gokv.Store.
+//
+// It's built by walking the library directory on the client FS, see Scan.
+// Manga and chapter lookups use the client naming functions.
+type Library struct {
+	client  *Client
+	store   gokv.Store
+	options LibraryOptions
+}
+
+// NewLibrary constructs a new Library on top of the given gokv.Store,
+// which keeps the index between scans.
+func NewLibrary(client *Client, store gokv.Store, options LibraryOptions) (*Library, error) {
+	if client == nil {
+		return nil, errors.New("nil Client passed to Library")
+	}
+	if store == nil {
+		return nil, errors.New("nil gokv.Store passed to Library")
+	}
+
+	return &Library{
+		client:  client,
+		store:   store,
+		options: options,
+	}, nil
+}
+
+// Close closes the underlying store.
+func (l *Library) Close() error {
+	return l.store.Close()
+}
+
+// Scan walks the library directory and updates the index.
+//
+// Only the chapters that are new or changed (by size or modification
+// time) since the last scan are read, removed chapters are dropped. Chapters
+// that can't be read are still indexed with their error, they don't stop the scan.
+func (l *Library) Scan(ctx context.Context) (LibraryScanStats, error) {
+	var stats LibraryScanStats
+	l.client.logger.Log("scanning library %q", l.options.Directory)
+
+	previous, err := l.Mangas()
+	if err != nil {
+		return stats, err
+	}
+	known := make(map[string]LibraryChapter)
+	for _, manga := range previous {
+		for _, chapter := range manga.Chapters {
+			known[chapter.Path] = chapter
+		}
+	}
+
+	type root struct {
+		provider, path string
+	}
+	roots := []root{{path: l.options.Directory}}
+	if l.options.CreateProviderDir {
+		dirs, err := l.subdirectories(l.options.Directory)
+		if err != nil {
+			return stats, err
+		}
+		roots = roots[:0]
+		for _, dir := range dirs {
+			roots = append(roots, root{provider: filepath.Base(dir), path: dir})
+		}
+	}
+
+	var mangas []LibraryManga
+	for _, root := range roots {
+		var scanned []LibraryManga
+		if l.options.CreateMangaDir {
+			dirs, err := l.subdirectories(root.path)
+			if err != nil {
+				return stats, err
+			}
+			for _, dir := range dirs {
+				manga, err := l.scanManga(ctx, dir, known, &stats)
+				if err != nil {
+					return stats, err
+				}
+				if manga != nil {
+					scanned = append(scanned, *manga)
+				}
+			}
+		} else {
+			scanned, err = l.scanLoose(ctx, root.path, known, &stats)
+			if err != nil {
+				return stats, err
+			}
+		}
+
+		for i := range scanned {
+			scanned[i].Provider = root.provider
+		}
+		mangas = append(mangas, scanned...)
+	}
+
+	keys := make([]string, len(mangas))
+	current := make(map[string]bool, len(mangas))
+	for i, manga := range mangas {
+		keys[i] = l.mangaKey(manga)
+		current[keys[i]] = true
+		if err := l.store.Set(libraryKeyMangaPrefix+keys[i], manga); err != nil {
+			return stats, err
+		}
+
+		stats.Chapters += len(manga.Chapters)
+		for _, chapter := range manga.Chapters {
+			delete(known, chapter.Path)
+		}
+	}
+	for _, manga := range previous {
+		if key := l.mangaKey(manga); !current[key] {
+			if err := l.store.Delete(libraryKeyMangaPrefix + key); err != nil {
+				return stats, err
+			}
+		}
+	}
+	sort.Strings(keys)
+	if err := l.store.Set(libraryKeyMangas, keys); err != nil {
+		return stats, err
+	}
+
+	stats.Mangas = len(mangas)
+	stats.Removed = len(known)
+	l.client.logger.Log(
+		"scanned library: %d mangas, %d chapters (%d scanned, %d removed, %d failed)",
+		stats.Mangas, stats.Chapters, stats.Scanned, stats.Removed, stats.Failed,
+	)
+	return stats, nil
+}
+
+// subdirectories returns the non-hidden directories in path,
+// except the ones with images (those are chapters).
+func (l *Library) subdirectories(path string) ([]string, error) {
+	_, dirs, err := scanChapterDir(l.client.options.FS, path)
+	return dirs, err
+}
+
+// scanManga scans the manga directory, nil if it has no chapters.
+func (l *Library) scanManga(
+	ctx context.Context,
+	dir string,
+	known map[string]LibraryChapter,
+	stats *LibraryScanStats,
+) (*LibraryManga, error) {
+	chapters, err := l.scanChapters(ctx, dir, known, stats)
+	if err != nil {
+		return nil, err
+	}
+	if len(chapters) == 0 {
+		return nil, nil
+	}
+
+	fs := l.client.options.FS
+	seriesJSON, err := readSeriesJSON(fs, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	manga := &LibraryManga{
+		Dir:           l.relative(dir),
+		HasSeriesJSON: seriesJSON != nil,
+		Chapters:      chapters,
+	}
+	if seriesJSON != nil {
+		manga.SeriesID = seriesJSON.ComicID
+	}
+	if manga.HasCover, err = afero.Exists(fs, filepath.Join(dir, metadata.FilenameCoverJPG)); err != nil {
+		return nil, err
+	}
+	if manga.HasBanner, err = afero.Exists(fs, filepath.Join(dir, metadata.FilenameBannerJPG)); err != nil {
+		return nil, err
+	}
+
+	// without series.json, the series of the first chapter that has one
+	var comicInfoXML *metadata.ComicInfoXML
+	for _, chapter := range chapters {
+		if chapter.Series != "" {
+			comicInfoXML = &metadata.ComicInfoXML{Series: chapter.Series}
+			break
+		}
+	}
+	manga.Title = localMetadata(filepath.Base(dir), seriesJSON, comicInfoXML).Title()
+	return manga, nil
+}
+
+// scanLoose scans the chapters that are not in manga directories,
+// grouped into mangas by the series of their ComicInfo.xml.
+func (l *Library) scanLoose(
+	ctx context.Context,
+	dir string,
+	known map[string]LibraryChapter,
+	stats *LibraryScanStats,
+) ([]LibraryManga, error) {
+	chapters, err := l.scanChapters(ctx, dir, known, stats)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		mangas []LibraryManga
+		series = make(map[string]int)
+	)
+	for _, chapter := range chapters {
+		title := chapter.Series
+		if title == "" {
+			title = filepath.Base(dir)
+		}
+
+		i, ok := series[title]
+		if !ok {
+			i = len(mangas)
+			series[title] = i
+			mangas = append(mangas, LibraryManga{Title: title, Dir: l.relative(dir)})
+		}
+		mangas[i].Chapters = append(mangas[i].Chapters, chapter)
+	}
+	return mangas, nil
+}
+
+// scanChapters scans the chapters in dir and its volume directories.
+func (l *Library) scanChapters(
+	ctx context.Context,
+	dir string,
+	known map[string]LibraryChapter,
+	stats *LibraryScanStats,
+) ([]LibraryChapter, error) {
+	fs := l.client.options.FS
+	found, volumeDirs, err := scanChapterDir(fs, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	volumes := make(map[*localChapter]float32)
+	for _, volumeDir := range volumeDirs {
+		volumeChapters, _, err := scanChapterDir(fs, volumeDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, chapter := range volumeChapters {
+			volumes[chapter] = parseNumber(filepath.Base(volumeDir))
+		}
+		found = append(found, volumeChapters...)
+	}
+
+	chapters := make([]LibraryChapter, 0, len(found))
+	for _, chapter := range found {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		size, modTime, err := chapterStat(fs, chapter.path, chapter.format)
+		if err != nil {
+			return nil, err
+		}
+
+		path := l.relative(chapter.path)
+		if previous, ok := known[path]; ok && previous.Format == chapter.format &&
+			previous.Size == size && previous.ModTime.Equal(modTime) {
+			previous.Volume = volumes[chapter]
+			chapters = append(chapters, previous)
+			continue
+		}
+
+		stats.Scanned++
+		indexed := l.readChapter(chapter)
+		indexed.Path = path
+		indexed.Volume = volumes[chapter]
+		indexed.Size = size
+		indexed.ModTime = modTime
+		if indexed.Error != "" {
+			stats.Failed++
+			l.client.logger.Log("error reading chapter %q: %s", chapter.path, indexed.Error)
+		}
+		chapters = append(chapters, indexed)
+	}
+
+	sort.SliceStable(chapters, func(i, j int) bool {
+		a, b := chapters[i], chapters[j]
+		if a.Volume != b.Volume {
+			return a.Volume < b.Volume
+		}
+		if a.Number != b.Number {
+			return a.Number < b.Number
+		}
+		return naturalLess(a.Path, b.Path)
+	})
+	return chapters, nil
+}
+
+// readChapter reads the information and page count of the chapter.
+//
+// Errors are set to the chapter, the information
+// is still parsed from the name in that case.
+func (l *Library) readChapter(chapter *localChapter) LibraryChapter {
+	fs := l.client.options.FS
+	indexed := LibraryChapter{Format: chapter.format}
+
+	var (
+		comicInfoXML *metadata.ComicInfoXML
+		err          error
+	)
+	if chapter.format == FormatPDF {
+		// don't extract the images just to count them
+		indexed.Pages, err = pdfPageCount(fs, chapter.path)
+	} else {
+		var reader *ChapterReader
+		reader, err = openChapter(fs, chapter.path, chapter.format)
+		if err == nil {
+			indexed.Pages = len(reader.Pages())
+			comicInfoXML = reader.ComicInfoXML()
+			reader.Close()
+		}
+	}
+	if err != nil {
+		indexed.Error = err.Error()
+	}
+
+	info := localChapterInfo(chapter.path, chapter.format, comicInfoXML)
+	indexed.Number = info.Number
+	indexed.Title = info.Title
+	indexed.URL = info.URL
+	indexed.Date = info.Date
+	indexed.ScanlationGroup = info.ScanlationGroup
+	indexed.HasComicInfoXML = comicInfoXML != nil
+	if comicInfoXML != nil {
+		indexed.Series = comicInfoXML.Series
+	}
+	return indexed
+}
+
+func pdfPageCount(fs afero.Fs, path string) (int, error) {
+	file, err := fs.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	return api.PageCount(file, model.NewDefaultConfiguration())
+}
+
+// chapterStat returns the size and modification time of the chapter,
+// for FormatImages the total size and latest time of its files.
+func chapterStat(fs afero.Fs, path string, format Format) (int64, time.Time, error) {
+	info, err := fs.Stat(path)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if format != FormatImages {
+		return info.Size(), info.ModTime(), nil
+	}
+
+	var size int64
+	modTime := info.ModTime()
+	entries, err := afero.ReadDir(fs, path)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		size += entry.Size()
+		if entry.ModTime().After(modTime) {
+			modTime = entry.ModTime()
+		}
+	}
+	return size, modTime, nil
+}
+
+// relative returns the path relative to the library directory.
+func (l *Library) relative(path string) string {
+	rel, err := filepath.Rel(l.options.Directory, path)
+	if err != nil {
+		return path
+	}
+	return rel
+}
+
+// manifestDir is the directory of the manifest of the manga, the
+// library directory if the library has no manga directories.
+func (l *Library) manifestDir(manga LibraryManga) string {
+	if l.options.CreateMangaDir {
+		return filepath.Join(l.options.Directory, manga.Dir)
+	}
+	return l.options.Directory
+}
+
+// mangaKey is the key of the manga in the index.
+func (l *Library) mangaKey(manga LibraryManga) string {
+	if l.options.CreateMangaDir {
+		return filepath.ToSlash(manga.Dir)
+	}
+	return filepath.ToSlash(manga.Dir) + "#" + manga.Title
+}
+
+// Mangas returns all the mangas in the index, sorted by their key.
+func (l *Library) Mangas() ([]LibraryManga, error) {
+	var keys []string
+	if _, err := l.store.Get(libraryKeyMangas, &keys); err != nil {
+		return nil, err
+	}
+
+	mangas := make([]LibraryManga, 0, len(keys))
+	for _, key := range keys {
+		var manga LibraryManga
+		found, err := l.store.Get(libraryKeyMangaPrefix+key, &manga)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			mangas = append(mangas, manga)
+		}
+	}
+	return mangas, nil
+}
+
+// Manga returns the indexed manga, located by the client naming functions
+// (ClientOptions.ProviderName and ClientOptions.MangaName). If the library
+// has no manga directories it's located by its title or metadata title.
+func (l *Library) Manga(manga mangadata.Manga) (LibraryManga, bool, error) {
+	dir := ""
+	if l.options.CreateProviderDir {
+		dir = l.client.ProviderName(l.client.Info())
+	}
+
+	var keys []string
+	if l.options.CreateMangaDir {
+		keys = append(keys, filepath.ToSlash(filepath.Join(dir, l.client.MangaName(manga))))
+	} else {
+		if dir == "" {
+			dir = "."
+		}
+		keys = append(keys, filepath.ToSlash(dir)+"#"+manga.Info().Title)
+		if meta := manga.Metadata(); meta != nil && meta.Title() != "" {
+			keys = append(keys, filepath.ToSlash(dir)+"#"+meta.Title())
+		}
+	}
+
+	for _, key := range keys {
+		var indexed LibraryManga
+		found, err := l.store.Get(libraryKeyMangaPrefix+key, &indexed)
+		if err != nil || found {
+			return indexed, found, err
+		}
+	}
+	return LibraryManga{}, false, nil
+}
+
+// MangaChapters returns the indexed chapters of the manga, see Manga.
+func (l *Library) MangaChapters(manga mangadata.Manga) ([]LibraryChapter, error) {
+	indexed, _, err := l.Manga(manga)
+	if err != nil {
+		return nil, err
+	}
+	return indexed.Chapters, nil
+}
+
+// Chapter returns the indexed chapter of its manga (see Manga).
+//
+// The chapter is matched by its name (ClientOptions.ChapterName) in any
+// format, else by its number and scanlation group (if both have one).
+func (l *Library) Chapter(chapter mangadata.Chapter) (LibraryChapter, bool, error) {
+	chapters, err := l.MangaChapters(chapter.Volume().Manga())
+	if err != nil {
+		return LibraryChapter{}, false, err
+	}
+
+	name := l.client.ChapterName(chapter, FormatImages)
+	for _, indexed := range chapters {
+		base := filepath.Base(indexed.Path)
+		if base[:len(base)-len(indexed.Format.Extension())] == name {
+			return indexed, true, nil
+		}
+	}
+
+	info := chapter.Info()
+	for _, indexed := range chapters {
+		if indexed.Number != info.Number {
+			continue
+		}
+		if info.ScanlationGroup != "" && indexed.ScanlationGroup != "" &&
+			!strings.EqualFold(info.ScanlationGroup, indexed.ScanlationGroup) {
+			continue
+		}
+		return indexed, true, nil
+	}
+	return LibraryChapter{}, false, nil
+}
@@ -0,0 +1,349 @@
+package libmangal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"math"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/luevano/libmangal/metadata"
+)
+
+// DeleteOptions configures the Library delete operations.
+type DeleteOptions struct {
+	// DryRun only plans the deletion, nothing is removed.
+	DryRun bool
+}
+
+// DefaultDeleteOptions constructs default DeleteOptions.
+func DefaultDeleteOptions() DeleteOptions {
+	return DeleteOptions{
+		DryRun: false,
+	}
+}
+
+// DeletePlan is the result of the Library delete operations.
+type DeletePlan struct {
+	// Chapters deleted (or to delete on a dry run).
+	Chapters []LibraryChapter `json:"chapters"`
+
+	// Files are the manga files deleted along with the chapters
+	// (series.json, cover, banner and manifest), when their manga
+	// is left without chapters.
+	Files []string `json:"files"`
+
+	// Size in bytes freed.
+	Size int64 `json:"size"`
+}
+
+// add appends the other plan.
+func (p *DeletePlan) add(other DeletePlan) {
+	p.Chapters = append(p.Chapters, other.Chapters...)
+	p.Files = append(p.Files, other.Files...)
+	p.Size += other.Size
+}
+
+// DeleteChapters deletes the chapters of the indexed manga (see Mangas).
+//
+// Their manifest entries (see Manifest) and index entries are removed too,
+// as well as the directories left empty. If the manga is left without
+// chapters, its files (series.json, cover, banner and manifest) are deleted,
+// unless the library has no manga directories.
+func (l *Library) DeleteChapters(manga LibraryManga, chapters []LibraryChapter, options DeleteOptions) (DeletePlan, error) {
+	var plan DeletePlan
+
+	indexed, err := l.indexedManga(manga)
+	if err != nil {
+		return plan, err
+	}
+
+	known := make(map[string]bool, len(indexed.Chapters))
+	for _, chapter := range indexed.Chapters {
+		known[chapter.Path] = true
+	}
+	deleted := make(map[string]bool, len(chapters))
+	for _, chapter := range chapters {
+		if !known[chapter.Path] {
+			return plan, fmt.Errorf("chapter %q is not in manga %q", chapter.Path, indexed)
+		}
+		deleted[chapter.Path] = true
+	}
+
+	var remaining []LibraryChapter
+	for _, chapter := range indexed.Chapters {
+		if deleted[chapter.Path] {
+			plan.Chapters = append(plan.Chapters, chapter)
+			plan.Size += chapter.Size
+		} else {
+			remaining = append(remaining, chapter)
+		}
+	}
+
+	fs := l.client.options.FS
+	mangaDir := filepath.Join(l.options.Directory, indexed.Dir)
+	if len(remaining) == 0 && l.options.CreateMangaDir {
+		for _, name := range []string{
+			metadata.FilenameSeriesJSON,
+			metadata.FilenameCoverJPG,
+			metadata.FilenameBannerJPG,
+			FilenameManifest,
+		} {
+			path := filepath.Join(mangaDir, name)
+			info, err := fs.Stat(path)
+			if errors.Is(err, iofs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return plan, err
+			}
+			plan.Files = append(plan.Files, path)
+			plan.Size += info.Size()
+		}
+	}
+
+	if options.DryRun || len(plan.Chapters) == 0 {
+		return plan, nil
+	}
+
+	manifestDir := l.manifestDir(indexed)
+	var recorded []string
+	emptied := make(map[string]bool)
+	for _, chapter := range plan.Chapters {
+		path := filepath.Join(l.options.Directory, chapter.Path)
+		if err := l.client.removeChapter(path); err != nil && !errors.Is(err, iofs.ErrNotExist) {
+			return plan, err
+		}
+		emptied[filepath.Dir(path)] = true
+		if rel, err := filepath.Rel(manifestDir, path); err == nil {
+			recorded = append(recorded, rel)
+		}
+	}
+
+	if err := updateManifest(fs, manifestDir, l.client.options.ModeFile, func(manifest *Manifest) {
+		for _, rel := range recorded {
+			manifest.Remove(rel)
+		}
+	}); err != nil {
+		return plan, err
+	}
+
+	for _, path := range plan.Files {
+		l.client.logger.Log("removing %s", path)
+		if err := fs.Remove(path); err != nil && !errors.Is(err, iofs.ErrNotExist) {
+			return plan, err
+		}
+	}
+	for dir := range emptied {
+		if err := removeEmptyDirs(fs, dir, l.options.Directory); err != nil {
+			return plan, err
+		}
+	}
+
+	indexed.Chapters = remaining
+	return plan, l.updateIndex(indexed)
+}
+
+// DeleteVolume deletes the chapters of the volume of the indexed manga, see DeleteChapters.
+func (l *Library) DeleteVolume(manga LibraryManga, volume float32, options DeleteOptions) (DeletePlan, error) {
+	indexed, err := l.indexedManga(manga)
+	if err != nil {
+		return DeletePlan{}, err
+	}
+
+	var chapters []LibraryChapter
+	for _, chapter := range indexed.Chapters {
+		if chapter.Volume == volume {
+			chapters = append(chapters, chapter)
+		}
+	}
+	return l.DeleteChapters(indexed, chapters, options)
+}
+
+// DeleteManga deletes all the chapters of the indexed manga, see DeleteChapters.
+func (l *Library) DeleteManga(manga LibraryManga, options DeleteOptions) (DeletePlan, error) {
+	indexed, err := l.indexedManga(manga)
+	if err != nil {
+		return DeletePlan{}, err
+	}
+	return l.DeleteChapters(indexed, indexed.Chapters, options)
+}
+
+// indexedManga returns the current index entry of the manga.
+func (l *Library) indexedManga(manga LibraryManga) (LibraryManga, error) {
+	var indexed LibraryManga
+	found, err := l.store.Get(libraryKeyMangaPrefix+l.mangaKey(manga), &indexed)
+	if err != nil {
+		return indexed, err
+	}
+	if !found {
+		return indexed, fmt.Errorf("manga %q is not in the library", manga)
+	}
+	return indexed, nil
+}
+
+// updateIndex stores the manga, it's removed from the index if it has no chapters.
+func (l *Library) updateIndex(manga LibraryManga) error {
+	key := l.mangaKey(manga)
+	if len(manga.Chapters) != 0 {
+		return l.store.Set(libraryKeyMangaPrefix+key, manga)
+	}
+
+	var keys []string
+	if _, err := l.store.Get(libraryKeyMangas, &keys); err != nil {
+		return err
+	}
+	for i, existing := range keys {
+		if existing == key {
+			keys = append(keys[:i], keys[i+1:]...)
+			break
+		}
+	}
+	if err := l.store.Set(libraryKeyMangas, keys); err != nil {
+		return err
+	}
+	return l.store.Delete(libraryKeyMangaPrefix + key)
+}
+
+// RetentionPolicy selects the chapters deleted by Library.Prune.
+//
+// A chapter is deleted if any of the enabled rules applies to it.
+type RetentionPolicy struct {
+	// KeepLast keeps only the last N chapters (by number) of each
+	// manga. Chapters with the same number are ranked by volume, those
+	// not in a volume yet being the latest. 0 disables the rule.
+	KeepLast int
+
+	// ReadOlderThan deletes the chapters last read longer
+	// ago than this, according to History. 0 disables the rule.
+	ReadOlderThan time.Duration
+
+	// History of the read chapters, used by ReadOlderThan.
+	//
+	// Entries are matched by provider and manga IDs of the chapter manifest
+	// entry (see Manifest), or of the local provider (see NewLocalProviderLoader)
+	// if it has none, and by the chapter number.
+	History []HistoryEntry
+
+	// DryRun only plans the deletion, nothing is removed.
+	DryRun bool
+}
+
+// DefaultRetentionPolicy constructs a default RetentionPolicy,
+// with no rules enabled.
+func DefaultRetentionPolicy() RetentionPolicy {
+	return RetentionPolicy{
+		KeepLast:      0,
+		ReadOlderThan: 0,
+		History:       nil,
+		DryRun:        true,
+	}
+}
+
+// Prune deletes the chapters of the library index selected by the
+// retention policy, see DeleteChapters.
+func (l *Library) Prune(ctx context.Context, policy RetentionPolicy) (DeletePlan, error) {
+	var plan DeletePlan
+
+	mangas, err := l.Mangas()
+	if err != nil {
+		return plan, err
+	}
+
+	now := time.Now()
+	for _, indexed := range mangas {
+		if err := ctx.Err(); err != nil {
+			return plan, err
+		}
+
+		var manifest Manifest
+		if policy.ReadOlderThan > 0 {
+			if manifest, err = ReadManifest(l.client.options.FS, l.manifestDir(indexed)); err != nil {
+				return plan, err
+			}
+		}
+
+		kept := lastChapters(indexed.Chapters, policy.KeepLast)
+		var chapters []LibraryChapter
+		for _, chapter := range indexed.Chapters {
+			expired := policy.KeepLast > 0 && !kept[chapter.Path]
+			if !expired && policy.ReadOlderThan > 0 {
+				readAt := l.readAt(indexed, chapter, manifest, policy.History)
+				expired = !readAt.IsZero() && now.Sub(readAt) > policy.ReadOlderThan
+			}
+			if expired {
+				chapters = append(chapters, chapter)
+			}
+		}
+		if len(chapters) == 0 {
+			continue
+		}
+
+		l.client.logger.Log("pruning %d chapters of %q", len(chapters), indexed)
+		deleted, err := l.DeleteChapters(indexed, chapters, DeleteOptions{DryRun: policy.DryRun})
+		if err != nil {
+			return plan, err
+		}
+		plan.add(deleted)
+	}
+	return plan, nil
+}
+
+// lastChapters returns the paths of the last n chapters by number, see
+// RetentionPolicy.KeepLast. The index is sorted by volume first, and chapters
+// not in a volume (usually the newest) have volume 0.
+func lastChapters(chapters []LibraryChapter, n int) map[string]bool {
+	ranked := slices.Clone(chapters)
+	volumeRank := func(volume float32) float32 {
+		if volume == 0 {
+			return math.MaxFloat32
+		}
+		return volume
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := chapterNumberKey(ranked[i].Number), chapterNumberKey(ranked[j].Number)
+		if a != b {
+			return a < b
+		}
+		return volumeRank(ranked[i].Volume) < volumeRank(ranked[j].Volume)
+	})
+
+	last := make(map[string]bool, n)
+	for _, chapter := range ranked[max(len(ranked)-n, 0):] {
+		last[chapter.Path] = true
+	}
+	return last
+}
+
+// readAt returns the last time the chapter was read, zero if it's not in the history.
+func (l *Library) readAt(
+	manga LibraryManga,
+	chapter LibraryChapter,
+	manifest Manifest,
+	history []HistoryEntry,
+) time.Time {
+	providerID, mangaID := LocalProviderInfo.ID, filepath.Base(manga.Dir)
+	path := filepath.Join(l.options.Directory, chapter.Path)
+	if rel, err := filepath.Rel(l.manifestDir(manga), path); err == nil {
+		if entry, ok := manifest.Path(rel); ok {
+			providerID, mangaID = entry.ProviderID, entry.MangaID
+		}
+	}
+
+	var readAt time.Time
+	key := chapterNumberKey(chapter.Number)
+	for _, entry := range history {
+		if entry.ProviderID != providerID || entry.MangaID != mangaID ||
+			chapterNumberKey(float32(entry.ChapterNumber)) != key {
+			continue
+		}
+		if entry.ReadAt.After(readAt) {
+			readAt = entry.ReadAt
+		}
+	}
+	return readAt
+}
@@ -0,0 +1,189 @@
+package libmangal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/philippgille/gokv/syncmap"
+	"github.com/spf13/afero"
+)
+
+// newTestLibrary writes and scans a library with a manga with chapters 1 and 2
+// in volume 1, and chapter 3 not in a volume yet, all recorded in the manifest.
+func newTestLibrary(t *testing.T) (*Library, afero.Fs) {
+	t.Helper()
+
+	fs := afero.NewMemMapFs()
+	chapters := []string{
+		"Vol. 1/[0001.0] One.cbz",
+		"Vol. 1/[0002.0] Two.cbz",
+		"[0003.0] Three.cbz",
+	}
+	for i, path := range chapters {
+		writeTestCBZ(t, fs, "library/Berserk/"+path, testFile{"001.png", testPNG(t)})
+		if err := updateManifest(fs, "library/Berserk", 0o644, func(manifest *Manifest) {
+			manifest.Set(ManifestChapter{
+				ProviderID: "fake",
+				MangaID:    "berserk",
+				Number:     float32(i + 1),
+				Path:       path,
+				Format:     FormatCBZ,
+			})
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"series.json", "cover.jpg"} {
+		if err := afero.WriteFile(fs, "library/Berserk/"+name, []byte("{}"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	options := DefaultLibraryOptions()
+	options.Directory = "library"
+	library, err := NewLibrary(newTestClient(t, fs, "library"), syncmap.NewStore(syncmap.DefaultOptions), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { library.Close() })
+	if _, err := library.Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return library, fs
+}
+
+func chapterNumbers(chapters []LibraryChapter) []float32 {
+	numbers := make([]float32, len(chapters))
+	for i, chapter := range chapters {
+		numbers[i] = chapter.Number
+	}
+	return numbers
+}
+
+func equalNumbers(a, b []float32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPruneKeepLast(t *testing.T) {
+	library, fs := newTestLibrary(t)
+
+	policy := DefaultRetentionPolicy()
+	policy.KeepLast = 1
+	plan, err := library.Prune(context.Background(), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// chapter 3 is the latest even if it's not in a volume
+	if got := chapterNumbers(plan.Chapters); !equalNumbers(got, []float32{1, 2}) {
+		t.Fatalf("planned to delete chapters %v, want [1 2]", got)
+	}
+	for _, path := range []string{"library/Berserk/Vol. 1/[0001.0] One.cbz", "library/Berserk/Vol. 1/[0002.0] Two.cbz"} {
+		if ok, _ := afero.Exists(fs, path); !ok {
+			t.Errorf("%q was removed on a dry run", path)
+		}
+	}
+
+	policy.DryRun = false
+	if _, err := library.Prune(context.Background(), policy); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := afero.Exists(fs, "library/Berserk/Vol. 1"); ok {
+		t.Error("the emptied volume directory was not removed")
+	}
+	if ok, _ := afero.Exists(fs, "library/Berserk/[0003.0] Three.cbz"); !ok {
+		t.Error("the kept chapter was removed")
+	}
+
+	manifest, err := ReadManifest(fs, "library/Berserk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Chapters) != 1 || manifest.Chapters[0].Path != "[0003.0] Three.cbz" {
+		t.Errorf("manifest has %+v, want only chapter 3", manifest.Chapters)
+	}
+
+	mangas, err := library.Mangas()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mangas) != 1 || !equalNumbers(chapterNumbers(mangas[0].Chapters), []float32{3}) {
+		t.Errorf("index has %+v, want only chapter 3", mangas)
+	}
+}
+
+func TestPruneReadOlderThan(t *testing.T) {
+	library, _ := newTestLibrary(t)
+
+	policy := DefaultRetentionPolicy()
+	policy.ReadOlderThan = 24 * time.Hour
+	policy.History = []HistoryEntry{
+		{ProviderID: "fake", MangaID: "berserk", ChapterNumber: 1, ReadAt: time.Now().Add(-48 * time.Hour)},
+		{ProviderID: "fake", MangaID: "berserk", ChapterNumber: 2, ReadAt: time.Now().Add(-time.Hour)},
+		// other manga
+		{ProviderID: "fake", MangaID: "other", ChapterNumber: 3, ReadAt: time.Now().Add(-48 * time.Hour)},
+	}
+	plan, err := library.Prune(context.Background(), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := chapterNumbers(plan.Chapters); !equalNumbers(got, []float32{1}) {
+		t.Errorf("planned to delete chapters %v, want [1]", got)
+	}
+}
+
+func TestDeleteManga(t *testing.T) {
+	library, fs := newTestLibrary(t)
+	mangas, err := library.Mangas()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := library.DeleteManga(mangas[0], DeleteOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Chapters) != 3 || len(plan.Files) != 3 {
+		t.Errorf("planned to delete %d chapters and files %q, want 3 and series.json, cover and manifest", len(plan.Chapters), plan.Files)
+	}
+	if plan.Size == 0 {
+		t.Error("planned to free no space")
+	}
+	if ok, _ := afero.Exists(fs, "library/Berserk/[0003.0] Three.cbz"); !ok {
+		t.Error("chapter removed on a dry run")
+	}
+
+	if _, err := library.DeleteManga(mangas[0], DefaultDeleteOptions()); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := afero.Exists(fs, "library/Berserk"); ok {
+		t.Error("the manga directory was not removed")
+	}
+	if ok, _ := afero.Exists(fs, "library"); !ok {
+		t.Error("the library directory was removed")
+	}
+	if mangas, err := library.Mangas(); err != nil || len(mangas) != 0 {
+		t.Errorf("index has %+v (%v), want none", mangas, err)
+	}
+}
+
+func TestDeleteChaptersUnknown(t *testing.T) {
+	library, _ := newTestLibrary(t)
+	mangas, err := library.Mangas()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = library.DeleteChapters(mangas[0], []LibraryChapter{{Path: "Berserk/missing.cbz"}}, DefaultDeleteOptions())
+	if err == nil {
+		t.Error("no error deleting a chapter not in the manga")
+	}
+}
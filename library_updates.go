@@ -0,0 +1,271 @@
+package libmangal
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/luevano/libmangal/mangadata"
+)
+
+// ChapterUpdate is a chapter number available in the
+// provider that is not in the library.
+type ChapterUpdate struct {
+	// Number of the chapter.
+	Number float32
+
+	// Chapter to download. If there are chapters of multiple scanlation
+	// groups, the one of the group most used in the library is preferred,
+	// else the first one returned by the provider.
+	Chapter mangadata.Chapter
+
+	// Alternatives are the other chapters with the same
+	// number (of other scanlation groups), if any.
+	Alternatives []mangadata.Chapter
+}
+
+// MangaUpdates is the comparison of a manga in the library with its provider.
+//
+// Chapters are compared by number regardless of the scanlation group,
+// fractional numbers (e.g. 10.5) are different chapters. Chapters without
+// number (0, e.g. oneshots or extras) are compared by title.
+type MangaUpdates struct {
+	// Library is the indexed manga.
+	Library LibraryManga
+
+	// Manga found in the provider, nil if it wasn't found.
+	Manga mangadata.Manga
+
+	// New chapters, after the latest chapter in the library.
+	New []ChapterUpdate
+
+	// Missing chapters, before the latest chapter in the library.
+	Missing []ChapterUpdate
+
+	// Gaps are the whole chapter numbers that are neither in the library
+	// nor in the provider, between the first and last known chapters.
+	Gaps []int
+
+	// Orphaned chapters of the library that are no longer in the provider.
+	Orphaned []LibraryChapter
+
+	// Error while checking the manga, empty if it was checked correctly.
+	Error string
+}
+
+// Chapters returns the chapters to download to be up to date,
+// the Missing and New ones in order.
+func (u MangaUpdates) Chapters() []mangadata.Chapter {
+	chapters := make([]mangadata.Chapter, 0, len(u.Missing)+len(u.New))
+	for _, update := range u.Missing {
+		chapters = append(chapters, update.Chapter)
+	}
+	for _, update := range u.New {
+		chapters = append(chapters, update.Chapter)
+	}
+	return chapters
+}
+
+// CheckUpdates compares each manga of the library index (see Scan) that
+// belongs to the client provider with the chapters in the provider.
+//
+// Mangas are searched in the provider by title and matched by the
+// client naming functions (ClientOptions.MangaName). Mangas that can't be
+// checked have their MangaUpdates.Error set, they don't stop the check.
+func (l *Library) CheckUpdates(ctx context.Context) ([]MangaUpdates, error) {
+	mangas, err := l.Mangas()
+	if err != nil {
+		return nil, err
+	}
+
+	provider := l.client.ProviderName(l.client.Info())
+	var reports []MangaUpdates
+	for _, indexed := range mangas {
+		if l.options.CreateProviderDir && indexed.Provider != provider {
+			continue
+		}
+
+		report := MangaUpdates{Library: indexed}
+		manga, err := l.findManga(ctx, indexed)
+		if err == nil && manga == nil {
+			err = fmt.Errorf("manga %q not found in %s", indexed.Title, l.client)
+		}
+		if err == nil {
+			report, err = l.compareChapters(ctx, indexed, manga)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			report.Error = err.Error()
+			l.client.logger.Log("error checking updates of %q: %s", indexed.Title, report.Error)
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// CheckMangaUpdates compares the chapters of the manga in
+// the library index (see Library.Manga) and in the provider.
+func (l *Library) CheckMangaUpdates(ctx context.Context, manga mangadata.Manga) (MangaUpdates, error) {
+	indexed, _, err := l.Manga(manga)
+	if err != nil {
+		return MangaUpdates{}, err
+	}
+	return l.compareChapters(ctx, indexed, manga)
+}
+
+// findManga searches the indexed manga in the provider, nil if not found.
+func (l *Library) findManga(ctx context.Context, indexed LibraryManga) (mangadata.Manga, error) {
+	queries := []string{indexed.Title}
+	if dir := filepath.Base(indexed.Dir); l.options.CreateMangaDir && dir != indexed.Title {
+		queries = append(queries, dir)
+	}
+
+	for _, query := range queries {
+		l.client.logger.Log("searching %q in %s", query, l.client)
+		mangas, err := l.client.SearchMangas(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, manga := range mangas {
+			if l.options.CreateMangaDir {
+				if l.client.MangaName(manga) == filepath.Base(indexed.Dir) {
+					return manga, nil
+				}
+				continue
+			}
+			if strings.EqualFold(manga.Info().Title, indexed.Title) ||
+				manga.Metadata() != nil && strings.EqualFold(manga.Metadata().Title(), indexed.Title) {
+				return manga, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// chapterNumberKey is used to compare chapter numbers, rounded to
+// two decimals as the numbers parsed from names can be less precise.
+func chapterNumberKey(number float32) int64 {
+	return int64(math.Round(float64(number) * 100))
+}
+
+func (l *Library) compareChapters(
+	ctx context.Context,
+	indexed LibraryManga,
+	manga mangadata.Manga,
+) (MangaUpdates, error) {
+	report := MangaUpdates{Library: indexed, Manga: manga}
+
+	chapters, err := l.client.MangaChapters(ctx, manga)
+	if err != nil {
+		return report, err
+	}
+
+	var (
+		owned    = make(map[chapterKey]bool)
+		latest   = math.Inf(-1)
+		groups   = make(map[string]int)
+		byNumber = make(map[chapterKey][]mangadata.Chapter)
+		numbers  []chapterKey
+	)
+	for _, chapter := range indexed.Chapters {
+		owned[newChapterKey(chapter.Number, chapter.Title)] = true
+		latest = math.Max(latest, float64(chapter.Number))
+		if chapter.ScanlationGroup != "" {
+			groups[strings.ToLower(chapter.ScanlationGroup)]++
+		}
+	}
+	for _, chapter := range chapters {
+		info := chapter.Info()
+		key := newChapterKey(info.Number, info.Title)
+		if _, ok := byNumber[key]; !ok {
+			numbers = append(numbers, key)
+		}
+		byNumber[key] = append(byNumber[key], chapter)
+	}
+	sort.SliceStable(numbers, func(i, j int) bool { return numbers[i].number < numbers[j].number })
+
+	// the groups most used in the library first
+	options := DefaultChapterSelectOptions()
+	for group := range groups {
+		options.PreferredGroups = append(options.PreferredGroups, group)
+	}
+	sort.Slice(options.PreferredGroups, func(i, j int) bool {
+		a, b := options.PreferredGroups[i], options.PreferredGroups[j]
+		if groups[a] != groups[b] {
+			return groups[a] > groups[b]
+		}
+		return a < b
+	})
+
+	for _, key := range numbers {
+		if owned[key] {
+			continue
+		}
+
+		candidates := byNumber[key]
+		preferred, err := l.client.selectChapter(ctx, candidates, options)
+		if err != nil {
+			return report, err
+		}
+		update := ChapterUpdate{
+			Number:  candidates[preferred].Info().Number,
+			Chapter: candidates[preferred],
+		}
+		for i, chapter := range candidates {
+			if i != preferred {
+				update.Alternatives = append(update.Alternatives, chapter)
+			}
+		}
+
+		if float64(update.Number) > latest {
+			report.New = append(report.New, update)
+		} else {
+			report.Missing = append(report.Missing, update)
+		}
+	}
+
+	for _, chapter := range indexed.Chapters {
+		if _, ok := byNumber[newChapterKey(chapter.Number, chapter.Title)]; !ok {
+			report.Orphaned = append(report.Orphaned, chapter)
+		}
+	}
+
+	report.Gaps = chapterGaps(indexed.Chapters, chapters)
+	return report, nil
+}
+
+// chapterGaps returns the whole chapter numbers that are neither in the
+// library nor the provider, between the first and last known chapters.
+//
+// Chapters without number (0) are not taken into account.
+func chapterGaps(indexed []LibraryChapter, chapters []mangadata.Chapter) []int {
+	known := make(map[int]bool)
+	first, last := math.MaxInt, math.MinInt
+	add := func(number float32) {
+		if chapterNumberKey(number) == 0 {
+			return
+		}
+		whole := int(math.Floor(float64(number)))
+		known[whole] = true
+		first, last = min(first, whole), max(last, whole)
+	}
+	for _, chapter := range indexed {
+		add(chapter.Number)
+	}
+	for _, chapter := range chapters {
+		add(chapter.Info().Number)
+	}
+
+	var gaps []int
+	for number := first + 1; number < last; number++ {
+		if !known[number] {
+			gaps = append(gaps, number)
+		}
+	}
+	return gaps
+}
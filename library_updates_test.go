@@ -0,0 +1,142 @@
+package libmangal
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/luevano/libmangal/mangadata"
+	"github.com/philippgille/gokv/syncmap"
+	"github.com/spf13/afero"
+)
+
+func chapterInfos(chapters []mangadata.Chapter) []mangadata.ChapterInfo {
+	infos := make([]mangadata.ChapterInfo, len(chapters))
+	for i, chapter := range chapters {
+		infos[i] = chapter.Info()
+	}
+	return infos
+}
+
+func updateInfos(updates []ChapterUpdate) []mangadata.ChapterInfo {
+	infos := make([]mangadata.ChapterInfo, len(updates))
+	for i, update := range updates {
+		infos[i] = update.Chapter.Info()
+	}
+	return infos
+}
+
+func TestCompareChapters(t *testing.T) {
+	var (
+		one     = mangadata.ChapterInfo{Number: 1, Title: "One", ScanlationGroup: "A"}
+		twoA    = mangadata.ChapterInfo{Number: 2, Title: "Two", ScanlationGroup: "A"}
+		twoB    = mangadata.ChapterInfo{Number: 2, Title: "Two", ScanlationGroup: "B"}
+		three   = mangadata.ChapterInfo{Number: 3, Title: "Three", ScanlationGroup: "B"}
+		ten     = mangadata.ChapterInfo{Number: 10, Title: "Ten", ScanlationGroup: "A"}
+		tenHalf = mangadata.ChapterInfo{Number: 10.5, Title: "Ten and a half", ScanlationGroup: "A"}
+		twelve  = mangadata.ChapterInfo{Number: 12, Title: "Twelve", ScanlationGroup: "A"}
+		oneshot = mangadata.ChapterInfo{Title: "Oneshot"}
+		extra   = mangadata.ChapterInfo{Title: "Extra"}
+	)
+	provider := &fakeProvider{mangas: []*fakeManga{
+		newFakeManga("berserk", "Berserk", one, twoA, twoB, three, ten, tenHalf, twelve, oneshot, extra),
+	}}
+	client := newFakeClient(t, afero.NewMemMapFs(), provider)
+	library, err := NewLibrary(client, syncmap.NewStore(syncmap.DefaultOptions), DefaultLibraryOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer library.Close()
+
+	indexed := LibraryManga{
+		Title: "Berserk",
+		Dir:   "Berserk",
+		Chapters: []LibraryChapter{
+			{Number: 1, Title: "One", ScanlationGroup: "B", Path: "Berserk/[0001.0] One.cbz"},
+			{Number: 3, Title: "Three", ScanlationGroup: "B", Path: "Berserk/[0003.0] Three.cbz"},
+			{Number: 4, Title: "Four", ScanlationGroup: "B", Path: "Berserk/[0004.0] Four.cbz"},
+			{Number: 10, Title: "Ten", ScanlationGroup: "A", Path: "Berserk/[0010.0] Ten.cbz"},
+			{Number: 0, Title: "oneshot", Path: "Berserk/[0000.0] oneshot.cbz"},
+		},
+	}
+	report, err := library.compareChapters(context.Background(), indexed, provider.mangas[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the extra is not owned because of the oneshot, and chapter 2 is
+	// of the group most used in the library, with the other as alternative
+	if got, want := updateInfos(report.Missing), []mangadata.ChapterInfo{extra, twoB}; !slices.Equal(got, want) {
+		t.Errorf("missing %+v, want %+v", got, want)
+	}
+	if len(report.Missing) == 2 {
+		if got := chapterInfos(report.Missing[1].Alternatives); !slices.Equal(got, []mangadata.ChapterInfo{twoA}) {
+			t.Errorf("alternatives of chapter 2 are %+v, want %+v", got, twoA)
+		}
+		if alternatives := report.Missing[0].Alternatives; len(alternatives) != 0 {
+			t.Errorf("the extra has alternatives %+v", chapterInfos(alternatives))
+		}
+	}
+
+	// 10.5 is a different chapter than 10
+	if got, want := updateInfos(report.New), []mangadata.ChapterInfo{tenHalf, twelve}; !slices.Equal(got, want) {
+		t.Errorf("new %+v, want %+v", got, want)
+	}
+	if len(report.Orphaned) != 1 || report.Orphaned[0].Number != 4 {
+		t.Errorf("orphaned %+v, want chapter 4", report.Orphaned)
+	}
+	if want := []int{5, 6, 7, 8, 9, 11}; !slices.Equal(report.Gaps, want) {
+		t.Errorf("gaps %v, want %v", report.Gaps, want)
+	}
+}
+
+func TestChapterGaps(t *testing.T) {
+	chapters := func(numbers ...float32) []mangadata.Chapter {
+		manga := newFakeManga("id", "title")
+		var result []mangadata.Chapter
+		for _, number := range numbers {
+			result = append(result, &fakeChapter{info: mangadata.ChapterInfo{Number: number}, volume: &fakeVolume{manga: manga}})
+		}
+		return result
+	}
+
+	tests := []struct {
+		name     string
+		indexed  []LibraryChapter
+		provider []mangadata.Chapter
+		want     []int
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:     "no gaps",
+			indexed:  []LibraryChapter{{Number: 1}, {Number: 2}},
+			provider: chapters(3, 4),
+		},
+		{
+			name:     "fractional",
+			indexed:  []LibraryChapter{{Number: 1}, {Number: 3.5}},
+			provider: chapters(5.5),
+			want:     []int{2, 4},
+		},
+		{
+			name:     "without number",
+			indexed:  []LibraryChapter{{Number: 0}, {Number: 5}},
+			provider: chapters(0, 6),
+		},
+		{
+			name:     "library and provider",
+			indexed:  []LibraryChapter{{Number: 1}, {Number: 10}},
+			provider: chapters(2, 3, 8),
+			want:     []int{4, 5, 6, 7, 9},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chapterGaps(tt.indexed, tt.provider); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,675 @@
+package libmangal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/luevano/libmangal/imaging"
+	"github.com/luevano/libmangal/logger"
+	"github.com/luevano/libmangal/mangadata"
+	"github.com/luevano/libmangal/metadata"
+	"github.com/spf13/afero"
+)
+
+// LocalProviderInfo is the ProviderInfo of the local library Provider.
+var LocalProviderInfo = ProviderInfo{
+	ID:          "local",
+	Name:        "Local",
+	Version:     "0.1.0",
+	Description: "Chapters already downloaded to a local directory",
+}
+
+// LocalProviderOptions configures the local library Provider.
+type LocalProviderOptions struct {
+	// FS where the library is stored.
+	FS afero.Fs
+
+	// Directory of the library, each of its subdirectories is a manga.
+	//
+	// Same as DownloadOptions.Directory, plus the provider directory
+	// if the chapters were downloaded with DownloadOptions.CreateProviderDir.
+	Directory string
+}
+
+// DefaultLocalProviderOptions constructs default LocalProviderOptions.
+func DefaultLocalProviderOptions() LocalProviderOptions {
+	return LocalProviderOptions{
+		FS:        afero.NewOsFs(),
+		Directory: ".",
+	}
+}
+
+// NewLocalProviderLoader creates a ProviderLoader for the library written by
+// Client.DownloadChapter (with DownloadOptions.CreateMangaDir), so it can be
+// used offline, for example to convert or re-tag the downloaded chapters.
+//
+// The layout is derived from the directories:
+//
+//   - Each subdirectory of LocalProviderOptions.Directory is a Manga, its
+//     series.json (if any) and the ComicInfo.xml of its first chapter
+//     are used for the metadata.
+//   - Each subdirectory of a manga without images is a Volume, numbered by
+//     the first number in its name (e.g. "Vol. 2.0"). Chapters placed directly
+//     in the manga directory belong to a volume numbered 0.
+//   - Each chapter file (in any Format) or directory with images is a Chapter,
+//     its ComicInfo.xml (if any) is used for the information, else it's
+//     parsed from its name (e.g. "[0012.5] Title.cbz").
+//
+// Pages are read from disk and implement mangadata.PageWithImage.
+// The ComicInfo.xml and series.json are not exposed as is, so that they're
+// generated again from the metadata when downloading or converting.
+func NewLocalProviderLoader(options LocalProviderOptions) ProviderLoader {
+	return &localProviderLoader{options: options}
+}
+
+type localProviderLoader struct {
+	options LocalProviderOptions
+}
+
+func (l *localProviderLoader) String() string {
+	return LocalProviderInfo.Name
+}
+
+// Info information about Provider.
+func (l *localProviderLoader) Info() ProviderInfo {
+	return LocalProviderInfo
+}
+
+// Load loads the Provider.
+func (l *localProviderLoader) Load(_ context.Context) (Provider, error) {
+	info, err := l.options.FS.Stat(l.options.Directory)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("library path %q is not a directory", l.options.Directory)
+	}
+
+	return &localProvider{
+		options: l.options,
+		logger:  logger.NewLogger(),
+	}, nil
+}
+
+var _ Provider = (*localProvider)(nil)
+
+// localProvider serves the chapters of a library on disk.
+type localProvider struct {
+	options LocalProviderOptions
+	logger  *logger.Logger
+}
+
+func (p *localProvider) String() string {
+	return LocalProviderInfo.Name
+}
+
+// Close does nothing, chapters are only open while reading their pages.
+func (p *localProvider) Close() error {
+	return nil
+}
+
+// Info information about Provider.
+func (p *localProvider) Info() ProviderInfo {
+	return LocalProviderInfo
+}
+
+// SetLogger sets logger to use for this provider.
+func (p *localProvider) SetLogger(logger *logger.Logger) {
+	p.logger = logger
+}
+
+// SearchMangas returns the mangas of the library whose title (or
+// alternate titles, or directory name) contains the query, case insensitive.
+//
+// An empty query returns all mangas.
+func (p *localProvider) SearchMangas(
+	ctx context.Context,
+	query string,
+) ([]mangadata.Manga, error) {
+	p.logger.Log("searching mangas with %q in %q", query, p.options.Directory)
+
+	entries, err := afero.ReadDir(p.options.FS, p.options.Directory)
+	if err != nil {
+		return nil, err
+	}
+
+	query = strings.ToLower(strings.TrimSpace(query))
+	var mangas []mangadata.Manga
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		manga, err := p.manga(filepath.Join(p.options.Directory, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if manga.matches(query) {
+			mangas = append(mangas, manga)
+		}
+	}
+
+	sort.SliceStable(mangas, func(i, j int) bool {
+		return naturalLess(mangas[i].Info().Title, mangas[j].Info().Title)
+	})
+	p.logger.Log("found %d mangas", len(mangas))
+	return mangas, nil
+}
+
+// MangaVolumes gets volumes of the manga.
+func (p *localProvider) MangaVolumes(
+	_ context.Context,
+	manga mangadata.Manga,
+) ([]mangadata.Volume, error) {
+	localManga, ok := manga.(*localManga)
+	if !ok {
+		return nil, fmt.Errorf("manga %q is not from the %s provider", manga, LocalProviderInfo.Name)
+	}
+	p.logger.Log("listing volumes of %q", localManga.path)
+
+	chapters, dirs, err := scanChapterDir(p.options.FS, localManga.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var volumes []*localVolume
+	if len(chapters) != 0 {
+		volumes = append(volumes, &localVolume{manga: localManga, path: localManga.path})
+	}
+	for _, dir := range dirs {
+		volumes = append(volumes, &localVolume{
+			info:  mangadata.VolumeInfo{Number: parseNumber(filepath.Base(dir))},
+			manga: localManga,
+			path:  dir,
+		})
+	}
+
+	sort.SliceStable(volumes, func(i, j int) bool {
+		if volumes[i].info.Number != volumes[j].info.Number {
+			return volumes[i].info.Number < volumes[j].info.Number
+		}
+		return naturalLess(volumes[i].path, volumes[j].path)
+	})
+
+	result := make([]mangadata.Volume, len(volumes))
+	for i, volume := range volumes {
+		result[i] = volume
+	}
+	return result, nil
+}
+
+// VolumeChapters gets chapters of the given volume.
+//
+// Chapters with an unreadable or invalid ComicInfo.xml are still
+// listed, with the information parsed from their name (as in the Library).
+func (p *localProvider) VolumeChapters(
+	ctx context.Context,
+	volume mangadata.Volume,
+) ([]mangadata.Chapter, error) {
+	localVolume, ok := volume.(*localVolume)
+	if !ok {
+		return nil, fmt.Errorf("volume %q is not from the %s provider", volume, LocalProviderInfo.Name)
+	}
+	p.logger.Log("listing chapters of %q", localVolume.path)
+
+	chapters, _, err := scanChapterDir(p.options.FS, localVolume.path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, chapter := range chapters {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		chapter.volume = localVolume
+
+		comicInfoXML, err := readComicInfoXML(p.options.FS, chapter.path, chapter.format)
+		if err != nil {
+			p.logger.Log("error while reading the ComicInfo.xml of %q: %s", chapter.path, err.Error())
+		}
+		chapter.info = localChapterInfo(chapter.path, chapter.format, comicInfoXML)
+	}
+
+	sort.SliceStable(chapters, func(i, j int) bool {
+		if chapters[i].info.Number != chapters[j].info.Number {
+			return chapters[i].info.Number < chapters[j].info.Number
+		}
+		return naturalLess(chapters[i].path, chapters[j].path)
+	})
+
+	result := make([]mangadata.Chapter, len(chapters))
+	for i, chapter := range chapters {
+		result[i] = chapter
+	}
+	return result, nil
+}
+
+// ChapterPages reads the pages of the given chapter from disk.
+func (p *localProvider) ChapterPages(
+	_ context.Context,
+	chapter mangadata.Chapter,
+) ([]mangadata.Page, error) {
+	localChapter, ok := chapter.(*localChapter)
+	if !ok {
+		return nil, fmt.Errorf("chapter %q is not from the %s provider", chapter, LocalProviderInfo.Name)
+	}
+	p.logger.Log("reading pages of %q", localChapter.path)
+
+	contents, err := readChapter(p.options.FS, localChapter.path, localChapter.format)
+	if err != nil {
+		return nil, err
+	}
+
+	pages := make([]mangadata.Page, len(contents.pages))
+	for i, page := range contents.pages {
+		page.chapter = localChapter
+		pages[i] = page
+	}
+	return pages, nil
+}
+
+// GetPageImage gets the image contents of the given page, already read from disk.
+func (p *localProvider) GetPageImage(
+	_ context.Context,
+	page mangadata.Page,
+) ([]byte, error) {
+	withImage, ok := page.(mangadata.PageWithImage)
+	if !ok {
+		return nil, fmt.Errorf("page %q is not from the %s provider", page, LocalProviderInfo.Name)
+	}
+	return withImage.Image(), nil
+}
+
+// scanChapterDir splits the entries of the directory into chapters
+// (without their information) and subdirectories.
+//
+// Hidden entries are ignored, which includes the temporary files.
+func scanChapterDir(fs afero.Fs, path string) ([]*localChapter, []string, error) {
+	entries, err := afero.ReadDir(fs, path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		chapters []*localChapter
+		dirs     []string
+	)
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		entryPath := filepath.Join(path, name)
+
+		if entry.IsDir() {
+			isChapter, err := hasImages(fs, entryPath)
+			if err != nil {
+				return nil, nil, err
+			}
+			if isChapter {
+				chapters = append(chapters, &localChapter{path: entryPath, format: FormatImages})
+			} else {
+				dirs = append(dirs, entryPath)
+			}
+			continue
+		}
+
+		if format, ok := formatFromName(name); ok {
+			chapters = append(chapters, &localChapter{path: entryPath, format: format})
+		}
+	}
+	return chapters, dirs, nil
+}
+
+// hasImages returns true if the directory contains image files,
+// other than the manga cover and banner.
+func hasImages(fs afero.Fs, path string) (bool, error) {
+	entries, err := afero.ReadDir(fs, path)
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") ||
+			name == metadata.FilenameCoverJPG || name == metadata.FilenameBannerJPG {
+			continue
+		}
+		if _, ok := imaging.FormatFromExtension(filepath.Ext(entry.Name())); ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// readComicInfoXML reads the ComicInfo.xml of the chapter, nil if it has none.
+//
+// Only comic book archives and image directories can have one, other formats
+// are not opened (PDF and TAR.GZ would be read whole into memory).
+func readComicInfoXML(fs afero.Fs, path string, format Format) (*metadata.ComicInfoXML, error) {
+	if !format.IsComicBook() && format != FormatImages {
+		return nil, nil
+	}
+
+	reader, err := openChapter(fs, path, format)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return reader.ComicInfoXML(), nil
+}
+
+// manga builds the manga of the directory from its series.json and
+// the ComicInfo.xml of its first chapter, which is skipped if unreadable.
+func (p *localProvider) manga(path string) (*localManga, error) {
+	seriesJSON, err := readSeriesJSON(p.options.FS, path)
+	if err != nil {
+		return nil, err
+	}
+
+	// the title falls back to the series.json or the directory name
+	comicInfoXML, err := firstComicInfoXML(p.options.FS, path)
+	if err != nil {
+		p.logger.Log("error while reading the first ComicInfo.xml of %q: %s", path, err.Error())
+	}
+
+	dirName := filepath.Base(path)
+	meta := localMetadata(dirName, seriesJSON, comicInfoXML)
+	info := mangadata.MangaInfo{
+		Title: meta.Title(),
+		ID:    dirName,
+	}
+	if seriesJSON != nil {
+		info.Cover = seriesJSON.ComicImage
+	}
+
+	return &localManga{
+		info:     info,
+		metadata: meta,
+		path:     path,
+	}, nil
+}
+
+// readSeriesJSON reads the series.json of the manga directory, nil if it has none.
+func readSeriesJSON(fs afero.Fs, path string) (*metadata.SeriesJSON, error) {
+	data, err := afero.ReadFile(fs, filepath.Join(path, metadata.FilenameSeriesJSON))
+	if errors.Is(err, iofs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var seriesJSON metadata.SeriesJSON
+	if err := seriesJSON.Unmarshal(data); err != nil {
+		return nil, fmt.Errorf("parsing series.json of %q: %w", path, err)
+	}
+	return &seriesJSON, nil
+}
+
+// firstComicInfoXML reads the ComicInfo.xml of the first chapter of the
+// manga directory (in the first volume if the chapters are in volumes).
+func firstComicInfoXML(fs afero.Fs, path string) (*metadata.ComicInfoXML, error) {
+	chapters, dirs, err := scanChapterDir(fs, path)
+	if err != nil {
+		return nil, err
+	}
+	if len(chapters) == 0 && len(dirs) != 0 {
+		sort.SliceStable(dirs, func(i, j int) bool {
+			return naturalLess(filepath.Base(dirs[i]), filepath.Base(dirs[j]))
+		})
+		if chapters, _, err = scanChapterDir(fs, dirs[0]); err != nil {
+			return nil, err
+		}
+	}
+	if len(chapters) == 0 {
+		return nil, nil
+	}
+
+	sort.SliceStable(chapters, func(i, j int) bool {
+		return naturalLess(filepath.Base(chapters[i].path), filepath.Base(chapters[j].path))
+	})
+	return readComicInfoXML(fs, chapters[0].path, chapters[0].format)
+}
+
+// localMetadata builds the manga metadata from the series.json and
+// ComicInfo.xml (either can be nil), the directory name is the fallback title.
+func localMetadata(
+	dirName string,
+	seriesJSON *metadata.SeriesJSON,
+	comicInfoXML *metadata.ComicInfoXML,
+) *mangadata.Metadata {
+	meta := &mangadata.Metadata{
+		EnglishTitle:   dirName,
+		ProviderID:     dirName,
+		ProviderIDCode: LocalProviderInfo.ID,
+	}
+
+	if comicInfoXML != nil {
+		if comicInfoXML.Series != "" {
+			meta.EnglishTitle = comicInfoXML.Series
+		}
+		meta.Summary = comicInfoXML.Summary
+		meta.CommunityScore = comicInfoXML.CommunityRating
+		meta.TagList = comicInfoXML.Tags
+		meta.GenreList = comicInfoXML.Genres
+		meta.CharacterList = comicInfoXML.Characters
+		meta.AuthorList = comicInfoXML.Writers
+		meta.ArtistList = comicInfoXML.Pencillers
+		meta.TranslatorList = comicInfoXML.Translators
+		meta.LettererList = comicInfoXML.Letterers
+		meta.DateStart = metadata.Date{
+			Year:  comicInfoXML.Year,
+			Month: comicInfoXML.Month,
+			Day:   comicInfoXML.Day,
+		}
+		meta.ProviderPublisher = comicInfoXML.Publisher
+		meta.PublicationFormat = comicInfoXML.Format
+		meta.ChapterCount = comicInfoXML.Count
+		meta.ExtraNotes = comicInfoXML.Notes
+	}
+
+	if seriesJSON != nil {
+		if seriesJSON.Name != "" {
+			meta.EnglishTitle = seriesJSON.Name
+		}
+		if seriesJSON.DescriptionText != "" {
+			meta.Summary = seriesJSON.DescriptionText
+		}
+		if seriesJSON.Year != 0 && seriesJSON.Year != meta.DateStart.Year {
+			meta.DateStart = metadata.Date{Year: seriesJSON.Year}
+		}
+		if seriesJSON.Publisher != "" {
+			meta.ProviderPublisher = seriesJSON.Publisher
+		}
+		if seriesJSON.TotalIssues != 0 {
+			meta.ChapterCount = seriesJSON.TotalIssues
+		}
+		meta.CoverImage = seriesJSON.ComicImage
+		switch seriesJSON.Status {
+		case "Ended":
+			meta.PublicationStatus = metadata.StatusFinished
+		case "Continuing":
+			meta.PublicationStatus = metadata.StatusReleasing
+		}
+	}
+
+	return meta
+}
+
+var (
+	// localChapterNameRegex matches the default chapter name, e.g. "[0012.5] Title".
+	localChapterNameRegex = regexp.MustCompile(`^\[(\d+(?:\.\d+)?)\]\s*(.*)$`)
+	localNumberRegex      = regexp.MustCompile(`\d+(?:\.\d+)?`)
+)
+
+// parseNumber returns the first number in the name, 0 if none.
+func parseNumber(name string) float32 {
+	number, err := strconv.ParseFloat(localNumberRegex.FindString(name), 32)
+	if err != nil {
+		return 0
+	}
+	return float32(number)
+}
+
+// localChapterInfo builds the chapter information from its
+// ComicInfo.xml (can be nil), falling back to its name.
+func localChapterInfo(path string, format Format, comicInfoXML *metadata.ComicInfoXML) mangadata.ChapterInfo {
+	name := filepath.Base(path)
+	name = name[:len(name)-len(format.Extension())]
+
+	var info mangadata.ChapterInfo
+	if match := localChapterNameRegex.FindStringSubmatch(name); match != nil {
+		number, _ := strconv.ParseFloat(match[1], 32)
+		info.Number = float32(number)
+		info.Title = match[2]
+	} else {
+		info.Number = parseNumber(name)
+		info.Title = name
+	}
+
+	if comicInfoXML != nil {
+		if comicInfoXML.Number != 0 {
+			info.Number = comicInfoXML.Number
+		}
+		if comicInfoXML.Title != "" {
+			info.Title = comicInfoXML.Title
+		}
+		info.URL = comicInfoXML.Web
+		info.Date = metadata.Date{
+			Year:  comicInfoXML.Year,
+			Month: comicInfoXML.Month,
+			Day:   comicInfoXML.Day,
+		}
+		// the scanlation group is written as the only translator
+		if len(comicInfoXML.Translators) == 1 {
+			info.ScanlationGroup = comicInfoXML.Translators[0]
+		}
+	}
+	return info
+}
+
+// fileChapter builds the chapter at path outside of the local provider,
+// its manga is the parent directory with the metadata of the
+// ComicInfo.xml (can be nil).
+func fileChapter(path string, format Format, comicInfoXML *metadata.ComicInfoXML) *localChapter {
+	dir := filepath.Dir(path)
+	dirName := filepath.Base(dir)
+	meta := localMetadata(dirName, nil, comicInfoXML)
+	manga := &localManga{
+		info: mangadata.MangaInfo{
+			Title: meta.Title(),
+			ID:    dirName,
+		},
+		metadata: meta,
+		path:     dir,
+	}
+
+	return &localChapter{
+		info:   localChapterInfo(path, format, comicInfoXML),
+		volume: &localVolume{manga: manga, path: dir},
+		path:   path,
+		format: format,
+	}
+}
+
+var _ mangadata.Manga = (*localManga)(nil)
+
+// localManga is a manga directory of the library.
+type localManga struct {
+	info     mangadata.MangaInfo
+	metadata metadata.Metadata
+	path     string
+}
+
+func (m *localManga) String() string {
+	return m.info.Title
+}
+
+func (m *localManga) Info() mangadata.MangaInfo {
+	return m.info
+}
+
+// Metadata gets the associated metadata of the manga.
+func (m *localManga) Metadata() metadata.Metadata {
+	return m.metadata
+}
+
+// SetMetadata will replace the current metadata.
+func (m *localManga) SetMetadata(metadata metadata.Metadata) {
+	m.metadata = metadata
+}
+
+// matches returns true if the title, alternate titles or directory
+// name contains the query (lower case), an empty query matches all.
+func (m *localManga) matches(query string) bool {
+	if query == "" {
+		return true
+	}
+	titles := append([]string{m.info.Title, m.info.ID}, m.metadata.AlternateTitles()...)
+	for _, title := range titles {
+		if strings.Contains(strings.ToLower(title), query) {
+			return true
+		}
+	}
+	return false
+}
+
+var _ mangadata.Volume = (*localVolume)(nil)
+
+// localVolume is a volume directory of the library, or the
+// manga directory for the chapters not in a volume directory.
+type localVolume struct {
+	info  mangadata.VolumeInfo
+	manga *localManga
+	path  string
+}
+
+func (v *localVolume) String() string {
+	return fmt.Sprintf("Vol. %.1f", v.info.Number)
+}
+
+func (v *localVolume) Info() mangadata.VolumeInfo {
+	return v.info
+}
+
+// Manga gets the Manga that this Volume is relevant to.
+func (v *localVolume) Manga() mangadata.Manga {
+	return v.manga
+}
+
+var _ mangadata.Chapter = (*localChapter)(nil)
+
+// localChapter is a chapter file or image directory of the library.
+type localChapter struct {
+	info   mangadata.ChapterInfo
+	volume *localVolume
+	path   string
+	format Format
+}
+
+func (c *localChapter) String() string {
+	if c.info.Title != "" {
+		return c.info.Title
+	}
+	return filepath.Base(c.path)
+}
+
+func (c *localChapter) Info() mangadata.ChapterInfo {
+	return c.info
+}
+
+// Volume gets the Volume that this Chapter is relevant to.
+func (c *localChapter) Volume() mangadata.Volume {
+	return c.volume
+}
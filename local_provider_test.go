@@ -0,0 +1,55 @@
+package libmangal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestLocalProviderInvalidComicInfoXML(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	client := newTestClient(t, fs, "library")
+	writeTestCBZ(t, fs, "library/Berserk/[0001.0] One.cbz",
+		testFile{"ComicInfo.xml", []byte("<ComicInfo><Title>")},
+		testFile{"001.png", testPNG(t)},
+	)
+	writeTestCBZ(t, fs, "library/Berserk/[0002.0] Two.cbz",
+		testFile{"ComicInfo.xml", []byte("<ComicInfo><Title>Guts</Title><Number>2</Number></ComicInfo>")},
+		testFile{"001.png", testPNG(t)},
+	)
+	if err := afero.WriteFile(fs, "library/Berserk/[0003.0] Three.cbz", []byte("not a zip"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first chapter can't be read, the title is the directory name
+	mangas, err := client.SearchMangas(context.Background(), "Berserk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mangas) != 1 || mangas[0].Info().Title != "Berserk" {
+		t.Fatalf("found %v, want Berserk", mangas)
+	}
+
+	chapters, err := client.MangaChapters(context.Background(), mangas[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		number float32
+		title  string
+	}{
+		{1, "One"},
+		{2, "Guts"},
+		{3, "Three"},
+	}
+	if len(chapters) != len(want) {
+		t.Fatalf("listed %d chapters, want %d", len(chapters), len(want))
+	}
+	for i, chapter := range chapters {
+		info := chapter.Info()
+		if info.Number != want[i].number || info.Title != want[i].title {
+			t.Errorf("chapter %d is %v %q, want %v %q", i, info.Number, info.Title, want[i].number, want[i].title)
+		}
+	}
+}
@@ -31,6 +31,6 @@ type PageWithImage interface {
 	// Should only be exposed if the Page already contains image contents.
 	Image() []byte
 
-	// SetImage sets the image contents. This is used by DownloadOptions.ImageTransformer.
+	// SetImage sets the image contents.
 	SetImage(newImage []byte)
 }
@@ -0,0 +1,275 @@
+package libmangal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/luevano/libmangal/mangadata"
+	"github.com/spf13/afero"
+)
+
+// FilenameManifest is the name of the manifest file in the manga directory.
+const FilenameManifest = ".libmangal.json"
+
+// manifestVersion is the version of the manifest file format.
+const manifestVersion = 1
+
+// manifestMu guards the manifest updates, as chapters
+// of the same manga can be downloaded concurrently.
+var manifestMu sync.Mutex
+
+// ManifestChapter is a chapter written by libmangal, recorded in the manifest.
+type ManifestChapter struct {
+	// ProviderID is the ID of the provider the chapter was downloaded from.
+	ProviderID string `json:"provider_id"`
+
+	// MangaID is the ID of the manga in the provider.
+	MangaID string `json:"manga_id"`
+
+	// URL of the chapter in the provider.
+	URL string `json:"url"`
+
+	// Number of the chapter.
+	Number float32 `json:"number"`
+
+	// Title of the chapter.
+	Title string `json:"title"`
+
+	// ScanlationGroup of the chapter.
+	ScanlationGroup string `json:"scanlation_group"`
+
+	// PageHashes are the SHA-256 of the source of each page (its
+	// String, the image URL for most providers), in page order.
+	PageHashes []string `json:"page_hashes"`
+
+	// Path of the chapter, relative to the manga directory (slash separated).
+	Path string `json:"path"`
+
+	// Format of the chapter.
+	Format Format `json:"format"`
+
+	// Size in bytes of the chapter (of all its files for FormatImages).
+	Size int64 `json:"size"`
+
+	// SHA256 of the chapter file (of its files in
+	// name order for FormatImages), hex encoded.
+	SHA256 string `json:"sha256"`
+
+	// DownloadedAt is the time the chapter was written.
+	DownloadedAt time.Time `json:"downloaded_at"`
+}
+
+// matches is true if the entry is the chapter of the manga in the provider, in the given format.
+//
+// Chapters are matched by URL, or by number and scanlation group if they have no URL.
+func (e ManifestChapter) matches(providerID, mangaID string, info mangadata.ChapterInfo, format Format) bool {
+	if e.ProviderID != providerID || e.MangaID != mangaID || e.Format != format {
+		return false
+	}
+	if e.URL != "" || info.URL != "" {
+		return e.URL == info.URL
+	}
+	return chapterNumberKey(e.Number) == chapterNumberKey(info.Number) &&
+		strings.EqualFold(e.ScanlationGroup, info.ScanlationGroup)
+}
+
+// Manifest records the chapters libmangal wrote to a manga directory, see
+// DownloadOptions.WriteManifest. It's kept in the FilenameManifest file.
+type Manifest struct {
+	// Version of the manifest file format.
+	Version int `json:"version"`
+
+	// Chapters in the manga directory, sorted by path.
+	Chapters []ManifestChapter `json:"chapters"`
+}
+
+// ReadManifest reads the manifest of the manga directory,
+// an empty one if the directory has none.
+func ReadManifest(fs afero.Fs, dir string) (Manifest, error) {
+	manifest := Manifest{Version: manifestVersion}
+
+	data, err := afero.ReadFile(fs, filepath.Join(dir, FilenameManifest))
+	if errors.Is(err, iofs.ErrNotExist) {
+		return manifest, nil
+	}
+	if err != nil {
+		return manifest, err
+	}
+
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("parsing %s of %q: %w", FilenameManifest, dir, err)
+	}
+	if manifest.Version > manifestVersion {
+		return manifest, fmt.Errorf("unsupported %s version %d of %q", FilenameManifest, manifest.Version, dir)
+	}
+	return manifest, nil
+}
+
+// WriteManifest writes the manifest to the manga directory, removing
+// the file if the manifest has no chapters.
+//
+// It's written to a temporary file that is then renamed.
+func WriteManifest(fs afero.Fs, dir string, manifest Manifest, mode iofs.FileMode) error {
+	path := filepath.Join(dir, FilenameManifest)
+	if len(manifest.Chapters) == 0 {
+		if err := fs.Remove(path); err != nil && !errors.Is(err, iofs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	manifest.Version = manifestVersion
+	sort.SliceStable(manifest.Chapters, func(i, j int) bool {
+		return naturalLess(manifest.Chapters[i].Path, manifest.Chapters[j].Path)
+	})
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := afero.WriteFile(fs, tmp, data, mode); err != nil {
+		return err
+	}
+	return fs.Rename(tmp, path)
+}
+
+// Find returns the entry of the chapter of the manga in the provider, in the given format.
+func (m Manifest) Find(providerID, mangaID string, info mangadata.ChapterInfo, format Format) (ManifestChapter, bool) {
+	for _, entry := range m.Chapters {
+		if entry.matches(providerID, mangaID, info, format) {
+			return entry, true
+		}
+	}
+	return ManifestChapter{}, false
+}
+
+// Path returns the entry of the chapter at path (relative to the manga directory).
+func (m Manifest) Path(path string) (ManifestChapter, bool) {
+	path = filepath.ToSlash(path)
+	for _, entry := range m.Chapters {
+		if entry.Path == path {
+			return entry, true
+		}
+	}
+	return ManifestChapter{}, false
+}
+
+// Set adds the entry, replacing the one of the same chapter or path.
+func (m *Manifest) Set(entry ManifestChapter) {
+	info := mangadata.ChapterInfo{
+		URL:             entry.URL,
+		Number:          entry.Number,
+		ScanlationGroup: entry.ScanlationGroup,
+	}
+	chapters := m.Chapters[:0]
+	for _, existing := range m.Chapters {
+		if existing.Path != entry.Path && !existing.matches(entry.ProviderID, entry.MangaID, info, entry.Format) {
+			chapters = append(chapters, existing)
+		}
+	}
+	m.Chapters = append(chapters, entry)
+}
+
+// Remove removes the entry of the chapter at path (relative to the
+// manga directory), returns false if there was none.
+func (m *Manifest) Remove(path string) bool {
+	path = filepath.ToSlash(path)
+	for i, entry := range m.Chapters {
+		if entry.Path == path {
+			m.Chapters = append(m.Chapters[:i], m.Chapters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// updateManifest reads, modifies and writes the manifest of the manga directory.
+func updateManifest(fs afero.Fs, dir string, mode iofs.FileMode, update func(*Manifest)) error {
+	manifestMu.Lock()
+	defer manifestMu.Unlock()
+
+	manifest, err := ReadManifest(fs, dir)
+	if err != nil {
+		return err
+	}
+	update(&manifest)
+	return WriteManifest(fs, dir, manifest, mode)
+}
+
+// removeRecordedChapter removes the chapter at path and its
+// entry in the manifest of the manga directory (if any).
+func (c *Client) removeRecordedChapter(mangaDir, path string) error {
+	if err := c.removeChapter(path); err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(mangaDir, path)
+	if err != nil {
+		return nil
+	}
+	manifest, err := ReadManifest(c.options.FS, mangaDir)
+	if err != nil {
+		return err
+	}
+	if _, ok := manifest.Path(rel); !ok {
+		return nil
+	}
+	return updateManifest(c.options.FS, mangaDir, c.options.ModeFile, func(manifest *Manifest) {
+		manifest.Remove(rel)
+	})
+}
+
+// pageHashes returns the SHA-256 of the String of each page.
+func pageHashes(pages []mangadata.Page) []string {
+	hashes := make([]string, len(pages))
+	for i, page := range pages {
+		sum := sha256.Sum256([]byte(page.String()))
+		hashes[i] = hex.EncodeToString(sum[:])
+	}
+	return hashes
+}
+
+// chapterChecksum returns the hex encoded SHA-256 and size of the chapter,
+// for FormatImages of its files in name order.
+func chapterChecksum(fs afero.Fs, path string, format Format) (string, int64, error) {
+	files := []string{path}
+	if format == FormatImages {
+		entries, err := afero.ReadDir(fs, path)
+		if err != nil {
+			return "", 0, err
+		}
+		files = files[:0]
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+
+	hash := sha256.New()
+	var size int64
+	for _, name := range files {
+		file, err := fs.Open(name)
+		if err != nil {
+			return "", 0, err
+		}
+		n, err := io.Copy(hash, file)
+		file.Close()
+		if err != nil {
+			return "", 0, err
+		}
+		size += n
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
@@ -0,0 +1,214 @@
+package libmangal
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/luevano/libmangal/mangadata"
+	"github.com/luevano/libmangal/metadata"
+	"github.com/spf13/afero"
+)
+
+func TestManifestChapterMatches(t *testing.T) {
+	byURL := ManifestChapter{ProviderID: "fake", MangaID: "berserk", URL: "https://fake/1", Number: 1, Format: FormatCBZ}
+	byNumber := ManifestChapter{ProviderID: "fake", MangaID: "berserk", Number: 10.5, ScanlationGroup: "Group", Format: FormatCBZ}
+
+	tests := []struct {
+		name  string
+		entry ManifestChapter
+		info  mangadata.ChapterInfo
+		want  bool
+	}{
+		{
+			name:  "same URL",
+			entry: byURL,
+			info:  mangadata.ChapterInfo{URL: "https://fake/1", Number: 2},
+			want:  true,
+		},
+		{
+			name:  "different URL",
+			entry: byURL,
+			info:  mangadata.ChapterInfo{URL: "https://fake/2", Number: 1},
+		},
+		{
+			// once either has an URL, the number is not enough
+			name:  "URL only in the entry",
+			entry: byURL,
+			info:  mangadata.ChapterInfo{Number: 1},
+		},
+		{
+			name:  "URL only in the chapter",
+			entry: byNumber,
+			info:  mangadata.ChapterInfo{URL: "https://fake/10.5", Number: 10.5, ScanlationGroup: "Group"},
+		},
+		{
+			name:  "same number and group",
+			entry: byNumber,
+			info:  mangadata.ChapterInfo{Number: 10.5, ScanlationGroup: "group"},
+			want:  true,
+		},
+		{
+			name:  "different fractional number",
+			entry: byNumber,
+			info:  mangadata.ChapterInfo{Number: 10, ScanlationGroup: "Group"},
+		},
+		{
+			name:  "different group",
+			entry: byNumber,
+			info:  mangadata.ChapterInfo{Number: 10.5, ScanlationGroup: "Other"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.entry.matches("fake", "berserk", tt.info, FormatCBZ); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// provider, manga and format must match as well
+	info := mangadata.ChapterInfo{URL: "https://fake/1"}
+	if byURL.matches("other", "berserk", info, FormatCBZ) ||
+		byURL.matches("fake", "other", info, FormatCBZ) ||
+		byURL.matches("fake", "berserk", info, FormatPDF) {
+		t.Error("matched the chapter of another provider, manga or format")
+	}
+}
+
+func TestManifestSet(t *testing.T) {
+	one := ManifestChapter{ProviderID: "fake", MangaID: "berserk", URL: "https://fake/1", Number: 1, Path: "[0001.0] One.cbz", Format: FormatCBZ}
+	two := ManifestChapter{ProviderID: "fake", MangaID: "berserk", URL: "https://fake/2", Number: 2, Path: "[0002.0] Two.cbz", Format: FormatCBZ}
+
+	var manifest Manifest
+	manifest.Set(one)
+	manifest.Set(two)
+	if len(manifest.Chapters) != 2 {
+		t.Fatalf("got %d chapters, want 2", len(manifest.Chapters))
+	}
+
+	// the same chapter, renamed
+	renamed := one
+	renamed.Path = "Berserk - Ch. 1.cbz"
+	manifest.Set(renamed)
+	if len(manifest.Chapters) != 2 {
+		t.Fatalf("got %d chapters after replacing by chapter, want 2", len(manifest.Chapters))
+	}
+	if _, ok := manifest.Path(one.Path); ok {
+		t.Error("the previous path of the chapter is still recorded")
+	}
+	if entry, ok := manifest.Find("fake", "berserk", mangadata.ChapterInfo{URL: one.URL}, FormatCBZ); !ok || entry.Path != renamed.Path {
+		t.Errorf("found %+v, want the renamed chapter", entry)
+	}
+
+	// another chapter written to the same path
+	other := ManifestChapter{ProviderID: "fake", MangaID: "berserk", URL: "https://fake/2b", Number: 2, Path: two.Path, Format: FormatCBZ}
+	manifest.Set(other)
+	if len(manifest.Chapters) != 2 {
+		t.Fatalf("got %d chapters after replacing by path, want 2", len(manifest.Chapters))
+	}
+	if entry, _ := manifest.Path(two.Path); entry.URL != other.URL {
+		t.Errorf("chapter at %q is %q, want %q", two.Path, entry.URL, other.URL)
+	}
+
+	if !manifest.Remove(filepath.FromSlash(renamed.Path)) || manifest.Remove(renamed.Path) {
+		t.Error("Remove didn't remove the chapter only once")
+	}
+}
+
+func TestWriteManifest(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	path := filepath.Join("Berserk", FilenameManifest)
+
+	manifest := Manifest{Chapters: []ManifestChapter{
+		{Number: 10, Path: "[10] Ten.cbz", Format: FormatCBZ},
+		{Number: 2, Path: "[2] Two.cbz", Format: FormatCBZ},
+	}}
+	if err := WriteManifest(fs, "Berserk", manifest, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadManifest(fs, "Berserk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Version != manifestVersion || len(read.Chapters) != 2 || read.Chapters[0].Number != 2 {
+		t.Errorf("read %+v, want version %d with the chapters in path order", read, manifestVersion)
+	}
+
+	// an empty manifest removes the file
+	for range 2 {
+		if err := WriteManifest(fs, "Berserk", Manifest{}, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if ok, _ := afero.Exists(fs, path); ok {
+			t.Error("the manifest of no chapters was written")
+		}
+	}
+	if read, err := ReadManifest(fs, "Berserk"); err != nil || len(read.Chapters) != 0 {
+		t.Errorf("read %+v (%v) without manifest, want an empty one", read, err)
+	}
+}
+
+func TestDownloadChapterManifest(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	provider := &fakeProvider{mangas: []*fakeManga{newFakeManga("berserk", "Berserk",
+		mangadata.ChapterInfo{Number: 1, Title: "One", URL: "https://fake/1"},
+	)}}
+	client := newFakeClient(t, fs, provider)
+	chapter := provider.mangas[0].chapters[0]
+
+	options := testDownloadOptions("library")
+	options.WriteManifest = true
+	downloaded, err := client.DownloadChapter(context.Background(), chapter, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordedPath := downloaded.Path()
+
+	_, mangaDir := client.chapterDirs(client.Info(), chapter, options)
+	manifest, err := ReadManifest(fs, mangaDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Chapters) != 1 || manifest.Chapters[0].Size == 0 || manifest.Chapters[0].SHA256 == "" {
+		t.Fatalf("manifest has %+v, want the chapter with its size and checksum", manifest.Chapters)
+	}
+
+	// skipped by the recorded path after the chapter name changed
+	client.options.ChapterName = func(_ ProviderInfo, chapter mangadata.Chapter) string {
+		return "Berserk - Ch. " + chapter.Info().Title
+	}
+	downloaded, err = client.DownloadChapter(context.Background(), chapter, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if downloaded.ChapterStatus != metadata.DownloadStatusExists {
+		t.Errorf("chapter status is %q, want %q", downloaded.ChapterStatus, metadata.DownloadStatusExists)
+	}
+	if downloaded.Path() != recordedPath {
+		t.Errorf("got path %q, want the recorded %q", downloaded.Path(), recordedPath)
+	}
+	renamedPath := filepath.Join(filepath.Dir(recordedPath), client.ChapterName(chapter, options.Format))
+	if ok, _ := afero.Exists(fs, renamedPath); ok {
+		t.Error("the chapter was downloaded again under the new name")
+	}
+
+	// downloaded again if the recorded file is gone, replacing the entry
+	if err := fs.Remove(recordedPath); err != nil {
+		t.Fatal(err)
+	}
+	downloaded, err = client.DownloadChapter(context.Background(), chapter, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if downloaded.Path() != renamedPath || downloaded.ChapterStatus == metadata.DownloadStatusExists {
+		t.Errorf("got %q (%s), want a new %q", downloaded.Path(), downloaded.ChapterStatus, renamedPath)
+	}
+	manifest, err = ReadManifest(fs, mangaDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Chapters) != 1 || manifest.Chapters[0].Path != filepath.Base(renamedPath) {
+		t.Errorf("manifest has %+v, want only the renamed chapter", manifest.Chapters)
+	}
+}
@@ -2,9 +2,13 @@ package anilist
 
 import (
 	"context"
+	"fmt"
+	"net/url"
+	"strings"
 
 	"github.com/luevano/libmangal/logger"
 	"github.com/luevano/libmangal/metadata"
+	"github.com/luevano/libmangal/metadata/request"
 )
 
 // Reference docs:
@@ -21,7 +25,7 @@ var info = metadata.ProviderInfo{
 	Website: "https://anilist.co/",
 }
 
-var _ metadata.Provider = (*Anilist)(nil)
+var _ metadata.ProviderWithSearchValidation = (*Anilist)(nil)
 
 // Anilist is the Anilist client.
 type Anilist struct {
@@ -29,25 +33,67 @@ type Anilist struct {
 	user  metadata.User
 	token string
 
-	options Options
-	logger  *logger.Logger
+	options   Options
+	requester *request.Client
+	logger    *logger.Logger
+	// parsed Options.APIURL and Options.OAuthURL
+	apiURL   *url.URL
+	oAuthURL *url.URL
 }
 
 // NewAnilist constructs new Anilist client.
+//
+// Returns an error if Options.APIURL or Options.OAuthURL are invalid.
 func NewAnilist(options Options) (*Anilist, error) {
 	// ensure the used logger is not nil
 	l := options.Logger
 	if l == nil {
 		l = logger.NewLogger()
 	}
+	if options.APIURL == "" {
+		options.APIURL = apiURL
+	}
+	if options.OAuthURL == "" {
+		options.OAuthURL = OAuthBaseURL
+	}
+	api, err := parseBaseURL("APIURL", options.APIURL)
+	if err != nil {
+		return nil, err
+	}
+	oAuth, err := parseBaseURL("OAuthURL", options.OAuthURL)
+	if err != nil {
+		return nil, err
+	}
+	if options.RateLimit == (request.Options{}) {
+		options.RateLimit = defaultRateLimit
+	}
+	requester := request.NewClient(options.HTTPClient, options.RateLimit)
+	requester.SetLogger(l)
+
 	anilist := &Anilist{
-		options: options,
-		logger:  l,
+		options:   options,
+		requester: requester,
+		logger:    l,
+		apiURL:    api,
+		oAuthURL:  oAuth,
 	}
 
 	return anilist, nil
 }
 
+// parseBaseURL parses the base URL of the option name,
+// which must be an absolute http(s) URL.
+func parseBaseURL(name, rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid %s %q: not an absolute http(s) URL", name, rawURL)
+	}
+	return u, nil
+}
+
 func (p *Anilist) String() string {
 	return info.Name
 }
@@ -60,6 +106,7 @@ func (p *Anilist) Info() metadata.ProviderInfo {
 // SetLogger sets logger to use for this provider.
 func (p *Anilist) SetLogger(_logger *logger.Logger) {
 	p.logger = _logger
+	p.requester.SetLogger(_logger)
 }
 
 // Logger returns the set logger.
@@ -95,12 +142,10 @@ func (p *Anilist) SearchByID(ctx context.Context, id int) (metadata.Metadata, bo
 // Search for metadata with the given query.
 //
 // Implementation should only handle the request and and marshaling.
-func (p *Anilist) Search(ctx context.Context, query string) ([]metadata.Metadata, error) {
+func (p *Anilist) Search(ctx context.Context, query string, options metadata.SearchOptions) ([]metadata.Metadata, error) {
 	body := apiRequestBody{
-		Query: querySearchByName,
-		Variables: map[string]any{
-			"query": query,
-		},
+		Query:     querySearchByName,
+		Variables: searchVariables(query, options),
 	}
 	data, err := sendRequest[mangasData](ctx, p, body)
 	if err != nil {
@@ -112,6 +157,21 @@ func (p *Anilist) Search(ctx context.Context, query string) ([]metadata.Metadata
 	return mangas, nil
 }
 
+// SearchFilters returns the SearchOptions filters supported by the provider.
+func (p *Anilist) SearchFilters() []metadata.SearchFilter {
+	return searchFilters
+}
+
+// UnsupportedSearchValues returns the supported filters which values can't
+// be applied exactly, manhwa/manhua formats combined with other formats
+// or countries.
+func (p *Anilist) UnsupportedSearchValues(options metadata.SearchOptions) []metadata.SearchFilter {
+	if _, _, ok := searchFormats(options.Formats, strings.ToUpper(options.Country)); !ok {
+		return []metadata.SearchFilter{metadata.SearchFilterFormat}
+	}
+	return nil
+}
+
 // SetMangaProgress sets the reading progress for a given manga metadata id.
 func (p *Anilist) SetMangaProgress(ctx context.Context, id, chapterNumber int) error {
 	if id == 0 {
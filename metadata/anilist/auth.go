@@ -14,6 +14,21 @@ const (
 	OAuthAuthorizeURL = OAuthBaseURL + "authorize"
 )
 
+// PinURL is the OAuth pin URL, relative to Options.OAuthURL.
+func (p *Anilist) PinURL() string {
+	return p.oAuthURL.JoinPath("pin").String()
+}
+
+// TokenURL is the OAuth token URL, relative to Options.OAuthURL.
+func (p *Anilist) TokenURL() string {
+	return p.oAuthURL.JoinPath("token").String()
+}
+
+// AuthorizeURL is the OAuth authorize URL, relative to Options.OAuthURL.
+func (p *Anilist) AuthorizeURL() string {
+	return p.oAuthURL.JoinPath("authorize").String()
+}
+
 // Authenticated returns true if the Provider is
 // currently authenticated (user logged in).
 func (p *Anilist) Authenticated() bool {
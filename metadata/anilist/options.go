@@ -2,15 +2,47 @@ package anilist
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/luevano/libmangal/logger"
+	"github.com/luevano/libmangal/metadata/request"
 )
 
+// https://docs.anilist.co/guide/rate-limiting
+var defaultRateLimit = request.Options{
+	Rate:              90,
+	Period:            time.Minute,
+	Burst:             10,
+	MaxRetries:        3,
+	DefaultRetryAfter: time.Minute,
+	MaxRetryAfter:     2 * time.Minute,
+	SlowdownThreshold: 0.2,
+}
+
 // Options is options for Anilist client.
 type Options struct {
 	// HTTPClient is a http client used for Anilist API.
 	HTTPClient *http.Client
 
+	// APIURL is the base URL of the Anilist GraphQL API.
+	//
+	// Useful to point to a mock, caching proxy or mirror.
+	// If empty, the official API URL is used.
+	// It must be an absolute http(s) URL.
+	APIURL string
+
+	// OAuthURL is the base URL of the Anilist OAuth endpoints.
+	//
+	// If empty, OAuthBaseURL is used.
+	// It must be an absolute http(s) URL.
+	OAuthURL string
+
+	// RateLimit configures the requests rate limiting and retries.
+	//
+	// If zero, the default Anilist rate limit is used.
+	// Use request.Options.Disabled to turn it off.
+	RateLimit request.Options
+
 	// LogWriter used for logs progress.
 	Logger *logger.Logger
 }
@@ -19,6 +51,9 @@ type Options struct {
 func DefaultOptions() Options {
 	return Options{
 		HTTPClient: &http.Client{},
+		APIURL:     apiURL,
+		OAuthURL:   OAuthBaseURL,
+		RateLimit:  defaultRateLimit,
 		Logger:     logger.NewLogger(),
 	}
 }
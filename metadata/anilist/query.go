@@ -63,10 +63,34 @@ externalLinks {
 }
 `
 
+// querySearchByName null variables are ignored by the API
 const querySearchByName = `
-query ($query: String) {
-	Page (page: 1, perPage: 30) {
-		media (search: $query, type: MANGA) {
+query (
+	$query: String,
+	$page: Int,
+	$perPage: Int,
+	$format: [MediaFormat],
+	$status: [MediaStatus],
+	$startDateGreater: FuzzyDateInt,
+	$startDateLesser: FuzzyDateInt,
+	$country: CountryCode,
+	$genres: [String],
+	$isAdult: Boolean,
+	$sort: [MediaSort]
+) {
+	Page (page: $page, perPage: $perPage) {
+		media (
+			search: $query,
+			type: MANGA,
+			format_in: $format,
+			status_in: $status,
+			startDate_greater: $startDateGreater,
+			startDate_lesser: $startDateLesser,
+			countryOfOrigin: $country,
+			genre_in: $genres,
+			isAdult: $isAdult,
+			sort: $sort
+		) {
 			` + queryCommon + `
 		}
 	}
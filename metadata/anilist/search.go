@@ -0,0 +1,133 @@
+package anilist
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/luevano/libmangal/metadata"
+)
+
+// maxPerPage is the maximum amount of results per page allowed by the API.
+const maxPerPage = 50
+
+var searchFilters = []metadata.SearchFilter{
+	metadata.SearchFilterFormat,
+	metadata.SearchFilterStatus,
+	metadata.SearchFilterYear,
+	metadata.SearchFilterCountry,
+	metadata.SearchFilterGenres,
+	metadata.SearchFilterAdult,
+	metadata.SearchFilterSort,
+}
+
+var searchSorts = map[metadata.SearchSort]string{
+	metadata.SearchSortRelevance:  "SEARCH_MATCH",
+	metadata.SearchSortPopularity: "POPULARITY_DESC",
+	metadata.SearchSortScore:      "SCORE_DESC",
+	metadata.SearchSortTitle:      "TITLE_ROMAJI",
+	metadata.SearchSortStartDate:  "START_DATE_DESC",
+}
+
+// searchVariables maps the search options to the query variables.
+func searchVariables(query string, options metadata.SearchOptions) map[string]any {
+	variables := map[string]any{
+		"query":   query,
+		"page":    options.PageOrDefault(),
+		"perPage": options.LimitOrDefault(maxPerPage),
+	}
+
+	formats, country, _ := searchFormats(options.Formats, strings.ToUpper(options.Country))
+	if len(formats) != 0 {
+		variables["format"] = formats
+	}
+	if country != "" {
+		variables["country"] = country
+	}
+
+	if len(options.Status) != 0 {
+		status := make([]string, len(options.Status))
+		for i, s := range options.Status {
+			status[i] = string(s)
+		}
+		variables["status"] = status
+	}
+
+	// fuzzy dates are in the form YYYYMMDD, with zeros for unknown parts
+	if options.YearFrom != 0 {
+		variables["startDateGreater"] = options.YearFrom*10000 - 1
+	}
+	if options.YearTo != 0 {
+		variables["startDateLesser"] = (options.YearTo + 1) * 10000
+	}
+
+	if len(options.Genres) != 0 {
+		variables["genres"] = options.Genres
+	}
+
+	// isAdult true would only match adult results, so including them is not filtering
+	if options.Adult != nil && !*options.Adult {
+		variables["isAdult"] = false
+	}
+
+	sort, ok := searchSorts[options.Sort]
+	if !ok {
+		sort = searchSorts[metadata.SearchSortRelevance]
+	}
+	variables["sort"] = []string{sort}
+
+	return variables
+}
+
+// searchFormats maps the search formats to the Anilist formats
+// (without duplicates) and the country of origin.
+//
+// Anilist doesn't have manhwa/manhua formats, these are mangas with
+// korean/chinese country of origin. Returns false if they are combined
+// with other formats or countries, as the search can't be done exactly
+// and they are searched as any manga.
+func searchFormats(search []metadata.SearchFormat, country string) ([]string, string, bool) {
+	var (
+		formats   []string
+		countries []string
+		// formats that don't restrict the country
+		other bool
+	)
+	for _, format := range search {
+		var f string
+		switch format {
+		case metadata.SearchFormatManga:
+			f, other = "MANGA", true
+		case metadata.SearchFormatManhwa:
+			f = "MANGA"
+			if !slices.Contains(countries, "KR") {
+				countries = append(countries, "KR")
+			}
+		case metadata.SearchFormatManhua:
+			f = "MANGA"
+			if !slices.Contains(countries, "CN") {
+				countries = append(countries, "CN")
+			}
+		case metadata.SearchFormatNovel:
+			f, other = "NOVEL", true
+		case metadata.SearchFormatOneShot:
+			f, other = "ONE_SHOT", true
+		default:
+			continue
+		}
+		if !slices.Contains(formats, f) {
+			formats = append(formats, f)
+		}
+	}
+
+	if len(countries) == 0 {
+		return formats, country, true
+	}
+	switch {
+	case other || len(countries) > 1:
+		return formats, country, false
+	case country == "":
+		return formats, countries[0], true
+	default:
+		return formats, country, country == countries[0]
+	}
+}
@@ -8,8 +8,6 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"strconv"
-	"time"
 )
 
 type apiRequestBody struct {
@@ -35,38 +33,14 @@ func sendRequest[Data any](
 		return data, err
 	}
 
-	resp, err := anilist.genericRequest(ctx, http.MethodPost, apiURL, bytes.NewReader(marshalled), true)
+	resp, err := anilist.genericRequest(ctx, http.MethodPost, anilist.apiURL.String(), bytes.NewReader(marshalled), true)
 	if err != nil {
 		return data, err
 	}
 	defer resp.Body.Close()
 
-	// https://anilist.gitbook.io/anilist-apiv2-docs/overview/rate-limiting
-	if resp.StatusCode == http.StatusTooManyRequests {
-		retryAfter := resp.Header.Get("X-RateLimit-Remaining")
-		if retryAfter == "" {
-			// 90 seconds
-			retryAfter = "90"
-		}
-
-		seconds, err := strconv.Atoi(retryAfter)
-		if err != nil {
-			return data, err
-		}
-
-		anilist.logger.Log("rate limited, retrying in %d seconds", seconds)
-
-		select {
-		case <-time.After(time.Duration(seconds) * time.Second):
-		case <-ctx.Done():
-			return data, ctx.Err()
-		}
-
-		return sendRequest[Data](ctx, anilist, requestBody)
-	}
-
 	if resp.StatusCode != http.StatusOK {
-		return data, fmt.Errorf(resp.Status)
+		return data, fmt.Errorf("unexpected http status: %s", resp.Status)
 	}
 
 	var res apiResponse[Data]
@@ -95,5 +69,5 @@ func (p *Anilist) genericRequest(ctx context.Context, method, url string, body i
 		req.Header.Set("Authorization", "Bearer "+p.token)
 	}
 
-	return p.options.HTTPClient.Do(req)
+	return p.requester.Do(req)
 }
@@ -170,40 +170,131 @@ type ComicInfoXML struct {
 	// Notes a free text field, usually used to store information about
 	// the application that created the ComicInfo.xml file.
 	Notes string
+
+	// Pages information about each page (image) of the book.
+	Pages []ComicInfoPage
+}
+
+// ComicPageType is the type of a ComicInfoPage.
+type ComicPageType string
+
+const (
+	ComicPageTypeFrontCover ComicPageType = "FrontCover"
+	ComicPageTypeStory      ComicPageType = "Story"
+)
+
+// ComicInfoPage is the information of a single page of the book.
+type ComicInfoPage struct {
+	// Image is the index of the image in the archive, starting from 0.
+	Image int `xml:"Image,attr"`
+
+	// Type of the page.
+	Type ComicPageType `xml:"Type,attr,omitempty"`
+
+	// DoublePage is true if the page is a double-page spread.
+	DoublePage bool `xml:"DoublePage,attr,omitempty"`
+
+	// ImageSize is the size of the image file in bytes.
+	ImageSize int `xml:"ImageSize,attr,omitempty"`
+
+	// ImageWidth is the width of the image in pixels.
+	ImageWidth int `xml:"ImageWidth,attr,omitempty"`
+
+	// ImageHeight is the height of the image in pixels.
+	ImageHeight int `xml:"ImageHeight,attr,omitempty"`
 }
 
 func (c *ComicInfoXML) Marshal(options ComicInfoXMLOptions) ([]byte, error) {
 	return xml.MarshalIndent(c.wrapper(options), "", "  ")
 }
 
+// Unmarshal parses the ComicInfo.xml contents into c.
+//
+// The notes added by Marshal are removed, so they don't pile up.
+func (c *ComicInfoXML) Unmarshal(data []byte) error {
+	var wrapper comicInfoXMLWrapper
+	if err := xml.Unmarshal(data, &wrapper); err != nil {
+		return err
+	}
+
+	split := func(s string) []string {
+		if s == "" {
+			return nil
+		}
+		values := strings.Split(s, ",")
+		for i, v := range values {
+			values[i] = strings.TrimSpace(v)
+		}
+		return values
+	}
+
+	*c = ComicInfoXML{
+		Title:           wrapper.Title,
+		Series:          wrapper.Series,
+		Number:          wrapper.Number,
+		Web:             wrapper.Web,
+		Genres:          split(wrapper.Genre),
+		Summary:         wrapper.Summary,
+		Count:           wrapper.Count,
+		PageCount:       wrapper.PageCount,
+		Characters:      split(wrapper.Characters),
+		Year:            wrapper.Year,
+		Month:           wrapper.Month,
+		Day:             wrapper.Day,
+		Publisher:       wrapper.Publisher,
+		LanguageISO:     wrapper.LanguageISO,
+		StoryArc:        wrapper.StoryArc,
+		StoryArcNumber:  wrapper.StoryArcNumber,
+		ScanInformation: wrapper.ScanInformation,
+		AgeRating:       wrapper.AgeRating,
+		CommunityRating: wrapper.CommunityRating,
+		Review:          wrapper.Review,
+		GTIN:            wrapper.GTIN,
+		Format:          wrapper.Format,
+		Writers:         split(wrapper.Writer),
+		Pencillers:      split(wrapper.Penciller),
+		Letterers:       split(wrapper.Letterer),
+		Translators:     split(wrapper.Translator),
+		Tags:            split(wrapper.Tags),
+		Notes:           strings.TrimSuffix(wrapper.Notes, comicInfoNotesSuffix),
+	}
+	if wrapper.Pages != nil {
+		c.Pages = wrapper.Pages.Page
+	}
+	return nil
+}
+
+// comicInfoNotesSuffix is appended to the notes by Marshal.
+var comicInfoNotesSuffix = strings.Join([]string{
+	"",
+	"",
+	"Downloaded with libmangal",
+	"https://github.com/luevano/libmangal",
+}, "\n")
+
 func (c *ComicInfoXML) wrapper(options ComicInfoXMLOptions) comicInfoXMLWrapper {
 	// TODO: Make Manga field configurable
 	wrapper := comicInfoXMLWrapper{
-		XmlnsXsd:   "http://www.w3.org/2001/XMLSchema",
-		XmlnsXsi:   "http://www.w3.org/2001/XMLSchema-instance",
-		Title:      c.Title,
-		Series:     c.Series,
-		Number:     c.Number,
-		Web:        c.Web,
-		Genre:      strings.Join(c.Genres, ","),
-		Summary:    c.Summary,
-		Count:      c.Count,
-		PageCount:  c.PageCount,
-		Characters: strings.Join(c.Characters, ","),
-		Year:       c.Year,
-		Month:      c.Month,
-		Day:        c.Day,
-		Writer:     strings.Join(c.Writers, ","),
-		Penciller:  strings.Join(c.Pencillers, ","),
-		Letterer:   strings.Join(c.Letterers, ","),
-		Translator: strings.Join(c.Translators, ","),
-		Tags:       strings.Join(c.Tags, ","),
-		Notes: strings.Join([]string{
-			c.Notes,
-			"",
-			"Downloaded with libmangal",
-			"https://github.com/luevano/libmangal",
-		}, "\n"),
+		XmlnsXsd:        "http://www.w3.org/2001/XMLSchema",
+		XmlnsXsi:        "http://www.w3.org/2001/XMLSchema-instance",
+		Title:           c.Title,
+		Series:          c.Series,
+		Number:          c.Number,
+		Web:             c.Web,
+		Genre:           strings.Join(c.Genres, ","),
+		Summary:         c.Summary,
+		Count:           c.Count,
+		PageCount:       c.PageCount,
+		Characters:      strings.Join(c.Characters, ","),
+		Year:            c.Year,
+		Month:           c.Month,
+		Day:             c.Day,
+		Writer:          strings.Join(c.Writers, ","),
+		Penciller:       strings.Join(c.Pencillers, ","),
+		Letterer:        strings.Join(c.Letterers, ","),
+		Translator:      strings.Join(c.Translators, ","),
+		Tags:            strings.Join(c.Tags, ","),
+		Notes:           c.Notes + comicInfoNotesSuffix,
 		Manga:           "YesAndRightToLeft",
 		StoryArc:        c.StoryArc,
 		StoryArcNumber:  c.StoryArcNumber,
@@ -217,6 +308,10 @@ func (c *ComicInfoXML) wrapper(options ComicInfoXMLOptions) comicInfoXMLWrapper
 		Publisher:       c.Publisher,
 	}
 
+	if len(c.Pages) != 0 {
+		wrapper.Pages = &comicInfoPagesWrapper{Page: c.Pages}
+	}
+
 	if !options.AddDate {
 		wrapper.Year = 0
 		wrapper.Month = 0
@@ -268,4 +363,10 @@ type comicInfoXMLWrapper struct {
 	Format          string  `xml:"Format,omitempty"`
 	LanguageISO     string  `xml:"LanguageISO,omitempty"`
 	Publisher       string  `xml:"Publisher,omitempty"`
+
+	Pages *comicInfoPagesWrapper `xml:"Pages,omitempty"`
+}
+
+type comicInfoPagesWrapper struct {
+	Page []ComicInfoPage `xml:"Page"`
 }
@@ -0,0 +1,229 @@
+package metadata
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/philippgille/gokv"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	credentialSaltSize = 16
+	credentialKeySize  = 32
+
+	// scrypt parameters, recommended for interactive logins as of 2017
+	credentialScryptN = 1 << 15
+	credentialScryptR = 8
+	credentialScryptP = 1
+)
+
+// Credential is an authenticated session for a metadata Provider.
+type Credential struct {
+	// ProviderID is the ProviderInfo.ID of the Provider the credential belongs to.
+	ProviderID string `json:"provider_id"`
+
+	// User is the name of the authenticated user.
+	User string `json:"user"`
+
+	// AccessToken used to authorize the user.
+	AccessToken string `json:"access_token"`
+
+	// RefreshToken used to refresh the AccessToken. May be empty.
+	RefreshToken string `json:"refresh_token"`
+
+	// ExpiresAt is the time at which the AccessToken expires.
+	//
+	// Zero value means that the expiry is unknown.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ProviderWithCredential is a Provider that can log in with
+// and expose a full Credential, not only the access token.
+//
+// Useful for providers which tokens can be refreshed.
+type ProviderWithCredential interface {
+	Provider
+
+	// LoginWithCredential authorizes an user with the given credential.
+	LoginWithCredential(ctx context.Context, credential Credential) error
+
+	// Credential returns the current credential.
+	//
+	// It could change at any time if the provider refreshes it.
+	Credential() Credential
+}
+
+// CredentialStore persists Credentials encrypted with a passphrase.
+//
+// Credentials are keyed by ProviderInfo.ID and user, the last saved
+// credential for each provider is used when restoring sessions.
+type CredentialStore struct {
+	store      gokv.Store
+	passphrase []byte
+}
+
+// NewCredentialStore constructs a new CredentialStore on top of the given gokv.Store.
+//
+// The passphrase is used to derive the encryption key and must be non-empty.
+func NewCredentialStore(store gokv.Store, passphrase string) (*CredentialStore, error) {
+	if store == nil {
+		return nil, Error("nil gokv.Store passed to CredentialStore")
+	}
+	if passphrase == "" {
+		return nil, Error("CredentialStore passphrase must be non-empty")
+	}
+
+	return &CredentialStore{
+		store:      store,
+		passphrase: []byte(passphrase),
+	}, nil
+}
+
+// Get the credential for the given provider ID and user.
+func (s *CredentialStore) Get(providerID, user string) (Credential, bool, error) {
+	var credential Credential
+	found, err := s.get(credentialKey(providerID, user), &credential)
+	return credential, found, err
+}
+
+// Last gets the last saved credential for the given provider ID.
+func (s *CredentialStore) Last(providerID string) (Credential, bool, error) {
+	var user string
+	found, err := s.get(providerID, &user)
+	if err != nil || !found {
+		return Credential{}, false, err
+	}
+	return s.Get(providerID, user)
+}
+
+// Set saves the credential and marks it as the last one for its provider.
+func (s *CredentialStore) Set(credential Credential) error {
+	if credential.ProviderID == "" {
+		return Error("credential ProviderID must be non-empty")
+	}
+	if credential.AccessToken == "" {
+		return Error("credential AccessToken must be non-empty")
+	}
+
+	err := s.set(credentialKey(credential.ProviderID, credential.User), credential)
+	if err != nil {
+		return err
+	}
+	return s.set(credential.ProviderID, credential.User)
+}
+
+// Delete removes the credential for the given provider ID and user.
+func (s *CredentialStore) Delete(providerID, user string) error {
+	var last string
+	found, err := s.get(providerID, &last)
+	if err != nil {
+		return err
+	}
+	if found && last == user {
+		if err := s.store.Delete(providerID); err != nil {
+			return err
+		}
+	}
+	return s.store.Delete(credentialKey(providerID, user))
+}
+
+// Close closes the underlying store.
+func (s *CredentialStore) Close() error {
+	return s.store.Close()
+}
+
+func (s *CredentialStore) get(key string, v any) (bool, error) {
+	var sealed []byte
+	found, err := s.store.Get(key, &sealed)
+	if err != nil || !found {
+		return false, err
+	}
+
+	plain, err := s.decrypt(sealed)
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(plain, v)
+}
+
+func (s *CredentialStore) set(key string, v any) error {
+	plain, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	sealed, err := s.encrypt(plain)
+	if err != nil {
+		return err
+	}
+	return s.store.Set(key, sealed)
+}
+
+// encrypt seals the plain text with AES-GCM, the output
+// is laid out as salt | nonce | cipher text.
+func (s *CredentialStore) encrypt(plain []byte) ([]byte, error) {
+	salt := make([]byte, credentialSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := s.aead(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := append(salt, nonce...)
+	return aead.Seal(sealed, nonce, plain, nil), nil
+}
+
+func (s *CredentialStore) decrypt(sealed []byte) ([]byte, error) {
+	if len(sealed) < credentialSaltSize {
+		return nil, Error("malformed credential")
+	}
+	salt, sealed := sealed[:credentialSaltSize], sealed[credentialSaltSize:]
+
+	aead, err := s.aead(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, Error("malformed credential")
+	}
+	nonce, sealed := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+
+	plain, err := aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, Error("decrypting credential: wrong passphrase or corrupted data")
+	}
+	return plain, nil
+}
+
+// aead derives the key from the passphrase and given salt.
+func (s *CredentialStore) aead(salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(s.passphrase, salt, credentialScryptN, credentialScryptR, credentialScryptP, credentialKeySize)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func credentialKey(providerID, user string) string {
+	return providerID + "/" + user
+}
@@ -31,6 +31,13 @@ type DownloadedChapter struct {
 
 	// ChapterStatus is the status of the downloaded chapter.
 	BannerStatus DownloadStatus `json:"banner_status"`
+
+	// ImagesSize is the size in bytes of the page images as written.
+	ImagesSize int64 `json:"images_size,omitempty"`
+
+	// BytesSaved by the image pipeline (re-encoding, resizing, etc.) compared
+	// to the downloaded page images. Negative if the images grew.
+	BytesSaved int64 `json:"bytes_saved,omitempty"`
 }
 
 func (d *DownloadedChapter) Path() string {
@@ -2,9 +2,12 @@ package myanimelist
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 
 	"github.com/luevano/libmangal/metadata"
 )
@@ -15,20 +18,101 @@ const (
 	OAuthAuthorizeURL = OAuthBaseURL + "authorize"
 )
 
+// Token is the MyAnimeList OAuth token pair.
+//
+// Access tokens expire after about a month, the refresh token
+// is used to get a new pair without user interaction.
+type Token struct {
+	// AccessToken used to authorize the API requests.
+	AccessToken string `json:"access_token"`
+
+	// RefreshToken used to get a new token pair. May be empty,
+	// in which case the token can't be refreshed.
+	RefreshToken string `json:"refresh_token"`
+
+	// ExpiresAt is the time at which the AccessToken expires.
+	//
+	// Zero value means that the expiry is unknown.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// expiresWithin returns true if the token expires in less than d.
+//
+// Tokens with unknown expiry never expire.
+func (t Token) expiresWithin(d time.Duration) bool {
+	if t.ExpiresAt.IsZero() {
+		return false
+	}
+	return time.Until(t.ExpiresAt) < d
+}
+
+// canRefresh returns true if the token contains a refresh token.
+func (t Token) canRefresh() bool {
+	return t.RefreshToken != ""
+}
+
+// oAuthData is the response of the token endpoint.
+type oAuthData struct {
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (o oAuthData) toToken() Token {
+	token := Token{
+		AccessToken:  o.AccessToken,
+		RefreshToken: o.RefreshToken,
+	}
+	if o.ExpiresIn > 0 {
+		token.ExpiresAt = time.Now().Add(time.Duration(o.ExpiresIn) * time.Second)
+	}
+	return token
+}
+
+// TokenURL is the OAuth token URL, relative to Options.OAuthURL.
+func (p *MyAnimeList) TokenURL() string {
+	return p.oAuthURL.JoinPath("token").String()
+}
+
+// AuthorizeURL is the OAuth authorize URL, relative to Options.OAuthURL.
+func (p *MyAnimeList) AuthorizeURL() string {
+	return p.oAuthURL.JoinPath("authorize").String()
+}
+
 // Authenticated returns true if the Provider is
 // currently authenticated (user logged in).
 func (p *MyAnimeList) Authenticated() bool {
-	return p.token != ""
+	return p.Token().AccessToken != ""
+}
+
+// Token returns the current token pair.
+//
+// Useful to persist the token after a refresh.
+func (p *MyAnimeList) Token() Token {
+	p.tokenMu.Lock()
+	defer p.tokenMu.Unlock()
+	return p.token
 }
 
 // Login authorizes an user with the given access token.
+//
+// The token can't be refreshed, use LoginWithToken
+// to provide the refresh token and expiry.
 func (p *MyAnimeList) Login(ctx context.Context, token string) error {
-	p.token = token
+	return p.LoginWithToken(ctx, Token{AccessToken: token})
+}
+
+// LoginWithToken authorizes an user with the given token pair.
+//
+// If the access token is expired (or close to) it will be refreshed first.
+func (p *MyAnimeList) LoginWithToken(ctx context.Context, token Token) error {
+	p.setToken(token)
 
 	user, err := p.getAuthenticatedUser(ctx)
 	if err != nil {
 		// remove token as it's possible it's not valid
-		p.token = ""
+		p.setToken(Token{})
 		return Error(err.Error())
 	}
 	p.user = user
@@ -36,16 +120,148 @@ func (p *MyAnimeList) Login(ctx context.Context, token string) error {
 	return nil
 }
 
+// LoginWithCredential authorizes an user with the given credential.
+func (p *MyAnimeList) LoginWithCredential(ctx context.Context, credential metadata.Credential) error {
+	return p.LoginWithToken(ctx, Token{
+		AccessToken:  credential.AccessToken,
+		RefreshToken: credential.RefreshToken,
+		ExpiresAt:    credential.ExpiresAt,
+	})
+}
+
+// Credential returns the current token pair as a credential.
+func (p *MyAnimeList) Credential() metadata.Credential {
+	token := p.Token()
+	credential := metadata.Credential{
+		ProviderID:   info.ID,
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		ExpiresAt:    token.ExpiresAt,
+	}
+	if p.user != nil {
+		credential.User = p.user.Name()
+	}
+	return credential
+}
+
 // Logout de-authorizes the currently authorized user.
 func (p *MyAnimeList) Logout() error {
 	if !p.Authenticated() {
 		return errors.New("no authenticated user to logout")
 	}
 	p.user = nil
-	p.token = ""
+	p.setToken(Token{})
+	return nil
+}
+
+// RefreshToken requests a new token pair using the current refresh token.
+//
+// Options.OnTokenRefresh is called with the new token pair.
+func (p *MyAnimeList) RefreshToken(ctx context.Context) error {
+	return p.refreshToken(ctx, p.Token().AccessToken)
+}
+
+// refreshToken does the actual refresh.
+//
+// If the current access token differs from the stale one, then
+// it was already refreshed by a concurrent request. Only refreshMu is
+// held during the request, so Token is never blocked by it, and
+// Options.OnTokenRefresh is called without any lock held.
+func (p *MyAnimeList) refreshToken(ctx context.Context, stale string) error {
+	token, err := p.requestRefresh(ctx, stale)
+	if err != nil || token == nil {
+		return err
+	}
+
+	if p.options.OnTokenRefresh != nil {
+		p.options.OnTokenRefresh(*token)
+	}
 	return nil
 }
 
+// requestRefresh requests and sets the new token pair,
+// nil if it was already refreshed by a concurrent request.
+func (p *MyAnimeList) requestRefresh(ctx context.Context, stale string) (*Token, error) {
+	p.refreshMu.Lock()
+	defer p.refreshMu.Unlock()
+
+	current := p.Token()
+	if current.AccessToken != stale {
+		return nil, nil
+	}
+	if !current.canRefresh() {
+		return nil, Error("token can't be refreshed, no refresh token available")
+	}
+	p.logger.Log("refreshing MyAnimeList access token")
+
+	params := url.Values{}
+	params.Set("client_id", p.options.ClientID)
+	if p.options.ClientSecret != "" {
+		params.Set("client_secret", p.options.ClientSecret)
+	}
+	params.Set("grant_type", "refresh_token")
+	params.Set("refresh_token", current.RefreshToken)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenURL(), strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.requester.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, Error("refreshing token: " + responseError(resp).Error())
+	}
+
+	var data oAuthData
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+	if data.AccessToken == "" {
+		return nil, Error("refreshing token: received empty access token")
+	}
+
+	token := data.toToken()
+	// MAL always returns a new refresh token, but just in case keep the old one
+	if token.RefreshToken == "" {
+		token.RefreshToken = current.RefreshToken
+	}
+
+	p.tokenMu.Lock()
+	defer p.tokenMu.Unlock()
+	// logged out (or in with another token) during the refresh
+	if p.token.AccessToken != stale {
+		return nil, nil
+	}
+	p.token = token
+	return &token, nil
+}
+
+// ensureFreshToken refreshes the token if it is close to expire.
+//
+// Returns the access token to use for the request.
+func (p *MyAnimeList) ensureFreshToken(ctx context.Context) (string, error) {
+	token := p.Token()
+	if token.canRefresh() && token.expiresWithin(p.options.RefreshThreshold) {
+		if err := p.refreshToken(ctx, token.AccessToken); err != nil {
+			return "", err
+		}
+	}
+	return p.Token().AccessToken, nil
+}
+
+func (p *MyAnimeList) setToken(token Token) {
+	p.tokenMu.Lock()
+	defer p.tokenMu.Unlock()
+	p.token = token
+}
+
 // getAuthenticatedUser will query for the user data to the MyAnimeList API.
 func (p *MyAnimeList) getAuthenticatedUser(ctx context.Context) (metadata.User, error) {
 	params := url.Values{}
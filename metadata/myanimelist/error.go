@@ -1,8 +1,44 @@
 package myanimelist
 
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
 // Error is a general error for MyAnimeList operations.
 type Error string
 
 func (e Error) Error() string {
 	return "mal: " + string(e)
 }
+
+// apiError is the error body returned by the MyAnimeList API.
+type apiError struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+	Hint    string `json:"hint"`
+}
+
+// responseError builds an Error from a non-OK response,
+// including the API error message if available.
+func responseError(resp *http.Response) error {
+	msg := "unexpected http status: " + resp.Status
+
+	var res apiError
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	if json.Unmarshal(raw, &res) == nil && res.Error != "" {
+		msg += " (" + res.Error
+		if res.Message != "" {
+			msg += ": " + res.Message
+		} else if res.Hint != "" {
+			msg += ": " + res.Hint
+		}
+		msg += ")"
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		msg += ", the access token is invalid or expired"
+	}
+	return Error(msg)
+}
@@ -8,9 +8,11 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/luevano/libmangal/logger"
 	"github.com/luevano/libmangal/metadata"
+	"github.com/luevano/libmangal/metadata/request"
 )
 
 // Reference docs:
@@ -18,6 +20,9 @@ import (
 
 const apiURL = "https://api.myanimelist.net/v2"
 
+// maxLimit is the maximum amount of results per page allowed by the API.
+const maxLimit = 100
+
 var info = metadata.ProviderInfo{
 	ID:      "myanimelist",
 	Code:    metadata.IDCodeMyAnimeList,
@@ -27,19 +32,29 @@ var info = metadata.ProviderInfo{
 	Website: "https://myanimelist.net/",
 }
 
-var _ metadata.Provider = (*MyAnimeList)(nil)
+var _ metadata.ProviderWithCredential = (*MyAnimeList)(nil)
 
 // MyAnimeList is a metadata.Provider implementation for MyAnimeList.
 type MyAnimeList struct {
 	// authenticated user info
-	user  metadata.User
-	token string
-
-	options Options
-	logger  *logger.Logger
+	user    metadata.User
+	token   Token
+	tokenMu sync.Mutex
+	// refreshMu serializes the token refreshes, tokenMu is
+	// not held during the refresh request
+	refreshMu sync.Mutex
+
+	options   Options
+	requester *request.Client
+	logger    *logger.Logger
+	// parsed Options.APIURL and Options.OAuthURL
+	apiURL   *url.URL
+	oAuthURL *url.URL
 }
 
 // NewMAL constructs new MyAnimeList client.
+//
+// Returns an error if Options.APIURL or Options.OAuthURL are invalid.
 func NewMAL(options Options) (*MyAnimeList, error) {
 	if options.ClientID == "" {
 		return nil, errors.New("MAL ClientID must not be empty")
@@ -50,14 +65,50 @@ func NewMAL(options Options) (*MyAnimeList, error) {
 	if l == nil {
 		l = logger.NewLogger()
 	}
+	if options.APIURL == "" {
+		options.APIURL = apiURL
+	}
+	if options.OAuthURL == "" {
+		options.OAuthURL = OAuthBaseURL
+	}
+	api, err := parseBaseURL("APIURL", options.APIURL)
+	if err != nil {
+		return nil, err
+	}
+	oAuth, err := parseBaseURL("OAuthURL", options.OAuthURL)
+	if err != nil {
+		return nil, err
+	}
+	if options.RateLimit == (request.Options{}) {
+		options.RateLimit = defaultRateLimit
+	}
+	requester := request.NewClient(options.HTTPClient, options.RateLimit)
+	requester.SetLogger(l)
+
 	mal := &MyAnimeList{
-		options: options,
-		logger:  l,
+		options:   options,
+		requester: requester,
+		logger:    l,
+		apiURL:    api,
+		oAuthURL:  oAuth,
 	}
 
 	return mal, nil
 }
 
+// parseBaseURL parses the base URL of the option name,
+// which must be an absolute http(s) URL.
+func parseBaseURL(name, rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid %s %q: not an absolute http(s) URL", name, rawURL)
+	}
+	return u, nil
+}
+
 func (p *MyAnimeList) String() string {
 	return info.Name
 }
@@ -70,6 +121,7 @@ func (p *MyAnimeList) Info() metadata.ProviderInfo {
 // SetLogger sets logger to use for this provider.
 func (p *MyAnimeList) SetLogger(_logger *logger.Logger) {
 	p.logger = _logger
+	p.requester.SetLogger(_logger)
 }
 
 // Logger returns the set logger.
@@ -101,11 +153,20 @@ func (p *MyAnimeList) SearchByID(ctx context.Context, id int) (metadata.Metadata
 // Search for metadata with the given query.
 //
 // Implementation should only handle the request and and marshaling.
-func (p *MyAnimeList) Search(ctx context.Context, query string) ([]metadata.Metadata, error) {
+//
+// Only pagination and the adult filter are supported by the API.
+func (p *MyAnimeList) Search(ctx context.Context, query string, options metadata.SearchOptions) ([]metadata.Metadata, error) {
+	limit := options.LimitOrDefault(maxLimit)
+	offset := (options.PageOrDefault() - 1) * limit
+
 	params := p.commonMangaReqParams()
 	params.Set("q", query)
-	params.Set("offset", "0")
-	params.Set("limit", "30")
+	params.Set("offset", strconv.Itoa(offset))
+	params.Set("limit", strconv.Itoa(limit))
+	// the adult filter (if set) takes precedence over Options.NSFW
+	if options.Adult != nil {
+		params.Set("nsfw", strconv.FormatBool(*options.Adult))
+	}
 
 	var res mangasResponse
 	err := p.request(ctx, http.MethodGet, "manga", params, p.commonMangaReqHeaders(), nil, &res)
@@ -118,6 +179,11 @@ func (p *MyAnimeList) Search(ctx context.Context, query string) ([]metadata.Meta
 	return mangas, nil
 }
 
+// SearchFilters returns the SearchOptions filters supported by the provider.
+func (p *MyAnimeList) SearchFilters() []metadata.SearchFilter {
+	return []metadata.SearchFilter{metadata.SearchFilterAdult}
+}
+
 // SetMangaProgress sets the reading progress for a given manga metadata id.
 func (p *MyAnimeList) SetMangaProgress(ctx context.Context, id, chapterNumber int) error {
 	if id == 0 {
@@ -2,20 +2,67 @@ package myanimelist
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/luevano/libmangal/logger"
+	"github.com/luevano/libmangal/metadata/request"
 )
 
+// MyAnimeList doesn't document its rate limits, be conservative.
+var defaultRateLimit = request.Options{
+	Rate:              60,
+	Period:            time.Minute,
+	Burst:             5,
+	MaxRetries:        3,
+	DefaultRetryAfter: 30 * time.Second,
+	MaxRetryAfter:     2 * time.Minute,
+	SlowdownThreshold: 0.2,
+}
+
 type Options struct {
 	// ClientID of the MyAnimeList API client. Required.
 	ClientID string
 
-	// NSFW if NSFW mangas should be included in the searches.
+	// ClientSecret of the MyAnimeList API client.
+	//
+	// Only needed to refresh tokens for clients of type "web".
+	ClientSecret string
+
+	// RefreshThreshold is how close to the access token expiry
+	// it will be refreshed before making a request.
+	RefreshThreshold time.Duration
+
+	// OnTokenRefresh is called with the new token pair after a refresh,
+	// so it can be persisted. May be nil.
+	OnTokenRefresh func(token Token)
+
+	// NSFW if NSFW mangas should be included in the responses.
+	//
+	// Search uses metadata.SearchOptions.Adult instead, if set.
 	NSFW bool
 
 	// HTTPClient is a http client used for Anilist API.
 	HTTPClient *http.Client
 
+	// APIURL is the base URL of the MyAnimeList API.
+	//
+	// Useful to point to a mock, caching proxy or mirror.
+	// If empty, the official API URL is used.
+	// It must be an absolute http(s) URL.
+	APIURL string
+
+	// OAuthURL is the base URL of the MyAnimeList OAuth endpoints.
+	//
+	// If empty, OAuthBaseURL is used.
+	// It must be an absolute http(s) URL.
+	OAuthURL string
+
+	// RateLimit configures the requests rate limiting and retries.
+	//
+	// If zero, a conservative default rate limit is used.
+	// Use request.Options.Disabled to turn it off.
+	RateLimit request.Options
+
 	// LogWriter used for logs progress.
 	//
 	// If Logger is nil, a new one will be created.
@@ -27,8 +74,12 @@ type Options struct {
 // Note: the ClientID still needs to be passed separately.
 func DefaultOptions() Options {
 	return Options{
-		NSFW:       false,
-		HTTPClient: &http.Client{},
-		Logger:     logger.NewLogger(),
+		NSFW:             false,
+		RefreshThreshold: 24 * time.Hour,
+		HTTPClient:       &http.Client{},
+		APIURL:           apiURL,
+		OAuthURL:         OAuthBaseURL,
+		RateLimit:        defaultRateLimit,
+		Logger:           logger.NewLogger(),
 	}
 }
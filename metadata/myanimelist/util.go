@@ -1,9 +1,9 @@
 package myanimelist
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
 	"io"
 	"net/http"
 	"net/url"
@@ -78,32 +78,63 @@ func (p *MyAnimeList) request(
 	body io.Reader,
 	res any,
 ) error {
-	u, _ := url.Parse(apiURL)
-	u = u.JoinPath(path)
+	u := p.apiURL.JoinPath(path)
 	u.RawQuery = params.Encode()
 
-	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
-	if err != nil {
-		return err
-	}
-
-	if p.Authenticated() {
-		headers.Set("Authorization", "Bearer "+p.token)
-	} else {
-		headers.Set("X-MAL-CLIENT-ID", p.options.ClientID)
+	// the body needs to be re-read in case of a retry
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = io.ReadAll(body)
+		if err != nil {
+			return err
+		}
 	}
-	req.Header = headers
 
-	resp, err := p.options.HTTPClient.Do(req)
+	token, err := p.ensureFreshToken(ctx)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf(resp.Status)
+	retried := false
+	for {
+		req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+
+		req.Header = headers.Clone()
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		} else {
+			req.Header.Set("X-MAL-CLIENT-ID", p.options.ClientID)
+		}
+
+		resp, err := p.requester.Do(req)
+		if err != nil {
+			return err
+		}
+
+		// the token could've been revoked or expired without known expiry,
+		// try to refresh it once and retry the request
+		if resp.StatusCode == http.StatusUnauthorized && token != "" && !retried && p.Token().canRefresh() {
+			resp.Body.Close()
+			retried = true
+
+			p.logger.Log("unauthorized MyAnimeList request, refreshing token and retrying")
+			if err := p.refreshToken(ctx, token); err != nil {
+				return err
+			}
+			token = p.Token().AccessToken
+			continue
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return responseError(resp)
+		}
+		return json.NewDecoder(resp.Body).Decode(&res)
 	}
-	return json.NewDecoder(resp.Body).Decode(&res)
 }
 
 // commonMangaReqParams is a convenience method to get the common manga req params.
@@ -15,6 +15,11 @@ type ProviderWithCacheOptions struct {
 	//
 	// It will use the given provider's ID as the dbName.
 	CacheStore func(dbName, bucketName string) (gokv.Store, error)
+
+	// Credentials is the store used to persist the authenticated sessions.
+	//
+	// If nil, sessions only live in memory.
+	Credentials *CredentialStore
 }
 
 // DefaultProviderWithCacheOptions constructs the default ProviderWithCacheOptions.
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/luevano/libmangal/logger"
 	"github.com/philippgille/gokv"
@@ -98,7 +99,11 @@ type Provider interface {
 	// Search for metadata with the given query.
 	//
 	// Implementation should only handle the request and and marshaling.
-	Search(ctx context.Context, query string) ([]Metadata, error)
+	// Filters not listed in SearchFilters should be ignored.
+	Search(ctx context.Context, query string, options SearchOptions) ([]Metadata, error)
+
+	// SearchFilters returns the SearchOptions filters supported by the provider.
+	SearchFilters() []SearchFilter
 
 	// SetMangaProgress sets the reading progress for a given manga metadata id.
 	SetMangaProgress(ctx context.Context, id, chapterNumber int) error
@@ -124,9 +129,15 @@ type Provider interface {
 //
 // This is a wrapper on a normal Provider.
 type ProviderWithCache struct {
-	provider Provider
-	store    store
-	logger   *logger.Logger
+	provider    Provider
+	store       store
+	credentials *CredentialStore
+	logger      *logger.Logger
+
+	// credential is the last saved credential, requests
+	// sync it concurrently so it's guarded by credentialMu
+	credential   Credential
+	credentialMu sync.Mutex
 }
 
 // NewProviderWithCache constructs new Provider with cache given the Provider.
@@ -149,14 +160,21 @@ func NewProviderWithCache(options ProviderWithCacheOptions) (*ProviderWithCache,
 	}
 
 	p := &ProviderWithCache{
-		provider: options.Provider,
-		store:    s,
-		logger:   l,
+		provider:    options.Provider,
+		store:       s,
+		credentials: options.Credentials,
+		logger:      l,
 	}
 
 	return p, nil
 }
 
+// Close closes the cache store, the CredentialStore is not closed
+// as it can be shared between providers.
+func (p *ProviderWithCache) Close() error {
+	return p.store.Close()
+}
+
 func (p *ProviderWithCache) String() string {
 	return p.provider.String()
 }
@@ -193,6 +211,7 @@ func (p *ProviderWithCache) SearchByID(ctx context.Context, id int) (Metadata, b
 	}
 
 	meta, ok, err := p.provider.SearchByID(ctx, id)
+	p.syncCredential()
 	if err != nil {
 		return nil, false, Error(err.Error())
 	}
@@ -213,9 +232,21 @@ func (p *ProviderWithCache) SearchByID(ctx context.Context, id int) (Metadata, b
 // Search for metadata with the given query.
 //
 // Implementation should only handle the request and and marshaling.
-func (p *ProviderWithCache) Search(ctx context.Context, query string) ([]Metadata, error) {
+// Filters not listed in SearchFilters are ignored.
+func (p *ProviderWithCache) Search(ctx context.Context, query string, options SearchOptions) ([]Metadata, error) {
 	p.logger.Log("searching manga metadata with query %q on %q", query, p.Info().Name)
-	ids, found, err := p.store.getQueryIDs(query)
+	if unsupported := UnsupportedSearchFilters(p.provider, options); len(unsupported) != 0 {
+		p.logger.Log("unsupported search filters on %q will be ignored: %v", p.Info().Name, unsupported)
+	}
+
+	// keep the plain query as the key for the default search
+	// so the cache is shared with the simple searches
+	key := query
+	if options.key() != DefaultSearchOptions().key() {
+		key = query + "|" + options.key()
+	}
+
+	ids, found, err := p.store.getQueryIDs(key)
 	if err != nil {
 		return nil, Error(err.Error())
 	}
@@ -233,7 +264,8 @@ func (p *ProviderWithCache) Search(ctx context.Context, query string) ([]Metadat
 		return metas, nil
 	}
 
-	metas, err := p.provider.Search(ctx, query)
+	metas, err := p.provider.Search(ctx, query, options)
+	p.syncCredential()
 	if err != nil {
 		return nil, err
 	}
@@ -252,7 +284,7 @@ func (p *ProviderWithCache) Search(ctx context.Context, query string) ([]Metadat
 		ids[i] = id
 	}
 
-	err = p.store.setQueryIDs(query, ids)
+	err = p.store.setQueryIDs(key, ids)
 	if err != nil {
 		return nil, Error(err.Error())
 	}
@@ -260,6 +292,11 @@ func (p *ProviderWithCache) Search(ctx context.Context, query string) ([]Metadat
 	return metas, nil
 }
 
+// SearchFilters returns the SearchOptions filters supported by the provider.
+func (p *ProviderWithCache) SearchFilters() []SearchFilter {
+	return p.provider.SearchFilters()
+}
+
 // FindClosest metadata with the given title with its closest result.
 func (p *ProviderWithCache) FindClosest(ctx context.Context, title string, tries, steps int) (Metadata, bool, error) {
 	p.logger.Log("finding closest manga metadata with title %q on %q", title, p.Info().Name)
@@ -303,7 +340,7 @@ func (p *ProviderWithCache) findClosest(ctx context.Context, title string, tries
 	for i := 0; i < tries; i++ {
 		p.logger.Log("finding closest try %d/%d", i+1, tries)
 
-		metas, err := p.Search(ctx, title)
+		metas, err := p.Search(ctx, title, DefaultSearchOptions())
 		if err != nil {
 			return nil, false, err
 		}
@@ -350,7 +387,9 @@ func (p *ProviderWithCache) BindTitleWithID(title string, id int) error {
 // For ProviderWithCache this is only a wrapper around the actual provider's method.
 func (p *ProviderWithCache) SetMangaProgress(ctx context.Context, id, chapterNumber int) error {
 	p.logger.Log("setting manga chapter progress (%d) for manga id %d on %q", chapterNumber, id, p.Info().Name)
-	return p.provider.SetMangaProgress(ctx, id, chapterNumber)
+	err := p.provider.SetMangaProgress(ctx, id, chapterNumber)
+	p.syncCredential()
+	return err
 }
 
 // Authenticated returns true if the Provider is
@@ -367,13 +406,152 @@ func (p *ProviderWithCache) User() User {
 }
 
 // Login authorizes an user with the given access token.
+//
+// If a CredentialStore is set, the session is persisted.
 func (p *ProviderWithCache) Login(ctx context.Context, token string) error {
 	p.logger.Log("logging in to %q", p.Info().Name)
-	return p.provider.Login(ctx, token)
+	if err := p.provider.Login(ctx, token); err != nil {
+		return err
+	}
+	return p.saveCredential(Credential{AccessToken: token})
+}
+
+// LoginWithCredential authorizes an user with the given credential.
+//
+// If the underlying provider is not a ProviderWithCredential,
+// only the access token is used.
+func (p *ProviderWithCache) LoginWithCredential(ctx context.Context, credential Credential) error {
+	p.logger.Log("logging in to %q with credential", p.Info().Name)
+	var err error
+	if withCredential, ok := p.provider.(ProviderWithCredential); ok {
+		err = withCredential.LoginWithCredential(ctx, credential)
+	} else {
+		err = p.provider.Login(ctx, credential.AccessToken)
+	}
+	if err != nil {
+		return err
+	}
+	return p.saveCredential(credential)
+}
+
+// Credential returns the current credential.
+func (p *ProviderWithCache) Credential() Credential {
+	if withCredential, ok := p.provider.(ProviderWithCredential); ok {
+		return p.withInfo(withCredential.Credential())
+	}
+	p.credentialMu.Lock()
+	defer p.credentialMu.Unlock()
+	return p.credential
+}
+
+// RestoreSession logs in with the last saved credential for this provider.
+//
+// Returns false if there is no CredentialStore or no saved credential.
+func (p *ProviderWithCache) RestoreSession(ctx context.Context) (bool, error) {
+	if p.credentials == nil {
+		return false, nil
+	}
+
+	credential, found, err := p.credentials.Last(p.Info().ID)
+	if err != nil {
+		return false, Error(err.Error())
+	}
+	if !found {
+		return false, nil
+	}
+
+	p.logger.Log("restoring session of user %q on %q", credential.User, p.Info().Name)
+	if err := p.LoginWithCredential(ctx, credential); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 // Logout de-authorizes the currently authorized user.
+//
+// If a CredentialStore is set, the persisted session is removed.
 func (p *ProviderWithCache) Logout() error {
 	p.logger.Log("logging out of %q", p.Info().Name)
-	return p.provider.Logout()
+	p.credentialMu.Lock()
+	defer p.credentialMu.Unlock()
+	user := p.credential.User
+	if err := p.provider.Logout(); err != nil {
+		return err
+	}
+	p.credential = Credential{}
+
+	if p.credentials == nil {
+		return nil
+	}
+	if err := p.credentials.Delete(p.Info().ID, user); err != nil {
+		return Error(err.Error())
+	}
+	return nil
+}
+
+// saveCredential persists the credential after a successful login.
+func (p *ProviderWithCache) saveCredential(credential Credential) error {
+	// prefer the full credential, it could've been refreshed during login
+	if withCredential, ok := p.provider.(ProviderWithCredential); ok {
+		credential = withCredential.Credential()
+	}
+	credential = p.withInfo(credential)
+
+	p.credentialMu.Lock()
+	defer p.credentialMu.Unlock()
+	p.credential = credential
+	if p.credentials == nil {
+		return nil
+	}
+	if err := p.credentials.Set(credential); err != nil {
+		return Error(err.Error())
+	}
+	return nil
+}
+
+// syncCredential persists the credential if the provider refreshed it.
+//
+// The lock is held while saving, so an older credential
+// never overwrites a newer one in the CredentialStore.
+func (p *ProviderWithCache) syncCredential() {
+	if p.credentials == nil {
+		return
+	}
+	withCredential, ok := p.provider.(ProviderWithCredential)
+	if !ok {
+		return
+	}
+	credential := p.withInfo(withCredential.Credential())
+
+	p.credentialMu.Lock()
+	defer p.credentialMu.Unlock()
+	if p.credential.AccessToken == "" || credential.AccessToken == "" || sameCredential(credential, p.credential) {
+		return
+	}
+
+	p.logger.Log("credential changed on %q, saving it", p.Info().Name)
+	p.credential = credential
+	if err := p.credentials.Set(credential); err != nil {
+		p.logger.Log("error while saving credential: %s", err.Error())
+	}
+}
+
+// sameCredential compares the credentials field by field. The expiries are
+// compared with Equal, == would also compare their locations and monotonic
+// clock readings, which differ for the same instant once (un)marshaled.
+func sameCredential(a, b Credential) bool {
+	return a.ProviderID == b.ProviderID &&
+		a.User == b.User &&
+		a.AccessToken == b.AccessToken &&
+		a.RefreshToken == b.RefreshToken &&
+		a.ExpiresAt.Equal(b.ExpiresAt)
+}
+
+// withInfo fills the provider and user information of the credential.
+func (p *ProviderWithCache) withInfo(credential Credential) Credential {
+	credential.ProviderID = p.Info().ID
+	if user := p.provider.User(); user != nil {
+		credential.User = user.Name()
+	}
+	return credential
 }
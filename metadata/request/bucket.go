@@ -0,0 +1,108 @@
+package request
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// bucket is a token bucket rate limiter, with support
+// for pauses and a minimum interval between requests.
+type bucket struct {
+	mu sync.Mutex
+
+	// tokens currently available, negative means reserved in advance
+	tokens   float64
+	capacity float64
+	// refill is the amount of tokens per second, zero means unlimited
+	refill float64
+	last   time.Time
+
+	// notBefore is the time before which no request is allowed
+	notBefore time.Time
+	// interval is the minimum time between requests
+	interval time.Duration
+	// prev is the time at which the last request was allowed
+	prev time.Time
+}
+
+func newBucket(rate, burst int, period time.Duration) *bucket {
+	b := &bucket{last: time.Now()}
+	if rate <= 0 || period <= 0 {
+		return b
+	}
+
+	if burst <= 0 {
+		burst = rate
+	}
+	b.capacity = float64(burst)
+	b.tokens = b.capacity
+	b.refill = float64(rate) / period.Seconds()
+	return b
+}
+
+// reserve takes a token and returns the time to wait before using it.
+func (b *bucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var wait time.Duration
+	if b.refill > 0 {
+		b.tokens += now.Sub(b.last).Seconds() * b.refill
+		if b.tokens > b.capacity {
+			b.tokens = b.capacity
+		}
+		b.last = now
+
+		b.tokens--
+		if b.tokens < 0 {
+			wait = time.Duration(-b.tokens / b.refill * float64(time.Second))
+		}
+	}
+
+	if w := b.notBefore.Sub(now); w > wait {
+		wait = w
+	}
+	// use the current interval, so a change applies to the next request
+	if w := b.prev.Add(b.interval).Sub(now); w > wait {
+		wait = w
+	}
+	b.prev = now.Add(wait)
+	return wait
+}
+
+// wait blocks until a request is allowed or the context is done.
+func (b *bucket) wait(ctx context.Context) error {
+	wait := b.reserve(time.Now())
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pauseUntil blocks all requests until t.
+func (b *bucket) pauseUntil(t time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if t.After(b.notBefore) {
+		b.notBefore = t
+	}
+}
+
+// setInterval sets the minimum time between requests.
+func (b *bucket) setInterval(interval time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.interval = interval
+}
@@ -0,0 +1,231 @@
+// Package request is the HTTP layer shared by the metadata providers.
+//
+// It handles client side rate limiting with a token bucket, retries on
+// rate limited responses honoring the Retry-After header and slows down
+// proactively when the remaining quota reported by the API is low.
+package request
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/luevano/libmangal/logger"
+)
+
+const (
+	HeaderRetryAfter         = "Retry-After"
+	HeaderRateLimitLimit     = "X-RateLimit-Limit"
+	HeaderRateLimitRemaining = "X-RateLimit-Remaining"
+	HeaderRateLimitReset     = "X-RateLimit-Reset"
+)
+
+// Options configures the rate limiting and retry behavior.
+type Options struct {
+	// Disabled turns off the rate limiting, retries and slowdown,
+	// the other options are ignored.
+	//
+	// Needed to disable them when zero Options means the defaults.
+	Disabled bool
+
+	// Rate is the amount of requests allowed per Period.
+	//
+	// Zero means no client side limit.
+	Rate int
+
+	// Period in which Rate requests are allowed.
+	Period time.Duration
+
+	// Burst is the maximum amount of requests done at once.
+	//
+	// If zero, Rate is used.
+	Burst int
+
+	// MaxRetries is the maximum amount of retries on
+	// rate limited (429) or unavailable (503) responses.
+	MaxRetries int
+
+	// DefaultRetryAfter is the time to wait before retrying
+	// when the response doesn't contain a valid Retry-After header.
+	DefaultRetryAfter time.Duration
+
+	// MaxRetryAfter caps the time to wait before retrying.
+	//
+	// If the server asks to wait longer, the response is returned as is.
+	MaxRetryAfter time.Duration
+
+	// SlowdownThreshold is the fraction of remaining quota (from 0 to 1)
+	// below which requests are spread until the quota resets.
+	//
+	// Zero disables the proactive slowdown.
+	SlowdownThreshold float64
+}
+
+// Client is a rate limited http client.
+type Client struct {
+	client  *http.Client
+	options Options
+	bucket  *bucket
+	logger  *logger.Logger
+}
+
+// NewClient constructs a new Client on top of the given http client.
+func NewClient(client *http.Client, options Options) *Client {
+	if client == nil {
+		client = &http.Client{}
+	}
+	if options.Disabled {
+		options = Options{Disabled: true}
+	}
+
+	return &Client{
+		client:  client,
+		options: options,
+		bucket:  newBucket(options.Rate, options.Burst, options.Period),
+		logger:  logger.NewLogger(),
+	}
+}
+
+// SetLogger sets logger to use for this client.
+func (c *Client) SetLogger(l *logger.Logger) {
+	c.logger = l
+}
+
+// Do sends the request once the rate limiter allows it.
+//
+// Rate limited responses are retried up to Options.MaxRetries,
+// for requests with a body it must be re-readable (Request.GetBody).
+// If retries are exhausted the last response is returned.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		if err := c.bucket.wait(ctx); err != nil {
+			return nil, err
+		}
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		c.observe(resp)
+
+		if !retryable(resp.StatusCode) || attempt >= c.options.MaxRetries {
+			return resp, nil
+		}
+
+		retryAfter, ok := ParseRetryAfter(resp.Header.Get(HeaderRetryAfter), time.Now())
+		if !ok {
+			retryAfter = c.options.DefaultRetryAfter
+		}
+		if c.options.MaxRetryAfter > 0 && retryAfter > c.options.MaxRetryAfter {
+			c.logger.Log("rate limited, retry after %s exceeds the maximum of %s", retryAfter, c.options.MaxRetryAfter)
+			return resp, nil
+		}
+
+		next, err := rewind(req)
+		if err != nil {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		c.logger.Log("rate limited (%s), retrying in %s (%d/%d)", resp.Status, retryAfter, attempt+1, c.options.MaxRetries)
+		// no other request should go through while waiting
+		c.bucket.pauseUntil(time.Now().Add(retryAfter))
+		req = next
+	}
+}
+
+// observe reads the quota headers and slows down the
+// requests if the remaining quota is below the threshold.
+func (c *Client) observe(resp *http.Response) {
+	if c.options.SlowdownThreshold <= 0 {
+		return
+	}
+
+	limit, err := strconv.Atoi(resp.Header.Get(HeaderRateLimitLimit))
+	if err != nil || limit <= 0 {
+		return
+	}
+	remaining, err := strconv.Atoi(resp.Header.Get(HeaderRateLimitRemaining))
+	if err != nil || remaining < 0 {
+		return
+	}
+
+	if float64(remaining)/float64(limit) >= c.options.SlowdownThreshold {
+		c.bucket.setInterval(0)
+		return
+	}
+
+	// spread the remaining requests until the quota resets,
+	// if the reset is unknown assume the quota is for Period
+	var window time.Duration
+	if reset, err := strconv.ParseInt(resp.Header.Get(HeaderRateLimitReset), 10, 64); err == nil {
+		window = time.Until(time.Unix(reset, 0))
+	} else if c.options.Period > 0 {
+		window = c.options.Period
+	}
+	if window <= 0 {
+		return
+	}
+
+	if remaining == 0 {
+		c.logger.Log("rate limit quota exhausted, waiting %s", window)
+		c.bucket.pauseUntil(time.Now().Add(window))
+		return
+	}
+
+	interval := window / time.Duration(remaining+1)
+	c.logger.Log("rate limit quota low (%d/%d), spacing requests by %s", remaining, limit, interval)
+	c.bucket.setInterval(interval)
+}
+
+// ParseRetryAfter parses the Retry-After header value, which
+// can be either an amount of seconds or an HTTP date.
+//
+// Returns false if the value is empty or invalid.
+func ParseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+
+	wait := date.Sub(now)
+	if wait < 0 {
+		wait = 0
+	}
+	return wait, true
+}
+
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// rewind returns a copy of the request with a fresh body.
+func rewind(req *http.Request) (*http.Request, error) {
+	next := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return next, nil
+	}
+	if req.GetBody == nil {
+		return nil, errors.New("request body can't be re-read for a retry")
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	next.Body = body
+	return next, nil
+}
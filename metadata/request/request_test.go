@@ -0,0 +1,283 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newServer returns a test server that responds with the handler and
+// counts the requests received.
+func newServer(t *testing.T, handler func(w http.ResponseWriter, r *http.Request, n int)) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var count atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r, int(count.Add(1)))
+	}))
+	t.Cleanup(server.Close)
+	return server, &count
+}
+
+func get(t *testing.T, client *Client, url string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestClientTokenBucket(t *testing.T) {
+	server, count := newServer(t, func(w http.ResponseWriter, r *http.Request, n int) {})
+
+	// a token every 100ms, only one at once
+	client := NewClient(nil, Options{Rate: 10, Period: time.Second, Burst: 1})
+
+	start := time.Now()
+	for range 3 {
+		get(t, client, server.URL)
+	}
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("3 requests took %s, want at least 200ms", elapsed)
+	}
+	if n := count.Load(); n != 3 {
+		t.Errorf("server got %d requests, want 3", n)
+	}
+}
+
+func TestClientTokenBucketContext(t *testing.T) {
+	server, count := newServer(t, func(w http.ResponseWriter, r *http.Request, n int) {})
+
+	client := NewClient(nil, Options{Rate: 1, Period: time.Hour, Burst: 1})
+	get(t, client, server.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	if n := count.Load(); n != 1 {
+		t.Errorf("server got %d requests, want 1", n)
+	}
+}
+
+func TestClientRetryAfterSeconds(t *testing.T) {
+	server, count := newServer(t, func(w http.ResponseWriter, r *http.Request, n int) {
+		if n == 1 {
+			w.Header().Set(HeaderRetryAfter, "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	})
+
+	client := NewClient(nil, Options{MaxRetries: 1})
+
+	start := time.Now()
+	resp := get(t, client, server.URL)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retry was done after %s, want at least 1s", elapsed)
+	}
+	if n := count.Load(); n != 2 {
+		t.Errorf("server got %d requests, want 2", n)
+	}
+}
+
+func TestClientRetryAfterDate(t *testing.T) {
+	server, count := newServer(t, func(w http.ResponseWriter, r *http.Request, n int) {
+		if n == 1 {
+			// HTTP dates have second precision
+			retry := time.Now().Add(2 * time.Second).UTC().Format(http.TimeFormat)
+			w.Header().Set(HeaderRetryAfter, retry)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+
+	client := NewClient(nil, Options{MaxRetries: 1})
+
+	start := time.Now()
+	resp := get(t, client, server.URL)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retry was done after %s, want at least 1s", elapsed)
+	}
+	if n := count.Load(); n != 2 {
+		t.Errorf("server got %d requests, want 2", n)
+	}
+}
+
+func TestClientRetryBody(t *testing.T) {
+	server, count := newServer(t, func(w http.ResponseWriter, r *http.Request, n int) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != "query" {
+			t.Errorf("request %d got body %q, want %q", n, body, "query")
+		}
+		if n == 1 {
+			w.Header().Set(HeaderRetryAfter, "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	})
+
+	client := NewClient(nil, Options{MaxRetries: 1})
+
+	req, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("query"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if n := count.Load(); n != 2 {
+		t.Errorf("server got %d requests, want 2", n)
+	}
+}
+
+func TestClientMaxRetries(t *testing.T) {
+	server, count := newServer(t, func(w http.ResponseWriter, r *http.Request, n int) {
+		w.Header().Set(HeaderRetryAfter, "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	client := NewClient(nil, Options{MaxRetries: 2})
+
+	resp := get(t, client, server.URL)
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusTooManyRequests)
+	}
+	if n := count.Load(); n != 3 {
+		t.Errorf("server got %d requests, want 3", n)
+	}
+}
+
+func TestClientMaxRetryAfter(t *testing.T) {
+	server, count := newServer(t, func(w http.ResponseWriter, r *http.Request, n int) {
+		w.Header().Set(HeaderRetryAfter, "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	client := NewClient(nil, Options{MaxRetries: 2, MaxRetryAfter: time.Minute})
+
+	resp := get(t, client, server.URL)
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusTooManyRequests)
+	}
+	if n := count.Load(); n != 1 {
+		t.Errorf("server got %d requests, want 1", n)
+	}
+}
+
+func TestClientSlowdown(t *testing.T) {
+	server, _ := newServer(t, func(w http.ResponseWriter, r *http.Request, n int) {
+		w.Header().Set(HeaderRateLimitLimit, "10")
+		w.Header().Set(HeaderRateLimitRemaining, "1")
+	})
+
+	// no reset header, the remaining request is spread over the period
+	client := NewClient(nil, Options{Period: 400 * time.Millisecond, SlowdownThreshold: 0.5})
+
+	get(t, client, server.URL)
+	start := time.Now()
+	get(t, client, server.URL)
+	get(t, client, server.URL)
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("requests with low quota took %s, want at least 200ms", elapsed)
+	}
+}
+
+func TestClientSlowdownRecovers(t *testing.T) {
+	server, _ := newServer(t, func(w http.ResponseWriter, r *http.Request, n int) {
+		w.Header().Set(HeaderRateLimitLimit, "10")
+		if n == 1 {
+			w.Header().Set(HeaderRateLimitRemaining, "1")
+		} else {
+			w.Header().Set(HeaderRateLimitRemaining, "10")
+		}
+	})
+
+	client := NewClient(nil, Options{Period: 400 * time.Millisecond, SlowdownThreshold: 0.5})
+
+	get(t, client, server.URL)
+	get(t, client, server.URL)
+	start := time.Now()
+	get(t, client, server.URL)
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("request with recovered quota took %s, want no wait", elapsed)
+	}
+}
+
+func TestClientDisabled(t *testing.T) {
+	server, count := newServer(t, func(w http.ResponseWriter, r *http.Request, n int) {
+		w.Header().Set(HeaderRateLimitLimit, "10")
+		w.Header().Set(HeaderRateLimitRemaining, "0")
+		w.Header().Set(HeaderRetryAfter, "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	client := NewClient(nil, Options{
+		Disabled:          true,
+		Rate:              1,
+		Period:            time.Hour,
+		MaxRetries:        5,
+		SlowdownThreshold: 0.5,
+	})
+
+	start := time.Now()
+	for range 3 {
+		resp := get(t, client, server.URL)
+		if resp.StatusCode != http.StatusTooManyRequests {
+			t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusTooManyRequests)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("requests took %s, want no wait", elapsed)
+	}
+	if n := count.Load(); n != 3 {
+		t.Errorf("server got %d requests, want 3", n)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"0", 0, true},
+		{"120", 2 * time.Minute, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{"Fri, 01 Mar 2024 12:00:30 GMT", 30 * time.Second, true},
+		{"Fri, 01 Mar 2024 11:59:00 GMT", 0, true},
+	}
+	for _, test := range tests {
+		got, ok := ParseRetryAfter(test.value, now)
+		if got != test.want || ok != test.ok {
+			t.Errorf("ParseRetryAfter(%q) = %s, %t; want %s, %t", test.value, got, ok, test.want, test.ok)
+		}
+	}
+}
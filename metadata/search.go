@@ -0,0 +1,209 @@
+package metadata
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// SearchFormat is the publication format to filter searches with.
+type SearchFormat string
+
+const (
+	SearchFormatManga   SearchFormat = "manga"
+	SearchFormatManhwa  SearchFormat = "manhwa"
+	SearchFormatManhua  SearchFormat = "manhua"
+	SearchFormatNovel   SearchFormat = "novel"
+	SearchFormatOneShot SearchFormat = "one_shot"
+)
+
+// SearchSort is the order of the search results.
+type SearchSort string
+
+const (
+	SearchSortRelevance  SearchSort = "relevance"
+	SearchSortPopularity SearchSort = "popularity"
+	SearchSortScore      SearchSort = "score"
+	SearchSortTitle      SearchSort = "title"
+	SearchSortStartDate  SearchSort = "start_date"
+)
+
+// SearchFilter identifies a SearchOptions filter.
+type SearchFilter string
+
+const (
+	SearchFilterFormat  SearchFilter = "format"
+	SearchFilterStatus  SearchFilter = "status"
+	SearchFilterYear    SearchFilter = "year"
+	SearchFilterCountry SearchFilter = "country"
+	SearchFilterGenres  SearchFilter = "genres"
+	SearchFilterAdult   SearchFilter = "adult"
+	SearchFilterSort    SearchFilter = "sort"
+)
+
+// SearchOptions configures the metadata search.
+//
+// Zero values mean no filter. Not all providers support all of
+// the filters, see UnsupportedSearchFilters.
+type SearchOptions struct {
+	// Page is the page of results to get, starting from 1.
+	Page int
+
+	// Limit is the amount of results per page.
+	//
+	// Providers cap it to the maximum they support.
+	Limit int
+
+	// Formats to include in the results.
+	Formats []SearchFormat
+
+	// Status of the publication to include in the results.
+	Status []Status
+
+	// YearFrom is the minimum start year of the publication.
+	YearFrom int
+
+	// YearTo is the maximum start year of the publication.
+	YearTo int
+
+	// Country of origin of the publication. ISO 3166-1 alpha-2 country code.
+	Country string
+
+	// Genres the publication must have.
+	Genres []string
+
+	// Adult whether to include adult (NSFW) results, false excludes them.
+	//
+	// If nil, the provider default is used (e.g. the NSFW option of MyAnimeList).
+	Adult *bool
+
+	// Sort order of the results.
+	Sort SearchSort
+}
+
+// DefaultSearchOptions constructs default SearchOptions.
+func DefaultSearchOptions() SearchOptions {
+	return SearchOptions{
+		Page:  1,
+		Limit: 30,
+		Sort:  SearchSortRelevance,
+	}
+}
+
+// Filters returns the filters that are set.
+func (o SearchOptions) Filters() []SearchFilter {
+	var filters []SearchFilter
+	if len(o.Formats) != 0 {
+		filters = append(filters, SearchFilterFormat)
+	}
+	if len(o.Status) != 0 {
+		filters = append(filters, SearchFilterStatus)
+	}
+	if o.YearFrom != 0 || o.YearTo != 0 {
+		filters = append(filters, SearchFilterYear)
+	}
+	if o.Country != "" {
+		filters = append(filters, SearchFilterCountry)
+	}
+	if len(o.Genres) != 0 {
+		filters = append(filters, SearchFilterGenres)
+	}
+	if o.Adult != nil {
+		filters = append(filters, SearchFilterAdult)
+	}
+	if o.Sort != "" && o.Sort != SearchSortRelevance {
+		filters = append(filters, SearchFilterSort)
+	}
+	return filters
+}
+
+// PageOrDefault returns the page, 1 if unset.
+func (o SearchOptions) PageOrDefault() int {
+	if o.Page < 1 {
+		return 1
+	}
+	return o.Page
+}
+
+// LimitOrDefault returns the limit capped to max, 30 (or max) if unset.
+func (o SearchOptions) LimitOrDefault(max int) int {
+	limit := o.Limit
+	if limit < 1 {
+		limit = 30
+	}
+	if limit > max {
+		limit = max
+	}
+	return limit
+}
+
+// key is a deterministic representation of the options, used for caching.
+func (o SearchOptions) key() string {
+	formats := make([]string, len(o.Formats))
+	for i, f := range o.Formats {
+		formats[i] = string(f)
+	}
+	status := make([]string, len(o.Status))
+	for i, s := range o.Status {
+		status[i] = string(s)
+	}
+	genres := slices.Clone(o.Genres)
+	var adult string
+	if o.Adult != nil {
+		adult = strconv.FormatBool(*o.Adult)
+	}
+	slices.Sort(formats)
+	slices.Sort(status)
+	slices.Sort(genres)
+
+	return strings.Join([]string{
+		strconv.Itoa(o.PageOrDefault()),
+		strconv.Itoa(o.Limit),
+		strings.Join(formats, ","),
+		strings.Join(status, ","),
+		strconv.Itoa(o.YearFrom),
+		strconv.Itoa(o.YearTo),
+		o.Country,
+		strings.Join(genres, ","),
+		adult,
+		string(o.Sort),
+	}, "|")
+}
+
+// ProviderWithSearchValidation is a Provider that only supports
+// some combinations of the values of its search filters.
+type ProviderWithSearchValidation interface {
+	Provider
+
+	// UnsupportedSearchValues returns the supported filters set in
+	// the options which values can't be applied exactly as given.
+	UnsupportedSearchValues(options SearchOptions) []SearchFilter
+}
+
+// UnsupportedSearchFilters returns the filters set in the options
+// that are not supported by the provider, which will be ignored.
+//
+// For a ProviderWithSearchValidation, the filters which values can't
+// be applied exactly are also returned.
+func UnsupportedSearchFilters(provider Provider, options SearchOptions) []SearchFilter {
+	if cached, ok := provider.(*ProviderWithCache); ok {
+		provider = cached.provider
+	}
+	supported := provider.SearchFilters()
+
+	var unsupported []SearchFilter
+	for _, filter := range options.Filters() {
+		if !slices.Contains(supported, filter) {
+			unsupported = append(unsupported, filter)
+		}
+	}
+
+	if validation, ok := provider.(ProviderWithSearchValidation); ok {
+		for _, filter := range validation.UnsupportedSearchValues(options) {
+			if !slices.Contains(unsupported, filter) {
+				unsupported = append(unsupported, filter)
+			}
+		}
+	}
+	return unsupported
+}
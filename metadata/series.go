@@ -88,6 +88,16 @@ func (s SeriesJSON) Marshal() ([]byte, error) {
 	return buffer.Bytes(), err
 }
 
+// Unmarshal parses the series.json contents, as written by Marshal.
+func (s *SeriesJSON) Unmarshal(data []byte) error {
+	var wrapper seriesJSONWrapper
+	if err := json.Unmarshal(data, &wrapper); err != nil {
+		return err
+	}
+	*s = wrapper.Metadata
+	return nil
+}
+
 func (s SeriesJSON) wrapper() seriesJSONWrapper {
 	return seriesJSONWrapper{Metadata: s}
 }
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"io/fs"
 	"net/http"
+	"time"
 
+	"github.com/luevano/libmangal/imaging"
 	"github.com/luevano/libmangal/mangadata"
 	"github.com/luevano/libmangal/metadata"
 	"github.com/spf13/afero"
@@ -67,6 +69,15 @@ type DownloadOptions struct {
 	// However, metadata will still be created if needed.
 	SkipIfExists bool
 
+	// WriteManifest records the written chapters in the manifest of the manga
+	// directory (see Manifest), with their source, size and SHA-256.
+	//
+	// With SkipIfExists, chapters recorded in the manifest are skipped if their
+	// recorded file still exists with the same size (even if renamed), instead
+	// of checking the file name. The returned metadata.DownloadedChapter then
+	// has the recorded path, which is not renamed (see Client.Reorganize).
+	WriteManifest bool
+
 	// SearchMetadata will search for metadata on the available metadata providers,
 	// and use the found metadata regardless of the incoming manga metadata which
 	// could result in `nil` metadata when not found.
@@ -91,17 +102,65 @@ type DownloadOptions struct {
 	// silly, no (if only Komga would fix that)?
 	SkipSeriesJSONIfOngoing bool
 
-	// WriteComicInfoXML write metadata ComicInfo.xml file to the .cbz archive when
-	// downloading with FormatCBZ.
+	// WriteComicInfoXML write metadata ComicInfo.xml file to the archive when
+	// downloading with a comic book format (FormatCBZ, FormatCBT or FormatCB7).
 	WriteComicInfoXML bool
 
 	// ComicInfoXMLOptions options to use for ComicInfo.xml when WriteComicInfoXml is true.
 	ComicInfoXMLOptions metadata.ComicInfoXMLOptions
 
-	// ImageTransformer is applied for each image for the chapter.
+	// PDFOptions options to use when downloading with FormatPDF.
+	PDFOptions PDFOptions
+
+	// ImagePipeline is applied to the images of the chapter before saving them.
 	//
-	// E.g. grayscale effect.
-	ImageTransformer func([]byte) ([]byte, error)
+	// E.g. grayscale effect, resizing or converting to another format.
+	// If nil, the images are saved as downloaded.
+	ImagePipeline *imaging.Pipeline
+
+	// DeviceProfile is the name of the imaging.DeviceProfile to use.
+	//
+	// Its stages (resize, grayscale, encoding, etc.) are applied after
+	// the ImagePipeline. Custom profiles can be added with
+	// imaging.RegisterDeviceProfile. Empty means no profile.
+	DeviceProfile string
+
+	// ChapterSelect is the preference between chapters with the same
+	// number, used by Client.DownloadChapters to download only one of them.
+	ChapterSelect ChapterSelectOptions
+
+	// Webtoon mode joins the chapter images (long-strip slices) and cuts
+	// them into pages of the configured height, preferring gutters.
+	//
+	// It's applied before the ImagePipeline and DeviceProfile.
+	// If nil, the images are not joined.
+	Webtoon *imaging.WebtoonOptions
+}
+
+// imagePipeline builds the pipeline from the Webtoon, ImagePipeline and DeviceProfile.
+//
+// Returns nil if there is nothing to apply.
+func (o DownloadOptions) imagePipeline() (*imaging.Pipeline, error) {
+	if o.DeviceProfile == "" && o.Webtoon == nil {
+		return o.ImagePipeline, nil
+	}
+
+	pipeline := imaging.NewPipeline()
+	if o.Webtoon != nil {
+		pipeline.Append(imaging.Webtoon(*o.Webtoon))
+	}
+	if o.ImagePipeline != nil {
+		pipeline.Workers = o.ImagePipeline.Workers
+		pipeline.Append(o.ImagePipeline.Stages()...)
+	}
+	if o.DeviceProfile != "" {
+		profile, ok := imaging.GetDeviceProfile(o.DeviceProfile)
+		if !ok {
+			return nil, fmt.Errorf("unknown device profile %q", o.DeviceProfile)
+		}
+		pipeline.Append(profile.Stages()...)
+	}
+	return pipeline, nil
 }
 
 // DefaultDownloadOptions constructs default DownloadOptions.
@@ -114,16 +173,19 @@ func DefaultDownloadOptions() DownloadOptions {
 		CreateVolumeDir:         false,
 		Strict:                  true,
 		SkipIfExists:            true,
+		WriteManifest:           false,
 		SearchMetadata:          true,
 		DownloadMangaCover:      false,
 		DownloadMangaBanner:     false,
 		WriteSeriesJSON:         false,
 		SkipSeriesJSONIfOngoing: true, // Sensible default to avoid external parser issues.
 		WriteComicInfoXML:       false,
-		ImageTransformer: func(img []byte) ([]byte, error) {
-			return img, nil
-		},
-		ComicInfoXMLOptions: metadata.DefaultComicInfoOptions(),
+		ImagePipeline:           nil,
+		DeviceProfile:           "",
+		Webtoon:                 nil,
+		ChapterSelect:           DefaultChapterSelectOptions(),
+		ComicInfoXMLOptions:     metadata.DefaultComicInfoOptions(),
+		PDFOptions:              DefaultPDFOptions(),
 	}
 }
 
@@ -146,6 +208,28 @@ type ClientOptions struct {
 	// ModeFile is the permission bits used for all files created.
 	ModeFile fs.FileMode
 
+	// PageRetries is the amount of times a page is downloaded again when
+	// it fails to download or its contents are not a valid image (e.g. an
+	// HTML error page).
+	//
+	// Zero means the page fails on the first error.
+	PageRetries int
+
+	// PageRetryDelay is the time to wait before the first page retry,
+	// doubled on each following one.
+	PageRetryDelay time.Duration
+
+	// SkipPageValidation disables the check of the page contents,
+	// they're saved as downloaded with the extension of the Page.
+	SkipPageValidation bool
+
+	// MetadataProviders are registered when the client is built.
+	//
+	// Their saved sessions (if they have a metadata.CredentialStore)
+	// are restored automatically. They're owned by the caller, the
+	// client never closes them, not even if it fails to be built.
+	MetadataProviders []*metadata.ProviderWithCache
+
 	// ProviderName determines the provider directory name.
 	ProviderName func(
 		provider ProviderInfo,
@@ -175,11 +259,14 @@ type ClientOptions struct {
 // DefaultClientOptions constructs default ClientOptions, with default Anilist options as well.
 func DefaultClientOptions() ClientOptions {
 	return ClientOptions{
-		HTTPClient: &http.Client{},
-		UserAgent:  defaultUserAgent,
-		ModeDir:    defaultModeDir,
-		ModeFile:   defaultModeFile,
-		FS:         afero.NewOsFs(),
+		HTTPClient:         &http.Client{},
+		UserAgent:          defaultUserAgent,
+		ModeDir:            defaultModeDir,
+		ModeFile:           defaultModeFile,
+		FS:                 afero.NewOsFs(),
+		PageRetries:        2,
+		PageRetryDelay:     time.Second,
+		SkipPageValidation: false,
 		ProviderName: func(provider ProviderInfo) string {
 			return sanitizePath(provider.Name)
 		},
@@ -0,0 +1,79 @@
+package libmangal
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/luevano/libmangal/imaging"
+	"github.com/luevano/libmangal/mangadata"
+)
+
+// PageError is returned when the contents of a downloaded
+// page are not a valid image.
+type PageError struct {
+	// Page that failed.
+	Page mangadata.Page
+
+	// Err is the reason of the failure.
+	Err error
+}
+
+func (e *PageError) Error() string {
+	return fmt.Sprintf("page %q: %s", e.Page, e.Err)
+}
+
+func (e *PageError) Unwrap() error {
+	return e.Err
+}
+
+// checkPage validates the image contents of the page, fixing the
+// extension if it doesn't match the detected image format.
+func (c *Client) checkPage(page mangadata.Page, image []byte) (mangadata.PageWithImage, error) {
+	format, err := imaging.Validate(image)
+	if err != nil {
+		return nil, &PageError{Page: page, Err: err}
+	}
+
+	extension := format.Extension()
+	if sameExtension(page.Extension(), extension) {
+		if withImage, ok := page.(mangadata.PageWithImage); ok {
+			return withImage, nil
+		}
+		return &pageWithImage{Page: page, image: image}, nil
+	}
+
+	c.logger.Log("page %q: extension %q doesn't match contents, using %q", page, page.Extension(), extension)
+	return &pageWithImage{
+		Page:      page,
+		image:     image,
+		extension: extension,
+	}, nil
+}
+
+// checkDecodable checks that the pages can be decoded by an image pipeline,
+// some image formats are only sniffed (e.g. AVIF, JPEG XL).
+func checkDecodable(pages []mangadata.PageWithImage) error {
+	for _, page := range pages {
+		if imaging.CanDecode(page.Image()) {
+			continue
+		}
+		format, err := imaging.Sniff(page.Image())
+		if err != nil {
+			return &PageError{Page: page, Err: err}
+		}
+		return &PageError{Page: page, Err: fmt.Errorf("%s images can't be decoded by the image pipeline", format)}
+	}
+	return nil
+}
+
+// sameExtension compares the extensions, taking into account aliases (.jpeg and .jpg).
+func sameExtension(a, b string) bool {
+	normalize := func(ext string) string {
+		ext = strings.ToLower(ext)
+		if ext == ".jpeg" || ext == ".jpe" {
+			return ".jpg"
+		}
+		return ext
+	}
+	return normalize(a) == normalize(b)
+}
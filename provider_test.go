@@ -0,0 +1,187 @@
+package libmangal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/luevano/libmangal/logger"
+	"github.com/luevano/libmangal/mangadata"
+	"github.com/luevano/libmangal/metadata"
+	"github.com/spf13/afero"
+)
+
+// fakeProvider is an in memory Provider for testing.
+type fakeProvider struct {
+	mangas []*fakeManga
+	image  []byte
+	// onSearch is called on each search, if not nil
+	onSearch func()
+
+	mu sync.Mutex
+	// failing page images, by chapter number
+	failing map[float32]bool
+	// requested page images, by chapter number
+	requested map[float32]int
+}
+
+var _ ProviderLoader = (*fakeProvider)(nil)
+
+func (p *fakeProvider) String() string {
+	return "Fake"
+}
+
+func (p *fakeProvider) Info() ProviderInfo {
+	return ProviderInfo{ID: "fake", Name: "Fake", Version: "0.1.0"}
+}
+
+func (p *fakeProvider) Load(context.Context) (Provider, error) {
+	return p, nil
+}
+
+func (p *fakeProvider) Close() error {
+	return nil
+}
+
+func (p *fakeProvider) SetLogger(*logger.Logger) {}
+
+func (p *fakeProvider) SearchMangas(_ context.Context, query string) ([]mangadata.Manga, error) {
+	if p.onSearch != nil {
+		p.onSearch()
+	}
+	var mangas []mangadata.Manga
+	for _, manga := range p.mangas {
+		if manga.info.Title == query {
+			mangas = append(mangas, manga)
+		}
+	}
+	return mangas, nil
+}
+
+func (p *fakeProvider) MangaVolumes(_ context.Context, manga mangadata.Manga) ([]mangadata.Volume, error) {
+	return []mangadata.Volume{&fakeVolume{manga: manga.(*fakeManga)}}, nil
+}
+
+func (p *fakeProvider) VolumeChapters(_ context.Context, volume mangadata.Volume) ([]mangadata.Chapter, error) {
+	manga := volume.Manga().(*fakeManga)
+	chapters := make([]mangadata.Chapter, len(manga.chapters))
+	for i, chapter := range manga.chapters {
+		chapter.volume = volume.(*fakeVolume)
+		chapters[i] = chapter
+	}
+	return chapters, nil
+}
+
+func (p *fakeProvider) ChapterPages(_ context.Context, chapter mangadata.Chapter) ([]mangadata.Page, error) {
+	fake := chapter.(*fakeChapter)
+	pages := make([]mangadata.Page, max(fake.pages, 1))
+	for i := range pages {
+		pages[i] = &fakePage{chapter: fake, number: i + 1}
+	}
+	return pages, nil
+}
+
+func (p *fakeProvider) GetPageImage(_ context.Context, page mangadata.Page) ([]byte, error) {
+	number := page.Chapter().Info().Number
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.requested == nil {
+		p.requested = make(map[float32]int)
+	}
+	p.requested[number]++
+	if p.failing[number] {
+		return nil, errors.New("page not available")
+	}
+	return p.image, nil
+}
+
+// setFailing sets the chapter numbers whose page images fail.
+func (p *fakeProvider) setFailing(numbers ...float32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failing = make(map[float32]bool)
+	for _, number := range numbers {
+		p.failing[number] = true
+	}
+}
+
+type fakeManga struct {
+	info     mangadata.MangaInfo
+	metadata metadata.Metadata
+	chapters []*fakeChapter
+}
+
+func (m *fakeManga) String() string                         { return m.info.Title }
+func (m *fakeManga) Info() mangadata.MangaInfo              { return m.info }
+func (m *fakeManga) Metadata() metadata.Metadata            { return m.metadata }
+func (m *fakeManga) SetMetadata(metadata metadata.Metadata) { m.metadata = metadata }
+
+type fakeVolume struct {
+	manga *fakeManga
+}
+
+func (v *fakeVolume) String() string             { return "Vol. 1" }
+func (v *fakeVolume) Info() mangadata.VolumeInfo { return mangadata.VolumeInfo{Number: 1} }
+func (v *fakeVolume) Manga() mangadata.Manga     { return v.manga }
+
+type fakeChapter struct {
+	info   mangadata.ChapterInfo
+	volume *fakeVolume
+	pages  int
+}
+
+func (c *fakeChapter) String() string {
+	return fmt.Sprintf("%s %v (%s)", c.info.Title, c.info.Number, c.info.ScanlationGroup)
+}
+func (c *fakeChapter) Info() mangadata.ChapterInfo { return c.info }
+func (c *fakeChapter) Volume() mangadata.Volume    { return c.volume }
+
+type fakePage struct {
+	chapter *fakeChapter
+	number  int
+}
+
+func (p *fakePage) String() string             { return fmt.Sprintf("%s page %d", p.chapter, p.number) }
+func (p *fakePage) Extension() string          { return ".png" }
+func (p *fakePage) Chapter() mangadata.Chapter { return p.chapter }
+
+// newFakeManga creates a manga with a chapter for each info.
+func newFakeManga(id, title string, infos ...mangadata.ChapterInfo) *fakeManga {
+	manga := &fakeManga{info: mangadata.MangaInfo{ID: id, Title: title}}
+	volume := &fakeVolume{manga: manga}
+	for _, info := range infos {
+		manga.chapters = append(manga.chapters, &fakeChapter{info: info, volume: volume, pages: 1})
+	}
+	return manga
+}
+
+// newFakeClient creates a client of the fake provider on fs, pages are
+// not retried and downloads don't search metadata.
+func newFakeClient(t *testing.T, fs afero.Fs, provider *fakeProvider) *Client {
+	t.Helper()
+
+	if provider.image == nil {
+		provider.image = testPNG(t)
+	}
+	options := DefaultClientOptions()
+	options.FS = fs
+	options.PageRetries = 0
+	client, err := NewClient(context.Background(), provider, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// testDownloadOptions are the download options of the tests, into directory.
+func testDownloadOptions(directory string) DownloadOptions {
+	options := DefaultDownloadOptions()
+	options.Directory = directory
+	options.SearchMetadata = false
+	options.Strict = false
+	return options
+}
@@ -0,0 +1,364 @@
+package libmangal
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/luevano/libmangal/mangadata"
+	"github.com/luevano/libmangal/metadata"
+	"github.com/philippgille/gokv/syncmap"
+	"github.com/spf13/afero"
+)
+
+// ReorganizeOptions configures Client.Reorganize.
+type ReorganizeOptions struct {
+	// From is the current layout of the library.
+	From LibraryOptions
+
+	// To are the options the chapters would be downloaded with now, only
+	// the directory options (Directory, CreateProviderDir, CreateMangaDir
+	// and CreateVolumeDir) are used. The chapter formats are kept.
+	//
+	// Chapters with volume number 0 (e.g. not in a volume directory)
+	// are never moved into a volume directory.
+	To DownloadOptions
+
+	// DryRun only plans the moves, nothing is changed.
+	DryRun bool
+
+	// RenameCollisions moves the chapters whose new path is already taken
+	// to a numbered path (e.g. "[0001.0] Title (2).cbz"), instead of skipping them.
+	RenameCollisions bool
+}
+
+// DefaultReorganizeOptions constructs default ReorganizeOptions.
+func DefaultReorganizeOptions() ReorganizeOptions {
+	return ReorganizeOptions{
+		From:             DefaultLibraryOptions(),
+		To:               DefaultDownloadOptions(),
+		DryRun:           true,
+		RenameCollisions: false,
+	}
+}
+
+// ReorganizeMove is a file (or directory) move of the reorganization.
+type ReorganizeMove struct {
+	// From is the current path.
+	From string `json:"from"`
+
+	// To is the new path.
+	To string `json:"to"`
+
+	// Skipped is the reason the move is not done, empty if it's done.
+	Skipped string `json:"skipped,omitempty"`
+
+	// Error moving, empty if it was moved (or on a dry run).
+	Error string `json:"error,omitempty"`
+
+	// manifest directories of the chapter, to move its entry along
+	fromManifest, toManifest string
+}
+
+// ReorganizePlan is the result of Client.Reorganize.
+type ReorganizePlan struct {
+	// Moves of the chapters and the manga files (series.json, cover and banner).
+	Moves []ReorganizeMove `json:"moves"`
+
+	// Unchanged is the amount of chapters already in their path.
+	Unchanged int `json:"unchanged"`
+}
+
+// Reorganize moves the chapters of the library to the paths they would have
+// if downloaded now, after the naming functions (ClientOptions.MangaName,
+// ClientOptions.ChapterName, etc.) or the directory options changed, so that
+// DownloadOptions.SkipIfExists finds them again.
+//
+// The chapters are found as in Library.Scan. The provider title is not
+// stored, so the manga title used for the names is its directory name if
+// ClientOptions.MangaName still maps to it, else the one of the scan (the
+// series.json name or ComicInfo.xml series, which may be the metadata title),
+// and chapters not in a volume directory have volume number 0. Chapters are
+// moved with FS renames (atomic on the same file system), their
+// series.json, cover, banner and manifest entries (see Manifest) are moved
+// along to the new manga directory and the directories left empty are removed.
+//
+// Chapters whose new path is taken (by an existing file or another chapter)
+// are skipped, unless ReorganizeOptions.RenameCollisions is set.
+// Manga files are never overwritten.
+func (c *Client) Reorganize(ctx context.Context, options ReorganizeOptions) (ReorganizePlan, error) {
+	var plan ReorganizePlan
+
+	library, err := NewLibrary(c, syncmap.NewStore(syncmap.DefaultOptions), options.From)
+	if err != nil {
+		return plan, err
+	}
+	defer library.Close()
+
+	if _, err := library.Scan(ctx); err != nil {
+		return plan, err
+	}
+	mangas, err := library.Mangas()
+	if err != nil {
+		return plan, err
+	}
+
+	fs := c.options.FS
+	claimed := make(map[string]bool)
+	// exists checks the file system and the previously planned moves
+	exists := func(path string) (bool, error) {
+		if claimed[path] {
+			return true, nil
+		}
+		return afero.Exists(fs, path)
+	}
+
+	for _, indexed := range mangas {
+		provider := c.Info()
+		if options.From.CreateProviderDir {
+			provider = ProviderInfo{ID: indexed.Provider, Name: indexed.Provider}
+		}
+
+		manga, err := c.reorganizeManga(provider, indexed, options.From)
+		if err != nil {
+			return plan, err
+		}
+
+		fromManifest := options.From.Directory
+		if options.From.CreateMangaDir {
+			fromManifest = filepath.Join(options.From.Directory, indexed.Dir)
+		}
+
+		var mangaDir string
+		for _, chapter := range indexed.Chapters {
+			localChapter := &localChapter{
+				info: mangadata.ChapterInfo{
+					Title:           chapter.Title,
+					URL:             chapter.URL,
+					Number:          chapter.Number,
+					Date:            chapter.Date,
+					ScanlationGroup: chapter.ScanlationGroup,
+				},
+				volume: &localVolume{
+					info:  mangadata.VolumeInfo{Number: chapter.Volume},
+					manga: manga,
+				},
+				format: chapter.Format,
+			}
+
+			to := options.To
+			if chapter.Volume == 0 {
+				to.CreateVolumeDir = false
+			}
+			var dir string
+			dir, mangaDir = c.chapterDirs(provider, localChapter, to)
+			from := filepath.Join(options.From.Directory, chapter.Path)
+			path := filepath.Join(dir, c.options.ChapterName(provider, localChapter)+chapter.Format.Extension())
+			if from == path {
+				plan.Unchanged++
+				claimed[path] = true
+				continue
+			}
+
+			move := ReorganizeMove{From: from, To: path, fromManifest: fromManifest, toManifest: mangaDir}
+			taken, err := exists(path)
+			if err != nil {
+				return plan, err
+			}
+			if taken && options.RenameCollisions {
+				move.To, err = numberedPath(path, chapter.Format.Extension(), exists)
+				if err != nil {
+					return plan, err
+				}
+				taken = false
+			}
+			if taken {
+				move.Skipped = "path already taken"
+			} else {
+				claimed[move.To] = true
+			}
+			plan.Moves = append(plan.Moves, move)
+		}
+
+		// the manga files only belong to the manga with manga directories
+		if !options.From.CreateMangaDir || mangaDir == "" {
+			continue
+		}
+		oldDir := filepath.Join(options.From.Directory, indexed.Dir)
+		if oldDir == mangaDir {
+			continue
+		}
+		for _, name := range []string{
+			metadata.FilenameSeriesJSON,
+			metadata.FilenameCoverJPG,
+			metadata.FilenameBannerJPG,
+		} {
+			from := filepath.Join(oldDir, name)
+			if ok, err := afero.Exists(fs, from); err != nil || !ok {
+				if err != nil {
+					return plan, err
+				}
+				continue
+			}
+
+			move := ReorganizeMove{From: from, To: filepath.Join(mangaDir, name)}
+			taken, err := exists(move.To)
+			if err != nil {
+				return plan, err
+			}
+			if taken {
+				move.Skipped = "path already taken"
+			} else {
+				claimed[move.To] = true
+			}
+			plan.Moves = append(plan.Moves, move)
+		}
+	}
+
+	if options.DryRun {
+		return plan, nil
+	}
+
+	emptied := make(map[string]bool)
+	for i := range plan.Moves {
+		move := &plan.Moves[i]
+		if move.Skipped != "" {
+			continue
+		}
+
+		c.logger.Log("moving %q to %q", move.From, move.To)
+		err := fs.MkdirAll(filepath.Dir(move.To), c.options.ModeDir)
+		if err == nil {
+			err = fs.Rename(move.From, move.To)
+		}
+		if err != nil {
+			move.Error = err.Error()
+			c.logger.Log("error moving %q: %s", move.From, move.Error)
+			continue
+		}
+		emptied[filepath.Dir(move.From)] = true
+
+		if move.fromManifest != "" {
+			if err := c.moveManifestEntry(move.fromManifest, move.From, move.toManifest, move.To); err != nil {
+				return plan, err
+			}
+		}
+	}
+
+	for dir := range emptied {
+		if err := removeEmptyDirs(fs, dir, options.From.Directory); err != nil {
+			return plan, err
+		}
+	}
+	return plan, nil
+}
+
+// moveManifestEntry moves the manifest entry of the chapter (if
+// any) from the manifest of fromDir to the one of toDir.
+func (c *Client) moveManifestEntry(fromDir, from, toDir, to string) error {
+	fromRel, err := filepath.Rel(fromDir, from)
+	if err != nil {
+		return nil
+	}
+	manifest, err := ReadManifest(c.options.FS, fromDir)
+	if err != nil {
+		return err
+	}
+	entry, ok := manifest.Path(fromRel)
+	if !ok {
+		return nil
+	}
+
+	toRel, err := filepath.Rel(toDir, to)
+	if err != nil {
+		return err
+	}
+	if err := updateManifest(c.options.FS, fromDir, c.options.ModeFile, func(manifest *Manifest) {
+		manifest.Remove(fromRel)
+	}); err != nil {
+		return err
+	}
+	entry.Path = filepath.ToSlash(toRel)
+	return updateManifest(c.options.FS, toDir, c.options.ModeFile, func(manifest *Manifest) {
+		manifest.Set(entry)
+	})
+}
+
+// reorganizeManga builds the manga of the indexed one, used for the naming functions.
+//
+// The directory name is the output of the previous MangaName, so it's only used
+// as the title if MangaName still maps to it (e.g. the naming didn't change),
+// else the title of the scan is used (series.json, ComicInfo.xml or the
+// directory name, in that order).
+func (c *Client) reorganizeManga(provider ProviderInfo, indexed LibraryManga, from LibraryOptions) (*localManga, error) {
+	dir := filepath.Join(from.Directory, indexed.Dir)
+
+	var seriesJSON *metadata.SeriesJSON
+	if indexed.HasSeriesJSON {
+		var err error
+		if seriesJSON, err = readSeriesJSON(c.options.FS, dir); err != nil {
+			return nil, err
+		}
+	}
+
+	manga := func(title string) *localManga {
+		meta := localMetadata(filepath.Base(dir), seriesJSON, nil)
+		meta.EnglishTitle = title
+		return &localManga{
+			info:     mangadata.MangaInfo{Title: title, ID: indexed.Dir},
+			metadata: meta,
+			path:     dir,
+		}
+	}
+
+	if from.CreateMangaDir {
+		dirName := filepath.Base(dir)
+		if byDir := manga(dirName); c.options.MangaName(provider, byDir) == dirName {
+			return byDir, nil
+		}
+	}
+	if indexed.Title == "" {
+		return manga(filepath.Base(dir)), nil
+	}
+	return manga(indexed.Title), nil
+}
+
+// numberedPath returns the first path with a " (n)" suffix (before the extension)
+// that doesn't exist, starting with 2.
+func numberedPath(path, ext string, exists func(string) (bool, error)) (string, error) {
+	base := strings.TrimSuffix(path, ext)
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, n, ext)
+		taken, err := exists(candidate)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+	}
+}
+
+// removeEmptyDirs removes dir and its parents while they're
+// empty, up to root (not included).
+func removeEmptyDirs(fs afero.Fs, dir, root string) error {
+	root = filepath.Clean(root)
+	for dir = filepath.Clean(dir); dir != root && dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+		// already removed along with a subdirectory
+		if ok, err := afero.DirExists(fs, dir); err != nil || !ok {
+			return err
+		}
+		empty, err := afero.IsEmpty(fs, dir)
+		if err != nil {
+			return err
+		}
+		if !empty {
+			return nil
+		}
+		if err := fs.Remove(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package libmangal
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/luevano/libmangal/mangadata"
+	"github.com/luevano/libmangal/metadata"
+	"github.com/spf13/afero"
+)
+
+// writeTestLibrary writes a library with a manga with a series.json
+// titled differently (as written from the metadata) and one without.
+func writeTestLibrary(t *testing.T, fs afero.Fs) {
+	t.Helper()
+
+	seriesJSON, err := metadata.SeriesJSON{Name: "Demon Slayer"}.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(fs, "library/Kimetsu no Yaiba/series.json", seriesJSON, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	writeTestCBZ(t, fs, "library/Kimetsu no Yaiba/[0001.0] Cruelty.cbz", testFile{"001.png", testPNG(t)})
+	writeTestCBZ(t, fs, "library/Kimetsu no Yaiba/[0002.0] Trainer.cbz", testFile{"001.png", testPNG(t)})
+	writeTestCBZ(t, fs, "library/Berserk/[0010.5] Extra.cbz", testFile{"001.png", testPNG(t)})
+}
+
+func testReorganizeOptions() ReorganizeOptions {
+	options := DefaultReorganizeOptions()
+	options.From.Directory = "library"
+	options.To.Directory = "library"
+	options.DryRun = false
+	return options
+}
+
+func TestReorganizeUnchanged(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	writeTestLibrary(t, fs)
+	client := newTestClient(t, fs, "library")
+
+	plan, err := client.Reorganize(context.Background(), testReorganizeOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Moves) != 0 {
+		t.Errorf("got moves %+v, want none", plan.Moves)
+	}
+	if plan.Unchanged != 3 {
+		t.Errorf("got %d unchanged chapters, want 3", plan.Unchanged)
+	}
+}
+
+func TestReorganizeMangaName(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	writeTestLibrary(t, fs)
+	client := newTestClient(t, fs, "library")
+	client.options.MangaName = func(_ ProviderInfo, manga mangadata.Manga) string {
+		return strings.ToUpper(manga.Info().Title)
+	}
+
+	plan, err := client.Reorganize(context.Background(), testReorganizeOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, move := range plan.Moves {
+		if move.Skipped != "" || move.Error != "" {
+			t.Errorf("move %+v not done", move)
+		}
+	}
+
+	// the series.json name, not the directory name
+	for _, path := range []string{
+		"library/DEMON SLAYER/[0001.0] Cruelty.cbz",
+		"library/DEMON SLAYER/[0002.0] Trainer.cbz",
+		"library/DEMON SLAYER/series.json",
+		"library/BERSERK/[0010.5] Extra.cbz",
+	} {
+		if ok, _ := afero.Exists(fs, path); !ok {
+			t.Errorf("%q doesn't exist", path)
+		}
+	}
+	for _, dir := range []string{"library/Kimetsu no Yaiba", "library/Berserk"} {
+		if ok, _ := afero.Exists(fs, dir); ok {
+			t.Errorf("%q was not removed", dir)
+		}
+	}
+
+	// now the naming maps to the directories
+	plan, err = client.Reorganize(context.Background(), testReorganizeOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Moves) != 0 {
+		t.Errorf("got moves %+v on the second run, want none", plan.Moves)
+	}
+}
+
+func TestReorganizeVolumeDir(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	writeTestLibrary(t, fs)
+	writeTestCBZ(t, fs, "library/Berserk/Vol. 1/[0001.0] Black Swordsman.cbz", testFile{"001.png", testPNG(t)})
+	client := newTestClient(t, fs, "library")
+
+	options := testReorganizeOptions()
+	options.To.CreateVolumeDir = true
+	plan, err := client.Reorganize(context.Background(), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the chapters without volume are not moved into "Vol. 0.0"
+	if len(plan.Moves) != 1 {
+		t.Fatalf("got moves %+v, want 1", plan.Moves)
+	}
+	if want := "library/Berserk/Vol. 1.0/[0001.0] Black Swordsman.cbz"; plan.Moves[0].To != want {
+		t.Errorf("moved to %q, want %q", plan.Moves[0].To, want)
+	}
+}
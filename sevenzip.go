@@ -0,0 +1,846 @@
+package libmangal
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"slices"
+	"time"
+	"unicode/utf16"
+
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// 7z archive property IDs.
+const (
+	sevenZipEnd byte = iota
+	sevenZipHeader
+	sevenZipArchiveProperties
+	sevenZipAdditionalStreamsInfo
+	sevenZipMainStreamsInfo
+	sevenZipFilesInfo
+	sevenZipPackInfo
+	sevenZipUnpackInfo
+	sevenZipSubStreamsInfo
+	sevenZipSize
+	sevenZipCRC
+	sevenZipFolder
+	sevenZipCodersUnpackSize
+	sevenZipNumUnpackStream
+	sevenZipEmptyStream
+	sevenZipEmptyFile
+	sevenZipAnti
+	sevenZipName
+	sevenZipCTime
+	sevenZipATime
+	sevenZipMTime
+	sevenZipWinAttributes
+	sevenZipComment
+	sevenZipEncodedHeader
+	sevenZipStartPos
+	sevenZipDummy
+)
+
+const sevenZipSignatureHeaderSize = 32
+
+// sevenZipMaxDictCap is the largest LZMA dictionary allocated, whatever the
+// coder properties say, as the one of the 7-Zip ultra preset. Otherwise up
+// to 4 GiB would be allocated before noticing a corrupted archive.
+const sevenZipMaxDictCap = 64 << 20
+
+var sevenZipSignature = []byte{'7', 'z', 0xBC, 0xAF, 0x27, 0x1C}
+
+// IDs of the supported 7z coders.
+var (
+	// sevenZipCopy stores data as is.
+	sevenZipCopy    = []byte{0x00}
+	sevenZipLZMA    = []byte{0x03, 0x01, 0x01}
+	sevenZipLZMA2   = []byte{0x21}
+	sevenZipDeflate = []byte{0x04, 0x01, 0x08}
+	sevenZipBZip2   = []byte{0x04, 0x02, 0x02}
+)
+
+// sevenZipFileTimeEpoch is the Unix time in 100ns intervals since 1601-01-01.
+const sevenZipFileTimeEpoch = 116444736000000000
+
+var errSevenZipCorrupted = errors.New("corrupted 7z archive")
+
+// sevenZipWriter writes 7z archives where each file is stored
+// (without compression) in its own folder.
+//
+// The archive is written on Close, as the header is
+// referenced from the start of the archive.
+type sevenZipWriter struct {
+	out   io.Writer
+	files []sevenZipWriterFile
+}
+
+type sevenZipWriterFile struct {
+	name     string
+	data     []byte
+	modified time.Time
+}
+
+func newSevenZipWriter(out io.Writer) *sevenZipWriter {
+	return &sevenZipWriter{out: out}
+}
+
+// Add adds a file to the archive, data is not copied.
+func (w *sevenZipWriter) Add(name string, data []byte, modified time.Time) {
+	w.files = append(w.files, sevenZipWriterFile{
+		name:     name,
+		data:     data,
+		modified: modified,
+	})
+}
+
+// Close writes the archive.
+func (w *sevenZipWriter) Close() error {
+	var streams []sevenZipWriterFile
+	for _, file := range w.files {
+		if len(file.data) > 0 {
+			streams = append(streams, file)
+		}
+	}
+
+	header := []byte{sevenZipHeader}
+	var packSize uint64
+	if len(streams) > 0 {
+		header = append(header, sevenZipMainStreamsInfo, sevenZipPackInfo)
+		header = appendSevenZipNumber(header, 0)
+		header = appendSevenZipNumber(header, uint64(len(streams)))
+		header = append(header, sevenZipSize)
+		for _, stream := range streams {
+			header = appendSevenZipNumber(header, uint64(len(stream.data)))
+			packSize += uint64(len(stream.data))
+		}
+		header = append(header, sevenZipEnd)
+
+		header = append(header, sevenZipUnpackInfo, sevenZipFolder)
+		header = appendSevenZipNumber(header, uint64(len(streams)))
+		header = append(header, 0) // not external
+		for range streams {
+			// one simple coder, with a 1 byte ID
+			header = append(header, 1, byte(len(sevenZipCopy)))
+			header = append(header, sevenZipCopy...)
+		}
+		header = append(header, sevenZipCodersUnpackSize)
+		for _, stream := range streams {
+			header = appendSevenZipNumber(header, uint64(len(stream.data)))
+		}
+		header = append(header, sevenZipEnd)
+
+		// one file per folder, only the CRCs are needed
+		header = append(header, sevenZipSubStreamsInfo, sevenZipCRC, 1) // all defined
+		for _, stream := range streams {
+			header = binary.LittleEndian.AppendUint32(header, crc32.ChecksumIEEE(stream.data))
+		}
+		header = append(header, sevenZipEnd, sevenZipEnd)
+	}
+
+	if len(w.files) > 0 {
+		header = append(header, sevenZipFilesInfo)
+		header = appendSevenZipNumber(header, uint64(len(w.files)))
+
+		if len(streams) != len(w.files) {
+			empty := make([]bool, len(w.files))
+			for i, file := range w.files {
+				empty[i] = len(file.data) == 0
+			}
+			header = appendSevenZipProperty(header, sevenZipEmptyStream, appendSevenZipBits(nil, empty))
+
+			// all empty streams are files, not directories
+			emptyFiles := make([]bool, len(w.files)-len(streams))
+			for i := range emptyFiles {
+				emptyFiles[i] = true
+			}
+			header = appendSevenZipProperty(header, sevenZipEmptyFile, appendSevenZipBits(nil, emptyFiles))
+		}
+
+		names := []byte{0} // not external
+		for _, file := range w.files {
+			for _, r := range utf16.Encode([]rune(file.name)) {
+				names = binary.LittleEndian.AppendUint16(names, r)
+			}
+			names = append(names, 0, 0)
+		}
+		header = appendSevenZipProperty(header, sevenZipName, names)
+
+		times := []byte{1, 0} // all defined, not external
+		for _, file := range w.files {
+			fileTime := file.modified.UnixNano()/100 + sevenZipFileTimeEpoch
+			times = binary.LittleEndian.AppendUint64(times, uint64(fileTime))
+		}
+		header = appendSevenZipProperty(header, sevenZipMTime, times)
+
+		header = append(header, sevenZipEnd)
+	}
+	header = append(header, sevenZipEnd)
+
+	startHeader := make([]byte, 20)
+	binary.LittleEndian.PutUint64(startHeader[0:], packSize)
+	binary.LittleEndian.PutUint64(startHeader[8:], uint64(len(header)))
+	binary.LittleEndian.PutUint32(startHeader[16:], crc32.ChecksumIEEE(header))
+
+	signatureHeader := append([]byte{}, sevenZipSignature...)
+	signatureHeader = append(signatureHeader, 0, 4) // version
+	signatureHeader = binary.LittleEndian.AppendUint32(signatureHeader, crc32.ChecksumIEEE(startHeader))
+	signatureHeader = append(signatureHeader, startHeader...)
+
+	if _, err := w.out.Write(signatureHeader); err != nil {
+		return err
+	}
+	for _, stream := range streams {
+		if _, err := w.out.Write(stream.data); err != nil {
+			return err
+		}
+	}
+	_, err := w.out.Write(header)
+	return err
+}
+
+// appendSevenZipNumber appends the 7z variable length encoding of v,
+// where the leading 1 bits of the first byte are the extra bytes count.
+func appendSevenZipNumber(b []byte, v uint64) []byte {
+	for n := 0; n < 8; n++ {
+		if v < 1<<(7*n+7) {
+			first := byte(uint16(0xFF)<<(8-n)) | byte(v>>(8*n))
+			b = append(b, first)
+			for i := 0; i < n; i++ {
+				b = append(b, byte(v>>(8*i)))
+			}
+			return b
+		}
+	}
+	b = append(b, 0xFF)
+	return binary.LittleEndian.AppendUint64(b, v)
+}
+
+// appendSevenZipBits appends the bit vector, most significant bit first.
+func appendSevenZipBits(b []byte, bits []bool) []byte {
+	for i := 0; i < len(bits); i += 8 {
+		var v byte
+		for j := 0; j < 8 && i+j < len(bits); j++ {
+			if bits[i+j] {
+				v |= 0x80 >> j
+			}
+		}
+		b = append(b, v)
+	}
+	return b
+}
+
+func appendSevenZipProperty(b []byte, id byte, data []byte) []byte {
+	b = append(b, id)
+	b = appendSevenZipNumber(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// sevenZipReader reads 7z archives.
+//
+// Only folders with a single coder can be extracted, either
+// stored (copy), LZMA, LZMA2, Deflate or BZip2 compressed.
+type sevenZipReader struct {
+	r       io.ReaderAt
+	folders []sevenZipBlock
+	Files   []*sevenZipFile
+}
+
+type sevenZipCoder struct {
+	id         []byte
+	properties []byte
+}
+
+// sevenZipBlock is a folder (solid block) of the archive.
+type sevenZipBlock struct {
+	coders []sevenZipCoder
+	// offset of the packed stream from the start of the archive
+	packOffset uint64
+	packSize   uint64
+	unpackSize uint64
+	// sizes and CRCs of the files (substreams) in the folder
+	sizes []uint64
+	crcs  []*uint32
+}
+
+// sevenZipFile is a file inside of a 7z archive.
+type sevenZipFile struct {
+	Name string
+	Size uint64
+
+	reader *sevenZipReader
+	// folder of the file, -1 for empty files and directories
+	folder int
+	// offset of the file inside of the unpacked folder
+	offset uint64
+	crc    *uint32
+	dir    bool
+}
+
+// IsDir returns true if the file is a directory.
+func (f *sevenZipFile) IsDir() bool {
+	return f.dir
+}
+
+// Open opens the contents of the file for reading.
+//
+// Files of compressed solid folders are decompressed
+// from the start of the folder.
+func (f *sevenZipFile) Open() (io.Reader, error) {
+	if f.folder < 0 {
+		return bytes.NewReader(nil), nil
+	}
+
+	folder, err := f.reader.folderReader(f.folder)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, folder, int64(f.offset)); err != nil {
+		return nil, err
+	}
+	return io.LimitReader(folder, int64(f.Size)), nil
+}
+
+// ReadAll reads and checks the contents of the file.
+func (f *sevenZipFile) ReadAll() ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(data)) != f.Size {
+		return nil, fmt.Errorf("7z file %q: %w", f.Name, io.ErrUnexpectedEOF)
+	}
+	if f.crc != nil && crc32.ChecksumIEEE(data) != *f.crc {
+		return nil, fmt.Errorf("7z file %q: checksum mismatch", f.Name)
+	}
+	return data, nil
+}
+
+// folderReader reads the unpacked contents of the folder.
+func (r *sevenZipReader) folderReader(i int) (io.Reader, error) {
+	folder := r.folders[i]
+	if len(folder.coders) != 1 {
+		return nil, fmt.Errorf("unsupported 7z folder with %d coders", len(folder.coders))
+	}
+
+	packed := io.NewSectionReader(r.r, int64(folder.packOffset), int64(folder.packSize))
+	switch coder := folder.coders[0]; {
+	case bytes.Equal(coder.id, sevenZipCopy):
+		return packed, nil
+	case bytes.Equal(coder.id, sevenZipLZMA):
+		if len(coder.properties) != 5 {
+			return nil, errSevenZipCorrupted
+		}
+		// the classic LZMA header is the coder properties and the unpacked size,
+		// the dictionary is never larger than the unpacked contents
+		properties := slices.Clone(coder.properties)
+		dictCap := uint64(binary.LittleEndian.Uint32(properties[1:]))
+		dictCap = max(min(dictCap, folder.unpackSize, sevenZipMaxDictCap), lzma.MinDictCap)
+		binary.LittleEndian.PutUint32(properties[1:], uint32(dictCap))
+		header := binary.LittleEndian.AppendUint64(properties, folder.unpackSize)
+		return lzma.ReaderConfig{DictCap: int(dictCap)}.NewReader(io.MultiReader(bytes.NewReader(header), bufio.NewReader(packed)))
+	case bytes.Equal(coder.id, sevenZipLZMA2):
+		if len(coder.properties) != 1 || coder.properties[0] > 40 {
+			return nil, errSevenZipCorrupted
+		}
+		bits := coder.properties[0]
+		dictCap := uint64(2|bits&1) << (bits/2 + 11)
+		// the dictionary is never larger than the unpacked contents
+		dictCap = max(min(dictCap, folder.unpackSize, sevenZipMaxDictCap), lzma.MinDictCap)
+		return lzma.Reader2Config{DictCap: int(dictCap)}.NewReader2(bufio.NewReader(packed))
+	case bytes.Equal(coder.id, sevenZipDeflate):
+		return flate.NewReader(packed), nil
+	case bytes.Equal(coder.id, sevenZipBZip2):
+		return bzip2.NewReader(packed), nil
+	default:
+		return nil, fmt.Errorf("unsupported 7z coder %x", coder.id)
+	}
+}
+
+func newSevenZipReader(r io.ReaderAt, size int64) (*sevenZipReader, error) {
+	signatureHeader := make([]byte, sevenZipSignatureHeaderSize)
+	if _, err := r.ReadAt(signatureHeader, 0); err != nil {
+		return nil, fmt.Errorf("reading 7z signature header: %w", err)
+	}
+	if !bytes.HasPrefix(signatureHeader, sevenZipSignature) {
+		return nil, errors.New("not a 7z archive")
+	}
+	startHeader := signatureHeader[12:]
+	if crc32.ChecksumIEEE(startHeader) != binary.LittleEndian.Uint32(signatureHeader[8:]) {
+		return nil, errSevenZipCorrupted
+	}
+
+	nextHeaderOffset := binary.LittleEndian.Uint64(startHeader[0:])
+	nextHeaderSize := binary.LittleEndian.Uint64(startHeader[8:])
+	nextHeaderCRC := binary.LittleEndian.Uint32(startHeader[16:])
+	if nextHeaderOffset > uint64(size) || nextHeaderSize > uint64(size)-nextHeaderOffset {
+		return nil, errSevenZipCorrupted
+	}
+
+	reader := &sevenZipReader{r: r}
+	if nextHeaderSize == 0 {
+		// empty archive
+		return reader, nil
+	}
+
+	header := make([]byte, nextHeaderSize)
+	if _, err := r.ReadAt(header, int64(sevenZipSignatureHeaderSize+nextHeaderOffset)); err != nil {
+		return nil, fmt.Errorf("reading 7z header: %w", err)
+	}
+	if crc32.ChecksumIEEE(header) != nextHeaderCRC {
+		return nil, errSevenZipCorrupted
+	}
+
+	if err := reader.parseHeader(&sevenZipBuffer{data: header}); err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+func (r *sevenZipReader) parseHeader(buf *sevenZipBuffer) error {
+	switch id := buf.byte(); id {
+	case sevenZipHeader:
+	case sevenZipEncodedHeader:
+		header, err := r.decodeHeader(buf)
+		if err != nil {
+			return err
+		}
+		return r.parseHeader(&sevenZipBuffer{data: header})
+	default:
+		return errSevenZipCorrupted
+	}
+
+	for buf.err == nil {
+		switch id := buf.byte(); id {
+		case sevenZipEnd:
+			return buf.err
+		case sevenZipArchiveProperties:
+			for buf.err == nil && buf.byte() != sevenZipEnd {
+				buf.next(buf.number())
+			}
+		case sevenZipMainStreamsInfo:
+			r.parseStreamsInfo(buf)
+		case sevenZipFilesInfo:
+			if err := r.parseFilesInfo(buf); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported 7z header property %d", id)
+		}
+	}
+	return buf.err
+}
+
+// decodeHeader unpacks the compressed header, described by a streams info.
+func (r *sevenZipReader) decodeHeader(buf *sevenZipBuffer) ([]byte, error) {
+	encoded := &sevenZipReader{r: r.r}
+	encoded.parseStreamsInfo(buf)
+	if buf.err != nil {
+		return nil, buf.err
+	}
+	if len(encoded.folders) == 0 || len(encoded.folders[0].crcs) == 0 {
+		return nil, errSevenZipCorrupted
+	}
+
+	folder, err := encoded.folderReader(0)
+	if err != nil {
+		return nil, err
+	}
+	size := encoded.folders[0].unpackSize
+	header, err := io.ReadAll(io.LimitReader(folder, int64(size)))
+	if err != nil {
+		return nil, fmt.Errorf("decoding 7z header: %w", err)
+	}
+	if uint64(len(header)) != size {
+		return nil, errSevenZipCorrupted
+	}
+	if crc := encoded.folders[0].crcs[0]; crc != nil && crc32.ChecksumIEEE(header) != *crc {
+		return nil, errSevenZipCorrupted
+	}
+	return header, nil
+}
+
+func (r *sevenZipReader) parseStreamsInfo(buf *sevenZipBuffer) {
+	var (
+		packPos   uint64
+		packSizes []uint64
+		// index of the first packed stream of each folder
+		packIndex []int
+	)
+	for buf.err == nil {
+		switch buf.byte() {
+		case sevenZipEnd:
+			r.setPackedStreams(buf, packPos, packSizes, packIndex)
+			return
+		case sevenZipPackInfo:
+			packPos = buf.number()
+			packSizes = make([]uint64, buf.count())
+			for buf.err == nil {
+				id := buf.byte()
+				if id == sevenZipEnd {
+					break
+				}
+				switch id {
+				case sevenZipSize:
+					for i := range packSizes {
+						packSizes[i] = buf.number()
+					}
+				case sevenZipCRC:
+					buf.digests(len(packSizes))
+				default:
+					buf.fail()
+				}
+			}
+		case sevenZipUnpackInfo:
+			if buf.byte() != sevenZipFolder {
+				buf.fail()
+				return
+			}
+			r.folders = make([]sevenZipBlock, buf.count())
+			if buf.byte() != 0 {
+				// external folders
+				buf.fail()
+				return
+			}
+			packIndex = make([]int, len(r.folders))
+			var numPacked, numOut int
+			outs := make([]int, len(r.folders))
+			for i := range r.folders {
+				packIndex[i] = numPacked
+				packed, out := r.parseFolder(buf, &r.folders[i])
+				numPacked += packed
+				outs[i] = out
+				numOut += out
+			}
+			if buf.byte() != sevenZipCodersUnpackSize {
+				buf.fail()
+				return
+			}
+			for i := range r.folders {
+				// the last output of the folder is the final one
+				for j := 0; j < outs[i]; j++ {
+					r.folders[i].unpackSize = buf.number()
+				}
+			}
+			for buf.err == nil {
+				id := buf.byte()
+				if id == sevenZipEnd {
+					break
+				}
+				if id != sevenZipCRC {
+					buf.fail()
+					return
+				}
+				for i, crc := range buf.digests(len(r.folders)) {
+					r.folders[i].crcs = []*uint32{crc}
+				}
+			}
+			for i := range r.folders {
+				folder := &r.folders[i]
+				folder.sizes = []uint64{folder.unpackSize}
+				if folder.crcs == nil {
+					folder.crcs = []*uint32{nil}
+				}
+			}
+		case sevenZipSubStreamsInfo:
+			r.parseSubStreamsInfo(buf)
+		default:
+			buf.fail()
+		}
+	}
+}
+
+// setPackedStreams sets the location of the packed stream of each folder.
+func (r *sevenZipReader) setPackedStreams(buf *sevenZipBuffer, packPos uint64, packSizes []uint64, packIndex []int) {
+	offsets := make([]uint64, len(packSizes))
+	offset := uint64(sevenZipSignatureHeaderSize) + packPos
+	for i, size := range packSizes {
+		offsets[i] = offset
+		offset += size
+	}
+	for i := range r.folders {
+		if i >= len(packIndex) || packIndex[i] >= len(packSizes) {
+			buf.fail()
+			return
+		}
+		r.folders[i].packOffset = offsets[packIndex[i]]
+		r.folders[i].packSize = packSizes[packIndex[i]]
+	}
+}
+
+// parseFolder returns the number of packed streams and coder outputs.
+func (r *sevenZipReader) parseFolder(buf *sevenZipBuffer, folder *sevenZipBlock) (int, int) {
+	var numIn, numOut int
+	folder.coders = make([]sevenZipCoder, buf.count())
+	for i := range folder.coders {
+		flags := buf.byte()
+		coder := sevenZipCoder{id: buf.next(uint64(flags & 0x0F))}
+		in, out := 1, 1
+		if flags&0x10 != 0 {
+			in, out = buf.count(), buf.count()
+		}
+		if flags&0x20 != 0 {
+			coder.properties = buf.next(buf.number())
+		}
+		numIn += in
+		numOut += out
+		folder.coders[i] = coder
+	}
+
+	bindPairs := numOut - 1
+	for i := 0; i < bindPairs; i++ {
+		buf.number()
+		buf.number()
+	}
+	numPacked := numIn - bindPairs
+	if numPacked > 1 {
+		for i := 0; i < numPacked; i++ {
+			buf.number()
+		}
+	}
+	return numPacked, numOut
+}
+
+func (r *sevenZipReader) parseSubStreamsInfo(buf *sevenZipBuffer) {
+	numStreams := make([]int, len(r.folders))
+	for i := range numStreams {
+		numStreams[i] = 1
+	}
+
+	id := buf.byte()
+	if id == sevenZipNumUnpackStream {
+		for i := range numStreams {
+			numStreams[i] = buf.count()
+		}
+		id = buf.byte()
+	}
+
+	for i := range r.folders {
+		folder := &r.folders[i]
+		if numStreams[i] == 1 {
+			continue
+		}
+
+		folder.sizes = make([]uint64, numStreams[i])
+		folder.crcs = make([]*uint32, numStreams[i])
+		if numStreams[i] == 0 {
+			continue
+		}
+		var sum uint64
+		if id == sevenZipSize {
+			for j := 0; j < numStreams[i]-1; j++ {
+				folder.sizes[j] = buf.number()
+				sum += folder.sizes[j]
+			}
+		}
+		if sum > folder.unpackSize {
+			buf.fail()
+			return
+		}
+		folder.sizes[numStreams[i]-1] = folder.unpackSize - sum
+	}
+	if id == sevenZipSize {
+		id = buf.byte()
+	}
+
+	for buf.err == nil && id != sevenZipEnd {
+		if id != sevenZipCRC {
+			buf.fail()
+			return
+		}
+
+		// digests for the streams without a known folder CRC
+		var unknown []**uint32
+		for i := range r.folders {
+			folder := &r.folders[i]
+			if numStreams[i] == 1 && len(folder.crcs) > 0 && folder.crcs[0] != nil {
+				continue
+			}
+			for j := range folder.crcs {
+				unknown = append(unknown, &folder.crcs[j])
+			}
+		}
+		for i, crc := range buf.digests(len(unknown)) {
+			*unknown[i] = crc
+		}
+		id = buf.byte()
+	}
+}
+
+func (r *sevenZipReader) parseFilesInfo(buf *sevenZipBuffer) error {
+	files := make([]*sevenZipFile, buf.count())
+	for i := range files {
+		files[i] = &sevenZipFile{reader: r, folder: -1}
+	}
+
+	var emptyStream, emptyFile []bool
+	for buf.err == nil {
+		id := buf.byte()
+		if id == sevenZipEnd {
+			break
+		}
+		property := &sevenZipBuffer{data: buf.next(buf.number())}
+		if buf.err != nil {
+			break
+		}
+
+		switch id {
+		case sevenZipEmptyStream:
+			emptyStream = property.bits(len(files))
+		case sevenZipEmptyFile:
+			var empty int
+			for _, e := range emptyStream {
+				if e {
+					empty++
+				}
+			}
+			emptyFile = property.bits(empty)
+		case sevenZipName:
+			if property.byte() != 0 {
+				return errors.New("external 7z file names are not supported")
+			}
+			for _, file := range files {
+				var name []uint16
+				for property.err == nil {
+					c := binary.LittleEndian.Uint16(property.next(2))
+					if c == 0 {
+						break
+					}
+					name = append(name, c)
+				}
+				file.Name = string(utf16.Decode(name))
+			}
+		}
+		if property.err != nil {
+			return property.err
+		}
+	}
+	if buf.err != nil {
+		return buf.err
+	}
+
+	var folder, stream, empty int
+	var offset uint64
+	for i, file := range files {
+		if i < len(emptyStream) && emptyStream[i] {
+			file.dir = empty >= len(emptyFile) || !emptyFile[empty]
+			empty++
+			continue
+		}
+
+		for folder < len(r.folders) && stream >= len(r.folders[folder].sizes) {
+			folder++
+			stream, offset = 0, 0
+		}
+		if folder >= len(r.folders) || stream >= len(r.folders[folder].crcs) {
+			return errSevenZipCorrupted
+		}
+		file.folder = folder
+		file.offset = offset
+		file.Size = r.folders[folder].sizes[stream]
+		file.crc = r.folders[folder].crcs[stream]
+		offset += file.Size
+		stream++
+	}
+	r.Files = files
+	return nil
+}
+
+// sevenZipBuffer reads the 7z header, the first error is kept
+// and subsequent reads return zero values.
+type sevenZipBuffer struct {
+	data []byte
+	err  error
+}
+
+func (b *sevenZipBuffer) fail() {
+	if b.err == nil {
+		b.err = errSevenZipCorrupted
+	}
+}
+
+func (b *sevenZipBuffer) next(n uint64) []byte {
+	if b.err != nil || n > uint64(len(b.data)) {
+		b.fail()
+		// enough for the fixed size reads
+		return make([]byte, min(n, 8))
+	}
+	next := b.data[:n]
+	b.data = b.data[n:]
+	return next
+}
+
+func (b *sevenZipBuffer) byte() byte {
+	return b.next(1)[0]
+}
+
+// number reads a 7z variable length number.
+func (b *sevenZipBuffer) number() uint64 {
+	first := b.byte()
+	var v uint64
+	mask := byte(0x80)
+	for i := 0; i < 8; i++ {
+		if first&mask == 0 {
+			high := uint64(first & (mask - 1))
+			return v | high<<(8*i)
+		}
+		v |= uint64(b.byte()) << (8 * i)
+		mask >>= 1
+	}
+	return v
+}
+
+// count reads a number used as a count of items, which
+// can't be larger than the remaining header bytes.
+func (b *sevenZipBuffer) count() int {
+	n := b.number()
+	if n > uint64(len(b.data)) {
+		b.fail()
+		return 0
+	}
+	return int(n)
+}
+
+func (b *sevenZipBuffer) bits(n int) []bool {
+	data := b.next(uint64((n + 7) / 8))
+	bits := make([]bool, n)
+	for i := range bits {
+		if b.err == nil {
+			bits[i] = data[i/8]&(0x80>>(i%8)) != 0
+		}
+	}
+	return bits
+}
+
+// digests reads n optional CRCs.
+func (b *sevenZipBuffer) digests(n int) []*uint32 {
+	var defined []bool
+	if b.byte() != 0 {
+		defined = make([]bool, n)
+		for i := range defined {
+			defined[i] = true
+		}
+	} else {
+		defined = b.bits(n)
+	}
+
+	crcs := make([]*uint32, n)
+	for i := range crcs {
+		if defined[i] {
+			crc := binary.LittleEndian.Uint32(b.next(4))
+			crcs[i] = &crc
+		}
+	}
+	return crcs
+}
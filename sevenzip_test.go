@@ -0,0 +1,330 @@
+package libmangal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// sevenZipFixtureFiles are the contents of the testdata/sevenzip_*.7z
+// fixtures. They were written by libarchive (not by this package) with:
+//
+//	bsdtar --format 7zip --options 7zip:compression=<method> -cf sevenzip_<method>.7z chapter empty.txt
+func sevenZipFixtureFiles() map[string]string {
+	var first, second strings.Builder
+	for i := range 200 {
+		fmt.Fprintf(&first, "page %04d of the first chapter\n", i)
+	}
+	for i := range 300 {
+		fmt.Fprintf(&second, "page %04d of the second chapter\n", i)
+	}
+	return map[string]string{
+		"chapter/001.txt": first.String(),
+		"chapter/002.txt": second.String(),
+		"empty.txt":       "",
+	}
+}
+
+// readSevenZip reads all the files of the archive, by name.
+func readSevenZip(t *testing.T, data []byte) (map[string]string, []string) {
+	t.Helper()
+
+	reader, err := newSevenZipReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := make(map[string]string)
+	var dirs []string
+	for _, file := range reader.Files {
+		if file.IsDir() {
+			dirs = append(dirs, file.Name)
+			continue
+		}
+		contents, err := file.ReadAll()
+		if err != nil {
+			t.Fatalf("reading %q: %s", file.Name, err)
+		}
+		files[file.Name] = string(contents)
+	}
+	return files, dirs
+}
+
+func compareSevenZipFiles(t *testing.T, got, want map[string]string) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Errorf("got %d files, want %d", len(got), len(want))
+	}
+	for name, contents := range want {
+		gotContents, ok := got[name]
+		switch {
+		case !ok:
+			t.Errorf("file %q is missing", name)
+		case gotContents != contents:
+			t.Errorf("file %q has %d bytes that differ from the expected %d", name, len(gotContents), len(contents))
+		}
+	}
+}
+
+func TestSevenZipReaderFixtures(t *testing.T) {
+	want := sevenZipFixtureFiles()
+	for _, method := range []string{"store", "deflate", "bzip2", "lzma1", "lzma2"} {
+		t.Run(method, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", "sevenzip_"+method+".7z"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			files, dirs := readSevenZip(t, data)
+			compareSevenZipFiles(t, files, want)
+			if len(dirs) != 1 || dirs[0] != "chapter" {
+				t.Errorf("got directories %q, want [chapter]", dirs)
+			}
+		})
+	}
+}
+
+func TestSevenZipReaderCorrupted(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "sevenzip_store.7z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// flip a byte of the first stored file, right after the signature header
+	data[sevenZipSignatureHeaderSize] ^= 0xff
+	reader, err := newSevenZipReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var failed bool
+	for _, file := range reader.Files {
+		if _, err := file.ReadAll(); err != nil {
+			failed = true
+		}
+	}
+	if !failed {
+		t.Error("no checksum mismatch on corrupted contents")
+	}
+
+	// the start header is checked too
+	binary.LittleEndian.PutUint64(data[12:], 1<<40)
+	if _, err := newSevenZipReader(bytes.NewReader(data), int64(len(data))); err == nil {
+		t.Error("no error on corrupted start header")
+	}
+}
+
+func TestSevenZipRoundTrip(t *testing.T) {
+	files := sevenZipFixtureFiles()
+	files["pages/003.jpg"] = string(bytes.Repeat([]byte{0xff, 0xd8, 0x00, 0x42}, 1000))
+	files["ComicInfo.xml"] = "<ComicInfo></ComicInfo>"
+
+	var buf bytes.Buffer
+	writer := newSevenZipWriter(&buf)
+	// sorted so the archive is deterministic
+	for _, name := range []string{"ComicInfo.xml", "chapter/001.txt", "chapter/002.txt", "empty.txt", "pages/003.jpg"} {
+		writer.Add(name, []byte(files[name]), time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, dirs := readSevenZip(t, buf.Bytes())
+	compareSevenZipFiles(t, got, files)
+	if len(dirs) != 0 {
+		t.Errorf("got directories %q, want none", dirs)
+	}
+}
+
+func TestSevenZipRoundTripEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := newSevenZipWriter(&buf).Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ := readSevenZip(t, buf.Bytes())
+	if len(got) != 0 {
+		t.Errorf("got %d files from an empty archive", len(got))
+	}
+}
+
+// TestSevenZipWriterExternal checks that the archives are readable by
+// 7-Zip or libarchive, skipped if neither is installed.
+func TestSevenZipWriterExternal(t *testing.T) {
+	var check func(archive string) *exec.Cmd
+	if path, err := exec.LookPath("7z"); err == nil {
+		check = func(archive string) *exec.Cmd { return exec.Command(path, "t", archive) }
+	} else if path, err := exec.LookPath("bsdtar"); err == nil {
+		check = func(archive string) *exec.Cmd { return exec.Command(path, "-xOf", archive) }
+	} else {
+		t.Skip("neither 7z nor bsdtar are installed")
+	}
+
+	files := sevenZipFixtureFiles()
+	var buf bytes.Buffer
+	writer := newSevenZipWriter(&buf)
+	for _, name := range []string{"chapter/001.txt", "chapter/002.txt", "empty.txt"} {
+		writer.Add(name, []byte(files[name]), time.Now())
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := filepath.Join(t.TempDir(), "chapter.7z")
+	if err := os.WriteFile(archive, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	output, err := check(archive).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s\n%s", err, output)
+	}
+	if !bytes.Contains(output, []byte(files["chapter/002.txt"])) && !bytes.Contains(output, []byte("Everything is Ok")) {
+		t.Errorf("unexpected output:\n%s", output)
+	}
+}
+
+// sevenZipTestArchive builds an archive of the packed streams and the header.
+func sevenZipTestArchive(packed, header []byte) []byte {
+	startHeader := binary.LittleEndian.AppendUint64(nil, uint64(len(packed)))
+	startHeader = binary.LittleEndian.AppendUint64(startHeader, uint64(len(header)))
+	startHeader = binary.LittleEndian.AppendUint32(startHeader, crc32.ChecksumIEEE(header))
+
+	archive := append([]byte{}, sevenZipSignature...)
+	archive = append(archive, 0, 4)
+	archive = binary.LittleEndian.AppendUint32(archive, crc32.ChecksumIEEE(startHeader))
+	archive = append(archive, startHeader...)
+	archive = append(archive, packed...)
+	return append(archive, header...)
+}
+
+// sevenZipTestStreamsInfo is the streams info of a single folder
+// with the coder (flags, ID and properties), followed by the substreams info.
+func sevenZipTestStreamsInfo(packed []byte, coder []byte, unpackSize uint64, subStreams ...byte) []byte {
+	info := []byte{sevenZipPackInfo, 0, 1, sevenZipSize}
+	info = appendSevenZipNumber(info, uint64(len(packed)))
+	// one folder, not external, with one coder
+	info = append(info, sevenZipEnd, sevenZipUnpackInfo, sevenZipFolder, 1, 0, 1)
+	info = append(info, coder...)
+	info = append(info, sevenZipCodersUnpackSize)
+	info = appendSevenZipNumber(info, unpackSize)
+	info = append(info, sevenZipEnd)
+	info = append(info, subStreams...)
+	return append(info, sevenZipEnd)
+}
+
+// sevenZipTestFilesInfo is the files info of a single file named "a".
+var sevenZipTestFilesInfo = []byte{sevenZipFilesInfo, 1, sevenZipName, 5, 0, 'a', 0, 0, 0, sevenZipEnd}
+
+func TestSevenZipReaderMalformed(t *testing.T) {
+	packed := []byte("contents")
+	copyCoder := append([]byte{byte(len(sevenZipCopy))}, sevenZipCopy...)
+
+	tests := []struct {
+		name   string
+		header []byte
+	}{
+		{
+			// no unpack streams, so the header has no CRC
+			name: "encoded header without streams",
+			header: append([]byte{sevenZipEncodedHeader}, sevenZipTestStreamsInfo(packed, copyCoder, uint64(len(packed)),
+				sevenZipSubStreamsInfo, sevenZipNumUnpackStream, 0, sevenZipEnd)...),
+		},
+		{
+			name: "substreams info after no unpack streams",
+			header: slices.Concat(
+				[]byte{sevenZipHeader, sevenZipMainStreamsInfo},
+				sevenZipTestStreamsInfo(packed, copyCoder, uint64(len(packed)),
+					sevenZipSubStreamsInfo, sevenZipNumUnpackStream, 0, sevenZipEnd,
+					sevenZipSubStreamsInfo, sevenZipCRC, 1, sevenZipEnd),
+				sevenZipTestFilesInfo,
+				[]byte{sevenZipEnd},
+			),
+		},
+		{
+			name: "file without stream",
+			header: slices.Concat(
+				[]byte{sevenZipHeader, sevenZipMainStreamsInfo},
+				sevenZipTestStreamsInfo(packed, copyCoder, uint64(len(packed)),
+					sevenZipSubStreamsInfo, sevenZipNumUnpackStream, 0, sevenZipEnd),
+				sevenZipTestFilesInfo,
+				[]byte{sevenZipEnd},
+			),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := sevenZipTestArchive(packed, tt.header)
+			if _, err := newSevenZipReader(bytes.NewReader(data), int64(len(data))); !errors.Is(err, errSevenZipCorrupted) {
+				t.Errorf("got error %v, want %v", err, errSevenZipCorrupted)
+			}
+		})
+	}
+}
+
+func TestSevenZipReaderLZMADictionary(t *testing.T) {
+	contents := bytes.Repeat([]byte("page of the chapter\n"), 1000)
+	var compressed bytes.Buffer
+	writer, err := lzma.WriterConfig{SizeInHeader: true, Size: int64(len(contents))}.NewWriter(&compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write(contents); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the classic header is the properties, the dictionary size and the size
+	properties := slices.Clone(compressed.Bytes()[:5])
+	packed := compressed.Bytes()[lzma.HeaderLen:]
+	lzmaCoder := func(dictSize uint32) []byte {
+		coder := append([]byte{0x20 | byte(len(sevenZipLZMA))}, sevenZipLZMA...)
+		coder = append(coder, 5, properties[0])
+		return binary.LittleEndian.AppendUint32(coder, dictSize)
+	}
+	allocated := func(f func()) uint64 {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		f()
+		runtime.ReadMemStats(&after)
+		return after.TotalAlloc - before.TotalAlloc
+	}
+
+	// a dictionary larger than the contents and than the LZMA reader accepts
+	header := slices.Concat([]byte{sevenZipHeader, sevenZipMainStreamsInfo},
+		sevenZipTestStreamsInfo(packed, lzmaCoder(math.MaxUint32), uint64(len(contents))),
+		sevenZipTestFilesInfo, []byte{sevenZipEnd})
+	files, _ := readSevenZip(t, sevenZipTestArchive(packed, header))
+	compareSevenZipFiles(t, files, map[string]string{"a": string(contents)})
+
+	// a huge dictionary and unpacked size, not allocated
+	header = slices.Concat([]byte{sevenZipHeader, sevenZipMainStreamsInfo},
+		sevenZipTestStreamsInfo(packed, lzmaCoder(math.MaxInt32), 1<<40),
+		sevenZipTestFilesInfo, []byte{sevenZipEnd})
+	data := sevenZipTestArchive(packed, header)
+	reader, err := newSevenZipReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := allocated(func() {
+		if _, err := reader.Files[0].ReadAll(); err == nil {
+			t.Error("no error reading the truncated contents")
+		}
+	}); n > 2*sevenZipMaxDictCap {
+		t.Errorf("allocated %d bytes, want at most %d", n, 2*sevenZipMaxDictCap)
+	}
+}
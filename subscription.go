@@ -0,0 +1,580 @@
+package libmangal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/luevano/libmangal/logger"
+	"github.com/luevano/libmangal/mangadata"
+	"github.com/luevano/libmangal/metadata"
+	"github.com/philippgille/gokv"
+)
+
+const (
+	// subscriptionKeyList is the store key of the list of subscription keys.
+	subscriptionKeyList = "subscriptions"
+
+	// subscriptionKeyPrefix prefixes the store key of each subscription.
+	subscriptionKeyPrefix = "subscription/"
+)
+
+// Subscription is a followed manga, checked for new chapters by the Scheduler.
+type Subscription struct {
+	// ProviderID is the ProviderInfo.ID of the manga provider.
+	ProviderID string `json:"provider_id"`
+
+	// MangaID is the MangaInfo.ID of the manga.
+	MangaID string `json:"manga_id"`
+
+	// MangaTitle is used to search the manga in the provider
+	// (providers can't get a manga by its ID).
+	MangaTitle string `json:"manga_title"`
+
+	// ScanlationGroup is the preferred scanlation group, when a chapter is
+	// available from multiple groups. If empty (or not available), the
+	// chapter is selected by the SchedulerOptions.DownloadOptions
+	// ChapterSelect preferences (see Client.SelectChapters).
+	ScanlationGroup string `json:"scanlation_group"`
+
+	// AutoDownload downloads the new chapters when found.
+	AutoDownload bool `json:"auto_download"`
+
+	// Format to download the chapters in, zero means
+	// the SchedulerOptions.DownloadOptions format.
+	Format Format `json:"format,omitempty"`
+
+	// DeviceProfile to download the chapters with (see
+	// DownloadOptions.DeviceProfile), empty means the
+	// SchedulerOptions.DownloadOptions device profile.
+	DeviceProfile string `json:"device_profile,omitempty"`
+
+	// LastChapter is the latest chapter number found, only chapters after it are new.
+	//
+	// Set it when subscribing to skip the chapters already available.
+	LastChapter float32 `json:"last_chapter"`
+
+	// LastChecked is the time of the last check, zero if never checked.
+	LastChecked time.Time `json:"last_checked"`
+}
+
+// key of the subscription in the store.
+func (s Subscription) key() string {
+	return s.ProviderID + "/" + s.MangaID
+}
+
+// SubscriptionStore persists the Subscriptions.
+type SubscriptionStore struct {
+	store gokv.Store
+	mu    sync.Mutex
+}
+
+// NewSubscriptionStore constructs a new SubscriptionStore on top of the given gokv.Store.
+func NewSubscriptionStore(store gokv.Store) (*SubscriptionStore, error) {
+	if store == nil {
+		return nil, errors.New("nil gokv.Store passed to SubscriptionStore")
+	}
+	return &SubscriptionStore{store: store}, nil
+}
+
+// Get the subscription of the given provider and manga IDs.
+func (s *SubscriptionStore) Get(providerID, mangaID string) (Subscription, bool, error) {
+	var subscription Subscription
+	found, err := s.store.Get(subscriptionKeyPrefix+providerID+"/"+mangaID, &subscription)
+	return subscription, found, err
+}
+
+// List all the subscriptions, sorted by provider and manga ID.
+func (s *SubscriptionStore) List() ([]Subscription, error) {
+	keys, err := s.keys()
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptions := make([]Subscription, 0, len(keys))
+	for _, key := range keys {
+		var subscription Subscription
+		found, err := s.store.Get(subscriptionKeyPrefix+key, &subscription)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	return subscriptions, nil
+}
+
+// Set adds the subscription, or replaces the one of the same provider and manga IDs.
+func (s *SubscriptionStore) Set(subscription Subscription) error {
+	if subscription.ProviderID == "" {
+		return errors.New("subscription ProviderID must be non-empty")
+	}
+	if subscription.MangaID == "" {
+		return errors.New("subscription MangaID must be non-empty")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := subscription.key()
+	if err := s.store.Set(subscriptionKeyPrefix+key, subscription); err != nil {
+		return err
+	}
+
+	keys, err := s.keys()
+	if err != nil {
+		return err
+	}
+	i := sort.SearchStrings(keys, key)
+	if i < len(keys) && keys[i] == key {
+		return nil
+	}
+	keys = append(keys[:i], append([]string{key}, keys[i:]...)...)
+	return s.store.Set(subscriptionKeyList, keys)
+}
+
+// Delete removes the subscription of the given provider and manga IDs.
+func (s *SubscriptionStore) Delete(providerID, mangaID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := Subscription{ProviderID: providerID, MangaID: mangaID}.key()
+	if err := s.store.Delete(subscriptionKeyPrefix + key); err != nil {
+		return err
+	}
+
+	keys, err := s.keys()
+	if err != nil {
+		return err
+	}
+	i := sort.SearchStrings(keys, key)
+	if i == len(keys) || keys[i] != key {
+		return nil
+	}
+	return s.store.Set(subscriptionKeyList, append(keys[:i], keys[i+1:]...))
+}
+
+// updateChecked sets the LastChapter and LastChecked of the stored subscription,
+// keeping the other fields as they are now (e.g. changed during the check).
+//
+// Returns the updated subscription, false if it was deleted.
+func (s *SubscriptionStore) updateChecked(checked Subscription) (Subscription, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subscription, found, err := s.Get(checked.ProviderID, checked.MangaID)
+	if err != nil || !found {
+		return checked, false, err
+	}
+	subscription.LastChapter = checked.LastChapter
+	subscription.LastChecked = checked.LastChecked
+	return subscription, true, s.store.Set(subscriptionKeyPrefix+subscription.key(), subscription)
+}
+
+// Close closes the underlying store.
+func (s *SubscriptionStore) Close() error {
+	return s.store.Close()
+}
+
+func (s *SubscriptionStore) keys() ([]string, error) {
+	var keys []string
+	_, err := s.store.Get(subscriptionKeyList, &keys)
+	return keys, err
+}
+
+// SubscriptionEvent is the result of checking a Subscription,
+// sent to the Notifiers when there are new chapters or an error.
+type SubscriptionEvent struct {
+	// Subscription as updated by the check.
+	Subscription Subscription `json:"subscription"`
+
+	// Manga found in the provider, nil if the check failed before.
+	Manga mangadata.Manga `json:"-"`
+
+	// Chapters that are new, one per chapter number.
+	Chapters []mangadata.Chapter `json:"-"`
+
+	// ChaptersInfo of the new Chapters.
+	ChaptersInfo []mangadata.ChapterInfo `json:"chapters"`
+
+	// Downloaded chapters, when Subscription.AutoDownload is set.
+	Downloaded []metadata.DownloadedChapter `json:"downloaded"`
+
+	// Error of the check (or downloads), empty if none.
+	Error string `json:"error,omitempty"`
+}
+
+// Notifier is notified of the subscription events.
+type Notifier interface {
+	Notify(ctx context.Context, event SubscriptionEvent) error
+}
+
+// NotifierFunc is a callback Notifier.
+type NotifierFunc func(ctx context.Context, event SubscriptionEvent) error
+
+// Notify calls f.
+func (f NotifierFunc) Notify(ctx context.Context, event SubscriptionEvent) error {
+	return f(ctx, event)
+}
+
+// WebhookNotifier posts the event as JSON to the URL.
+type WebhookNotifier struct {
+	// URL the event is posted to.
+	URL string
+
+	// HTTPClient used for the request, http.DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+// Notify posts the event, any non 2xx response status is an error.
+func (n WebhookNotifier) Notify(ctx context.Context, event SubscriptionEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := n.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %q responded with status %s", n.URL, resp.Status)
+	}
+	return nil
+}
+
+// CommandNotifier runs a command with the event as JSON in its standard input.
+//
+// The environment also has LIBMANGAL_PROVIDER_ID, LIBMANGAL_MANGA_ID,
+// LIBMANGAL_MANGA_TITLE, LIBMANGAL_CHAPTERS (the new chapter numbers
+// separated by spaces) and LIBMANGAL_ERROR.
+type CommandNotifier struct {
+	// Name of the command.
+	Name string
+
+	// Args of the command.
+	Args []string
+}
+
+// Notify runs the command, a non zero exit status is an error.
+func (n CommandNotifier) Notify(ctx context.Context, event SubscriptionEvent) error {
+	input, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	numbers := make([]string, len(event.ChaptersInfo))
+	for i, info := range event.ChaptersInfo {
+		numbers[i] = fmt.Sprint(info.Number)
+	}
+
+	cmd := exec.CommandContext(ctx, n.Name, n.Args...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Env = append(os.Environ(),
+		"LIBMANGAL_PROVIDER_ID="+event.Subscription.ProviderID,
+		"LIBMANGAL_MANGA_ID="+event.Subscription.MangaID,
+		"LIBMANGAL_MANGA_TITLE="+event.Subscription.MangaTitle,
+		"LIBMANGAL_CHAPTERS="+strings.Join(numbers, " "),
+		"LIBMANGAL_ERROR="+event.Error,
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("running %q: %w: %s", n.Name, err, output)
+	}
+	return nil
+}
+
+// Clock tells the time to the Scheduler, replaceable for testing.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// After waits for the duration to elapse and then sends the current time.
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// SchedulerOptions configures the Scheduler.
+type SchedulerOptions struct {
+	// Interval between checks.
+	Interval time.Duration
+
+	// Jitter is the maximum random duration added to each interval,
+	// so checks don't always happen at the same time.
+	Jitter time.Duration
+
+	// DownloadOptions used for the auto downloads, with
+	// the format and device profile of each subscription.
+	DownloadOptions DownloadOptions
+
+	// Notifiers are notified of each SubscriptionEvent.
+	Notifiers []Notifier
+
+	// Clock used for the intervals and check times, the real one if nil.
+	Clock Clock
+
+	// Rand returns the random jitter added to an interval, in [0, max).
+	// Replaceable for testing, math/rand/v2.N if nil.
+	Rand func(max time.Duration) time.Duration
+}
+
+// DefaultSchedulerOptions constructs default SchedulerOptions.
+func DefaultSchedulerOptions() SchedulerOptions {
+	return SchedulerOptions{
+		Interval:        6 * time.Hour,
+		Jitter:          10 * time.Minute,
+		DownloadOptions: DefaultDownloadOptions(),
+		Notifiers:       nil,
+		Clock:           nil,
+		Rand:            nil,
+	}
+}
+
+// Scheduler checks the subscriptions for new chapters on an interval.
+type Scheduler struct {
+	store   *SubscriptionStore
+	clients map[string]*Client
+	options SchedulerOptions
+	clock   Clock
+	rand    func(max time.Duration) time.Duration
+	logger  *logger.Logger
+}
+
+// NewScheduler constructs a new Scheduler for the subscriptions in the store.
+//
+// Each subscription is checked with the client of its provider
+// (by ProviderInfo.ID), subscriptions without a client are skipped.
+func NewScheduler(store *SubscriptionStore, clients []*Client, options SchedulerOptions) (*Scheduler, error) {
+	if store == nil {
+		return nil, errors.New("nil SubscriptionStore passed to Scheduler")
+	}
+	if options.Interval <= 0 {
+		return nil, errors.New("scheduler Interval must be positive")
+	}
+
+	scheduler := &Scheduler{
+		store:   store,
+		clients: make(map[string]*Client, len(clients)),
+		options: options,
+		clock:   options.Clock,
+		rand:    options.Rand,
+		logger:  logger.NewLogger(),
+	}
+	if scheduler.clock == nil {
+		scheduler.clock = realClock{}
+	}
+	if scheduler.rand == nil {
+		scheduler.rand = rand.N[time.Duration]
+	}
+	for _, client := range clients {
+		scheduler.clients[client.Info().ID] = client
+	}
+	return scheduler, nil
+}
+
+// Logger returns the Scheduler's Logger, used for the errors
+// not related to a subscription (those use the client's Logger).
+func (s *Scheduler) Logger() *logger.Logger {
+	return s.logger
+}
+
+// Run checks the subscriptions every interval (plus jitter)
+// until the context is done, starting immediately.
+//
+// If the subscriptions can't be listed, the error is
+// logged and they're checked again on the next interval.
+func (s *Scheduler) Run(ctx context.Context) error {
+	for {
+		if _, err := s.CheckAll(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			s.logger.Log("error checking subscriptions, retrying in the next interval: %s", err.Error())
+		}
+
+		wait := s.options.Interval
+		if s.options.Jitter > 0 {
+			wait += s.rand(s.options.Jitter)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.clock.After(wait):
+		}
+	}
+}
+
+// CheckAll checks all the subscriptions, see Check.
+//
+// Only returns an error if the subscriptions can't be listed
+// or the context is done, the others are set to the events.
+func (s *Scheduler) CheckAll(ctx context.Context) ([]SubscriptionEvent, error) {
+	subscriptions, err := s.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var events []SubscriptionEvent
+	for _, subscription := range subscriptions {
+		if _, ok := s.clients[subscription.ProviderID]; !ok {
+			continue
+		}
+
+		event, err := s.Check(ctx, subscription)
+		if err != nil && ctx.Err() != nil {
+			return events, ctx.Err()
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// Check checks the subscription for chapters after its LastChapter, downloading
+// them if AutoDownload is set. The LastChapter and LastChecked of the stored
+// subscription are then updated (unless it was deleted meanwhile) and the
+// Notifiers are notified if there are new chapters or an error.
+//
+// The returned error is also set to the event.
+func (s *Scheduler) Check(ctx context.Context, subscription Subscription) (SubscriptionEvent, error) {
+	event, err := s.check(ctx, subscription)
+	if err != nil {
+		event.Error = err.Error()
+		s.logf(subscription.ProviderID, "error checking subscription %q: %s", subscription.MangaTitle, event.Error)
+	}
+
+	if len(event.Chapters) != 0 || event.Error != "" {
+		for _, notifier := range s.options.Notifiers {
+			if err := notifier.Notify(ctx, event); err != nil {
+				s.logf(subscription.ProviderID, "error notifying subscription %q: %s", subscription.MangaTitle, err.Error())
+			}
+		}
+	}
+	return event, err
+}
+
+func (s *Scheduler) check(ctx context.Context, subscription Subscription) (SubscriptionEvent, error) {
+	event := SubscriptionEvent{Subscription: subscription}
+
+	client, ok := s.clients[subscription.ProviderID]
+	if !ok {
+		return event, fmt.Errorf("no client for provider %q", subscription.ProviderID)
+	}
+
+	mangas, err := client.SearchMangas(ctx, subscription.MangaTitle)
+	if err != nil {
+		return event, err
+	}
+	for _, manga := range mangas {
+		if manga.Info().ID == subscription.MangaID {
+			event.Manga = manga
+			break
+		}
+	}
+	if event.Manga == nil {
+		return event, fmt.Errorf("manga %q (%s) not found in %s", subscription.MangaTitle, subscription.MangaID, client)
+	}
+
+	chapters, err := client.MangaChapters(ctx, event.Manga)
+	if err != nil {
+		return event, err
+	}
+	event.Chapters, err = subscription.newChapters(ctx, client, chapters, s.options.DownloadOptions.ChapterSelect)
+	if err != nil {
+		return event, err
+	}
+
+	for _, chapter := range event.Chapters {
+		event.ChaptersInfo = append(event.ChaptersInfo, chapter.Info())
+	}
+	event.Subscription.LastChecked = s.clock.Now()
+
+	var downloadErr error
+	for _, chapter := range event.Chapters {
+		if subscription.AutoDownload {
+			options := s.options.DownloadOptions
+			if subscription.Format != 0 {
+				options.Format = subscription.Format
+			}
+			if subscription.DeviceProfile != "" {
+				options.DeviceProfile = subscription.DeviceProfile
+			}
+
+			downloaded, err := client.DownloadChapter(ctx, chapter, options)
+			if err != nil {
+				// this and the following chapters are retried on the next check
+				downloadErr = fmt.Errorf("downloading chapter %q: %w", chapter, err)
+				break
+			}
+			event.Downloaded = append(event.Downloaded, *downloaded)
+		}
+		event.Subscription.LastChapter = chapter.Info().Number
+	}
+
+	updated, found, err := s.store.updateChecked(event.Subscription)
+	if err != nil {
+		return event, err
+	}
+	if found {
+		event.Subscription = updated
+	}
+	return event, downloadErr
+}
+
+// newChapters returns the chapters after LastChapter, sorted by
+// number and one per number (of the preferred scanlation group).
+func (s Subscription) newChapters(
+	ctx context.Context,
+	client *Client,
+	chapters []mangadata.Chapter,
+	options ChapterSelectOptions,
+) ([]mangadata.Chapter, error) {
+	var newer []mangadata.Chapter
+	for _, chapter := range chapters {
+		if chapter.Info().Number > s.LastChapter {
+			newer = append(newer, chapter)
+		}
+	}
+
+	if s.ScanlationGroup != "" {
+		options.PreferredGroups = append([]string{s.ScanlationGroup}, options.PreferredGroups...)
+	}
+	return client.SelectChapters(ctx, newer, options)
+}
+
+func (s *Scheduler) logf(providerID, format string, args ...any) {
+	if client, ok := s.clients[providerID]; ok {
+		client.logger.Log(format, args...)
+	}
+}
@@ -0,0 +1,317 @@
+package libmangal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/luevano/libmangal/mangadata"
+	"github.com/philippgille/gokv/syncmap"
+	"github.com/spf13/afero"
+)
+
+// fakeClock sends the durations waited to waits, and
+// the waits end when a time is sent to fire.
+type fakeClock struct {
+	now   time.Time
+	waits chan time.Duration
+	fire  chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{
+		now:   time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC),
+		waits: make(chan time.Duration),
+		fire:  make(chan time.Time),
+	}
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.waits <- d
+	return c.fire
+}
+
+func newTestSubscriptionStore(t *testing.T, subscriptions ...Subscription) *SubscriptionStore {
+	t.Helper()
+
+	store, err := NewSubscriptionStore(syncmap.NewStore(syncmap.DefaultOptions))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	for _, subscription := range subscriptions {
+		if err := store.Set(subscription); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+// newTestScheduler creates a scheduler of a fake provider with a manga
+// with chapters 1, 2 (two groups) and 3, downloaded to a memory FS.
+func newTestScheduler(t *testing.T, store *SubscriptionStore, options SchedulerOptions) (*Scheduler, *fakeProvider) {
+	t.Helper()
+
+	provider := &fakeProvider{mangas: []*fakeManga{newFakeManga("berserk", "Berserk",
+		mangadata.ChapterInfo{Number: 1, Title: "One", ScanlationGroup: "A"},
+		mangadata.ChapterInfo{Number: 2, Title: "Two", ScanlationGroup: "A"},
+		mangadata.ChapterInfo{Number: 2, Title: "Two", ScanlationGroup: "B"},
+		mangadata.ChapterInfo{Number: 3, Title: "Three", ScanlationGroup: "A"},
+	)}}
+	client := newFakeClient(t, afero.NewMemMapFs(), provider)
+
+	if options.Clock == nil {
+		options.Clock = newFakeClock()
+	}
+	options.DownloadOptions = testDownloadOptions("library")
+	scheduler, err := NewScheduler(store, []*Client{client}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return scheduler, provider
+}
+
+func testSubscription() Subscription {
+	return Subscription{ProviderID: "fake", MangaID: "berserk", MangaTitle: "Berserk"}
+}
+
+func TestSchedulerRun(t *testing.T) {
+	// a missing manga, so each check notifies an error
+	missing := Subscription{ProviderID: "fake", MangaID: "missing", MangaTitle: "Missing"}
+	store := newTestSubscriptionStore(t, missing)
+
+	clock := newFakeClock()
+	events := make(chan SubscriptionEvent, 10)
+	var jitterMax time.Duration
+	scheduler, _ := newTestScheduler(t, store, SchedulerOptions{
+		Interval: time.Hour,
+		Jitter:   10 * time.Minute,
+		Clock:    clock,
+		Rand: func(max time.Duration) time.Duration {
+			jitterMax = max
+			return 7 * time.Minute
+		},
+		Notifiers: []Notifier{NotifierFunc(func(_ context.Context, event SubscriptionEvent) error {
+			events <- event
+			return nil
+		})},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- scheduler.Run(ctx) }()
+
+	for check := 1; check <= 2; check++ {
+		// checked immediately, then after each wait
+		if event := <-events; event.Error == "" {
+			t.Errorf("check %d: no error for the missing manga", check)
+		}
+		if wait := <-clock.waits; wait != 67*time.Minute {
+			t.Errorf("check %d: waiting %s, want the interval plus the jitter (1h7m)", check, wait)
+		}
+		if jitterMax != 10*time.Minute {
+			t.Errorf("check %d: jitter of at most %s, want 10m", check, jitterMax)
+		}
+		if check == 1 {
+			select {
+			case event := <-events:
+				t.Fatalf("checked again before the interval: %+v", event)
+			default:
+			}
+			clock.fire <- clock.now.Add(67 * time.Minute)
+		}
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Run returned %v, want context.Canceled", err)
+	}
+}
+
+func TestSubscriptionNewChapters(t *testing.T) {
+	store := newTestSubscriptionStore(t)
+	scheduler, provider := newTestScheduler(t, store, DefaultSchedulerOptions())
+	client := scheduler.clients["fake"]
+	chapters, err := client.MangaChapters(context.Background(), provider.mangas[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		subscription Subscription
+		want         []mangadata.ChapterInfo
+	}{
+		{
+			name:         "all",
+			subscription: Subscription{},
+			want:         []mangadata.ChapterInfo{chapters[0].Info(), chapters[1].Info(), chapters[3].Info()},
+		},
+		{
+			name:         "after last chapter",
+			subscription: Subscription{LastChapter: 1},
+			want:         []mangadata.ChapterInfo{chapters[1].Info(), chapters[3].Info()},
+		},
+		{
+			name:         "preferred group",
+			subscription: Subscription{LastChapter: 1, ScanlationGroup: "b"},
+			want:         []mangadata.ChapterInfo{chapters[2].Info(), chapters[3].Info()},
+		},
+		{
+			name:         "none",
+			subscription: Subscription{LastChapter: 3},
+			want:         nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.subscription.newChapters(context.Background(), client, chapters, DefaultChapterSelectOptions())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d chapters, want %d", len(got), len(tt.want))
+			}
+			for i, chapter := range got {
+				if chapter.Info() != tt.want[i] {
+					t.Errorf("chapter %d is %+v, want %+v", i, chapter.Info(), tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSchedulerAutoDownload(t *testing.T) {
+	subscription := testSubscription()
+	subscription.AutoDownload = true
+	store := newTestSubscriptionStore(t, subscription)
+	scheduler, provider := newTestScheduler(t, store, DefaultSchedulerOptions())
+
+	provider.setFailing(2)
+	event, err := scheduler.Check(context.Background(), subscription)
+	if err == nil || event.Error == "" {
+		t.Fatal("no error downloading the failing chapter")
+	}
+	if len(event.Downloaded) != 1 || event.Downloaded[0].Number != 1 {
+		t.Errorf("downloaded %+v, want chapter 1", event.Downloaded)
+	}
+	if provider.requested[3] != 0 {
+		t.Error("chapter 3 was downloaded after the failing one")
+	}
+	stored, _, err := store.Get("fake", "berserk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.LastChapter != 1 {
+		t.Errorf("LastChapter is %v, want 1", stored.LastChapter)
+	}
+
+	// retried on the next check
+	provider.setFailing()
+	event, err = scheduler.Check(context.Background(), stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(event.Downloaded) != 2 {
+		t.Errorf("downloaded %d chapters, want 2", len(event.Downloaded))
+	}
+	if stored, _, _ := store.Get("fake", "berserk"); stored.LastChapter != 3 {
+		t.Errorf("LastChapter is %v, want 3", stored.LastChapter)
+	}
+}
+
+func TestSchedulerNotifiers(t *testing.T) {
+	subscription := testSubscription()
+	store := newTestSubscriptionStore(t, subscription, Subscription{ProviderID: "other", MangaID: "x", MangaTitle: "X"})
+
+	var notified []SubscriptionEvent
+	options := DefaultSchedulerOptions()
+	options.Notifiers = []Notifier{
+		NotifierFunc(func(context.Context, SubscriptionEvent) error {
+			return errors.New("failing notifier")
+		}),
+		NotifierFunc(func(_ context.Context, event SubscriptionEvent) error {
+			notified = append(notified, event)
+			return nil
+		}),
+	}
+	scheduler, _ := newTestScheduler(t, store, options)
+
+	// the subscription without client is skipped
+	events, err := scheduler.CheckAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	if len(notified) != 1 {
+		t.Fatalf("notified %d times, want 1 (even after a failing notifier)", len(notified))
+	}
+	if got := len(notified[0].ChaptersInfo); got != 3 {
+		t.Errorf("notified %d chapters, want 3", got)
+	}
+	if !notified[0].Subscription.LastChecked.Equal(newFakeClock().now) {
+		t.Errorf("LastChecked is %s", notified[0].Subscription.LastChecked)
+	}
+
+	// no new chapters, not notified
+	if _, err := scheduler.CheckAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(notified) != 1 {
+		t.Errorf("notified %d times without new chapters, want 1", len(notified))
+	}
+}
+
+func TestSchedulerCheckKeepsConcurrentChanges(t *testing.T) {
+	subscription := testSubscription()
+	store := newTestSubscriptionStore(t, subscription)
+	scheduler, provider := newTestScheduler(t, store, DefaultSchedulerOptions())
+
+	// changed by the user while checking
+	provider.onSearch = func() {
+		changed := subscription
+		changed.ScanlationGroup = "B"
+		changed.Format = FormatPDF
+		if err := store.Set(changed); err != nil {
+			t.Error(err)
+		}
+	}
+	event, err := scheduler.Check(context.Background(), subscription)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, _, err := store.Get("fake", "berserk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.ScanlationGroup != "B" || stored.Format != FormatPDF {
+		t.Errorf("the changes were overwritten: %+v", stored)
+	}
+	if stored.LastChapter != 3 || stored.LastChecked.IsZero() {
+		t.Errorf("the check was not recorded: %+v", stored)
+	}
+	if event.Subscription != stored {
+		t.Errorf("event subscription %+v, want the stored one %+v", event.Subscription, stored)
+	}
+
+	// deleted while checking, not added back
+	provider.onSearch = func() {
+		if err := store.Delete("fake", "berserk"); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := scheduler.Check(context.Background(), stored); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := store.Get("fake", "berserk"); found {
+		t.Error("deleted subscription was added back")
+	}
+}
@@ -0,0 +1,333 @@
+package libmangal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"path/filepath"
+	"strings"
+
+	"github.com/luevano/libmangal/mangadata"
+	"github.com/spf13/afero"
+)
+
+// ChapterVerification is the result of verifying a chapter on disk.
+type ChapterVerification struct {
+	// Path of the chapter.
+	Path string `json:"path"`
+
+	// Format of the chapter.
+	Format Format `json:"format"`
+
+	// Pages is the amount of pages found in the chapter.
+	Pages int `json:"pages"`
+
+	// Problems found in the chapter, empty if it's intact.
+	Problems []string `json:"problems,omitempty"`
+
+	// Redownloaded is the path the chapter was downloaded
+	// again to, empty if it wasn't (see VerifyOptions.Redownload).
+	Redownloaded string `json:"redownloaded,omitempty"`
+
+	// RedownloadError is the error downloading the chapter
+	// again, empty if it wasn't tried or it was downloaded correctly.
+	RedownloadError string `json:"redownload_error,omitempty"`
+}
+
+// OK is true if the chapter has no problems.
+func (v ChapterVerification) OK() bool {
+	return len(v.Problems) == 0
+}
+
+// VerifyChapter checks that the chapter at path is complete and not
+// corrupted: the archive (or document) can be read, every page decodes,
+// the embedded ComicInfo.xml parses and its PageCount (if any) matches
+// the amount of pages.
+//
+// Problems found are set to the ChapterVerification, the returned
+// error is only for chapters whose format can't be detected.
+func VerifyChapter(fs afero.Fs, path string) (ChapterVerification, error) {
+	format, err := formatFromPath(fs, path)
+	if err != nil {
+		return ChapterVerification{}, err
+	}
+	return verifyChapter(fs, path, format), nil
+}
+
+// VerifyChapter verifies the chapter at path on the client FS,
+// see VerifyChapter.
+func (c *Client) VerifyChapter(path string) (ChapterVerification, error) {
+	return VerifyChapter(c.options.FS, path)
+}
+
+func verifyChapter(fs afero.Fs, path string, format Format) ChapterVerification {
+	verification := ChapterVerification{Path: path, Format: format}
+	problem := func(format string, args ...any) {
+		verification.Problems = append(verification.Problems, fmt.Sprintf(format, args...))
+	}
+
+	// also fails if the ComicInfo.xml doesn't parse
+	reader, err := openChapter(fs, path, format)
+	if err != nil {
+		problem("can't read chapter: %s", err)
+		return verification
+	}
+	defer reader.Close()
+
+	pages := reader.Pages()
+	verification.Pages = len(pages)
+	if len(pages) == 0 {
+		problem("chapter has no pages")
+	}
+	for i, page := range pages {
+		data, _, err := reader.ReadPage(i)
+		if err != nil {
+			problem("page %q: %s", page.Name, err)
+			continue
+		}
+		// formats without a registered decoder (e.g. AVIF) are only sniffed
+		_, _, err = image.Decode(bytes.NewReader(data))
+		if err != nil && !errors.Is(err, image.ErrFormat) {
+			problem("page %q doesn't decode: %s", page.Name, err)
+		}
+	}
+
+	comicInfoXML := reader.ComicInfoXML()
+	if comicInfoXML != nil && comicInfoXML.PageCount != 0 && comicInfoXML.PageCount != len(pages) {
+		problem("ComicInfo.xml PageCount is %d but the chapter has %d pages", comicInfoXML.PageCount, len(pages))
+	}
+	return verification
+}
+
+// verifyManifestChapter compares the chapter with its manifest entry.
+func verifyManifestChapter(fs afero.Fs, entry ManifestChapter, verification *ChapterVerification) {
+	if entry.Format != verification.Format {
+		verification.Problems = append(verification.Problems,
+			fmt.Sprintf("format is %s but the manifest has %s", verification.Format, entry.Format))
+		return
+	}
+	sum, size, err := chapterChecksum(fs, verification.Path, verification.Format)
+	switch {
+	case err != nil:
+		verification.Problems = append(verification.Problems, fmt.Sprintf("can't checksum chapter: %s", err))
+	case size != entry.Size:
+		verification.Problems = append(verification.Problems,
+			fmt.Sprintf("size is %d bytes but the manifest has %d", size, entry.Size))
+	case sum != entry.SHA256:
+		verification.Problems = append(verification.Problems, "SHA-256 doesn't match the manifest")
+	}
+}
+
+// VerifyOptions configures Library.Verify.
+type VerifyOptions struct {
+	// Redownload the chapters that fail the verification from the client
+	// provider, replacing them. Only the mangas of the client provider are
+	// redownloaded, found as in Library.CheckUpdates.
+	Redownload bool
+
+	// DownloadOptions used to redownload the chapters, the Format of
+	// each chapter is kept and SkipIfExists is ignored. Should match
+	// the library layout (see LibraryOptions).
+	DownloadOptions DownloadOptions
+}
+
+// DefaultVerifyOptions constructs default VerifyOptions.
+func DefaultVerifyOptions() VerifyOptions {
+	return VerifyOptions{
+		Redownload:      false,
+		DownloadOptions: DefaultDownloadOptions(),
+	}
+}
+
+// MangaVerification is the result of verifying a manga of the library.
+type MangaVerification struct {
+	// Library is the indexed manga.
+	Library LibraryManga `json:"library"`
+
+	// Problems found in the manga files (e.g. its series.json).
+	Problems []string `json:"problems,omitempty"`
+
+	// Chapters verified, in the index order.
+	Chapters []ChapterVerification `json:"chapters"`
+}
+
+// VerifyReport is the result of Library.Verify.
+type VerifyReport struct {
+	// Mangas verified.
+	Mangas []MangaVerification `json:"mangas"`
+
+	// Verified is the amount of chapters verified.
+	Verified int `json:"verified"`
+
+	// Failed is the amount of chapters with problems.
+	Failed int `json:"failed"`
+
+	// Redownloaded is the amount of failed chapters downloaded again correctly.
+	Redownloaded int `json:"redownloaded"`
+}
+
+// Verify checks every chapter of the library index (see Scan and
+// VerifyChapter) and the series.json of each manga. Chapters recorded
+// in a manifest (see Manifest) are also checked by their size and SHA-256.
+//
+// Chapters that fail are downloaded again if VerifyOptions.Redownload
+// is set, the redownloaded chapter is verified again.
+func (l *Library) Verify(ctx context.Context, options VerifyOptions) (VerifyReport, error) {
+	var report VerifyReport
+
+	mangas, err := l.Mangas()
+	if err != nil {
+		return report, err
+	}
+
+	fs := l.client.options.FS
+	for _, indexed := range mangas {
+		result := MangaVerification{Library: indexed}
+		if indexed.HasSeriesJSON {
+			dir := filepath.Join(l.options.Directory, indexed.Dir)
+			if _, err := readSeriesJSON(fs, dir); err != nil {
+				result.Problems = append(result.Problems, fmt.Sprintf("can't read series.json: %s", err))
+			}
+		}
+
+		manifestDir := l.manifestDir(indexed)
+		manifest, err := ReadManifest(fs, manifestDir)
+		if err != nil {
+			result.Problems = append(result.Problems, err.Error())
+		}
+
+		var failed []int
+		for _, chapter := range indexed.Chapters {
+			if err := ctx.Err(); err != nil {
+				return report, err
+			}
+
+			path := filepath.Join(l.options.Directory, chapter.Path)
+			l.client.logger.Log("verifying chapter %q", path)
+			verification := verifyChapter(fs, path, chapter.Format)
+			if rel, err := filepath.Rel(manifestDir, path); err == nil {
+				if entry, ok := manifest.Path(rel); ok {
+					verifyManifestChapter(fs, entry, &verification)
+				}
+			}
+			report.Verified++
+			if !verification.OK() {
+				report.Failed++
+				failed = append(failed, len(result.Chapters))
+				l.client.logger.Log("chapter %q has problems: %s", path, strings.Join(verification.Problems, "; "))
+			}
+			result.Chapters = append(result.Chapters, verification)
+		}
+
+		if options.Redownload && len(failed) > 0 {
+			report.Redownloaded += l.redownload(ctx, indexed, result.Chapters, failed, options.DownloadOptions)
+			if err := ctx.Err(); err != nil {
+				return report, err
+			}
+		}
+		report.Mangas = append(report.Mangas, result)
+	}
+	return report, nil
+}
+
+// redownload downloads again the failed chapters (indexes of
+// verifications) of the manga, returns the amount downloaded correctly.
+func (l *Library) redownload(
+	ctx context.Context,
+	indexed LibraryManga,
+	verifications []ChapterVerification,
+	failed []int,
+	options DownloadOptions,
+) int {
+	setError := func(err error) {
+		for _, i := range failed {
+			verifications[i].RedownloadError = err.Error()
+		}
+	}
+
+	if l.options.CreateProviderDir && indexed.Provider != l.client.ProviderName(l.client.Info()) {
+		setError(fmt.Errorf("manga is not from %s", l.client))
+		return 0
+	}
+	manga, err := l.findManga(ctx, indexed)
+	if err == nil && manga == nil {
+		err = fmt.Errorf("manga %q not found in %s", indexed.Title, l.client)
+	}
+	if err != nil {
+		setError(err)
+		return 0
+	}
+	chapters, err := l.client.MangaChapters(ctx, manga)
+	if err != nil {
+		setError(err)
+		return 0
+	}
+
+	fs := l.client.options.FS
+	options.SkipIfExists = false
+
+	var redownloaded int
+	for _, i := range failed {
+		verification := &verifications[i]
+		chapter := l.matchChapter(indexed.Chapters[i], chapters)
+		if chapter == nil {
+			verification.RedownloadError = "chapter not found in the provider"
+			continue
+		}
+
+		options.Format = verification.Format
+		downloaded, err := l.client.DownloadChapter(ctx, chapter, options)
+		if err != nil {
+			verification.RedownloadError = err.Error()
+			l.client.logger.Log("error redownloading chapter %q: %s", verification.Path, verification.RedownloadError)
+			continue
+		}
+
+		path := downloaded.Path()
+		verification.Redownloaded = path
+		if path != verification.Path {
+			// the broken chapter was not replaced
+			if err := l.client.removeRecordedChapter(l.manifestDir(indexed), verification.Path); err != nil {
+				verification.RedownloadError = err.Error()
+				continue
+			}
+		}
+		if again := verifyChapter(fs, path, verification.Format); !again.OK() {
+			verification.RedownloadError = "redownloaded chapter has problems: " + strings.Join(again.Problems, "; ")
+			continue
+		}
+		redownloaded++
+	}
+	return redownloaded
+}
+
+// matchChapter finds the provider chapter of the indexed one, by
+// its name (ClientOptions.ChapterName) else by its number and
+// scanlation group, nil if not found.
+func (l *Library) matchChapter(indexed LibraryChapter, chapters []mangadata.Chapter) mangadata.Chapter {
+	base := filepath.Base(indexed.Path)
+	name := base[:len(base)-len(indexed.Format.Extension())]
+	for _, chapter := range chapters {
+		if l.client.ChapterName(chapter, FormatImages) == name {
+			return chapter
+		}
+	}
+
+	key := chapterNumberKey(indexed.Number)
+	var found mangadata.Chapter
+	for _, chapter := range chapters {
+		info := chapter.Info()
+		if chapterNumberKey(info.Number) != key {
+			continue
+		}
+		if strings.EqualFold(info.ScanlationGroup, indexed.ScanlationGroup) {
+			return chapter
+		}
+		if found == nil {
+			found = chapter
+		}
+	}
+	return found
+}